@@ -16,7 +16,8 @@ import (
 	"github.com/jcmturner/gokrb5/v8/spnego"
 )
 
-// GSS implements the pq.GSS interface.
+// GSS implements the pq.GSS interface. It doesn't implement pq.GSSEncrypter,
+// so it can't be used for GSSAPI transport encryption (gssencmode).
 type GSS struct {
 	cli *client.Client
 }
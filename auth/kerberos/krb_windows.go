@@ -7,7 +7,8 @@ import (
 	"github.com/alexbrainman/sspi/negotiate"
 )
 
-// GSS implements the pq.GSS interface.
+// GSS implements the pq.GSS interface. It doesn't implement pq.GSSEncrypter,
+// so it can't be used for GSSAPI transport encryption (gssencmode).
 type GSS struct {
 	creds *sspi.Credentials
 	ctx   *negotiate.ClientContext
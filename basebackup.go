@@ -0,0 +1,481 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq/internal/proto"
+)
+
+var errBaseBackupActive = errors.New("pq: base backup in progress; call Close() to finish it")
+
+// BaseBackupOptions are options for [ReplicationConn.BaseBackup].
+type BaseBackupOptions struct {
+	// Label of the backup; defaults to "pq base backup".
+	Label string
+
+	// Request a fast checkpoint, instead of spreading out the I/O of the
+	// checkpoint.
+	Fast bool
+
+	// Include the WAL needed to restore the backup in the base archive.
+	WAL bool
+
+	// Don't wait for the WAL to be archived after the backup.
+	NoWait bool
+
+	// Maximum transfer rate in kilobytes per second; 0 means no limit.
+	MaxRate int
+
+	// Include a tablespace_map file in the base archive.
+	TablespaceMap bool
+
+	// Send a backup manifest as the last archive.
+	Manifest bool
+
+	// Called every time data is read from an archive, with the total number
+	// of bytes read so far and the estimated total size of the backup.
+	Progress func(done, total int64)
+}
+
+// BaseBackup is a base backup started with [ReplicationConn.BaseBackup].
+//
+// The backup consists of a tar archive for the main data directory and one for
+// every tablespace, followed by a backup manifest if
+// [BaseBackupOptions.Manifest] is set. These are read in order with
+// [BaseBackup.Next].
+type BaseBackup struct {
+	StartLSN      LSN                // WAL location where the backup starts.
+	StartTimeline int32              // Timeline where the backup starts.
+	EndLSN        LSN                // WAL location where the backup ends; set after the last archive is read.
+	EndTimeline   int32              // Timeline where the backup ends; set after the last archive is read.
+	Tablespaces   []BackupTablespace // Main data directory and all tablespaces.
+
+	rc       *ReplicationConn
+	opts     BaseBackupOptions
+	finish   func()
+	newProto bool           // PostgreSQL 15 protocol, with a single COPY stream.
+	archives int            // Number of archives started.
+	cur      *BackupArchive // Last archive returned from Next.
+	total    int64          // Estimated size of the backup.
+	done     int64          // Bytes read so far.
+	endTyps  []fieldDesc
+	finished bool // Got ReadyForQuery.
+	err      error
+}
+
+// BackupTablespace is a tablespace in a [BaseBackup].
+type BackupTablespace struct {
+	OID      uint32 // OID of the tablespace; 0 for the main data directory.
+	Location string // Full path of the tablespace directory; empty for the main data directory.
+	Size     int64  // Estimated size in bytes; only set if BaseBackupOptions.Progress is set.
+}
+
+// BackupArchive is a tar archive of a tablespace, or the backup manifest, in a
+// [BaseBackup]. The archive data is read with Read.
+type BackupArchive struct {
+	// File name of the archive as used by pg_basebackup: "base.tar" for the
+	// main data directory, "«oid».tar" for tablespaces, and
+	// "backup_manifest" for the manifest.
+	Name string
+
+	// Tablespace for this archive; nil for the backup manifest.
+	Tablespace *BackupTablespace
+
+	b    *BaseBackup
+	buf  []byte
+	done bool
+}
+
+// BaseBackup starts a base backup of the server. This needs a physical
+// replication connection (replication=true).
+//
+// The connection can't be used for anything else until all archives are read
+// or [BaseBackup.Close] is called. The backup is cancelled if ctx is cancelled
+// before that, after which the connection can't be used any more.
+func (rc *ReplicationConn) BaseBackup(ctx context.Context, opts *BaseBackupOptions) (*BaseBackup, error) {
+	if rc.streaming {
+		return nil, errReplicationStreaming
+	}
+	if err := rc.cn.err.get(); err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &BaseBackupOptions{}
+	}
+	v := rc.cn.parameterStatus.serverVersion
+	b := &BaseBackup{rc: rc, opts: *opts, newProto: v == 0 || v >= 150000}
+
+	q := b.query()
+	err := rc.sendQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	b.finish = rc.cn.watchCancel(ctx, false)
+	rc.cn.busy = errBaseBackupActive
+
+	// Read the start position and the list of tablespaces, until the COPY
+	// stream starts.
+	var (
+		r       readBuf
+		typs    []fieldDesc
+		results [][][]string
+		resErr  error
+	)
+	for {
+		t, err := rc.cn.recv1Buf(&r)
+		if err != nil {
+			return nil, b.fail(rc.cn.handleError(err, q))
+		}
+		switch t {
+		case proto.CommandComplete:
+			// Ignore.
+		case proto.RowDescription:
+			typs = parsePortalRowDescribe(&r).colTyps
+			results = append(results, nil)
+		case proto.DataRow:
+			if len(results) > 0 {
+				results[len(results)-1] = append(results[len(results)-1], readDataRow(&r, typs))
+			}
+		case proto.CopyOutResponse:
+			if err := b.parseHeader(results); err != nil {
+				rc.cn.err.set(driver.ErrBadConn)
+				return nil, b.fail(err)
+			}
+			if !b.newProto { // Every archive has its own CopyOutResponse.
+				if err := rc.cn.saveMessage(t, &r); err != nil {
+					return nil, b.fail(err)
+				}
+			}
+			return b, nil
+		case proto.ErrorResponse:
+			resErr = parseError(&r, q)
+		case proto.ReadyForQuery:
+			rc.cn.processReadyForQuery(&r)
+			if resErr == nil {
+				resErr = errUnexpectedReady
+			}
+			return nil, b.fail(rc.cn.handleError(resErr, q))
+		default:
+			rc.cn.err.set(driver.ErrBadConn)
+			return nil, b.fail(fmt.Errorf("pq: unexpected message for BASE_BACKUP: %q", t))
+		}
+	}
+}
+
+func (b *BaseBackup) query() string {
+	var opts []string
+	label := b.opts.Label
+	if label == "" {
+		label = "pq base backup"
+	}
+	if b.newProto {
+		opts = append(opts, "LABEL "+replicationLiteral(label))
+		if b.opts.Progress != nil {
+			opts = append(opts, "PROGRESS")
+		}
+		if b.opts.Fast {
+			opts = append(opts, "CHECKPOINT 'fast'")
+		}
+		if b.opts.WAL {
+			opts = append(opts, "WAL")
+		}
+		if b.opts.NoWait {
+			opts = append(opts, "WAIT false")
+		}
+		if b.opts.MaxRate > 0 {
+			opts = append(opts, "MAX_RATE "+strconv.Itoa(b.opts.MaxRate))
+		}
+		if b.opts.TablespaceMap {
+			opts = append(opts, "TABLESPACE_MAP")
+		}
+		if b.opts.Manifest {
+			opts = append(opts, "MANIFEST 'yes'")
+		}
+		return "BASE_BACKUP (" + strings.Join(opts, ", ") + ")"
+	}
+
+	opts = append(opts, "LABEL "+replicationLiteral(label))
+	if b.opts.Progress != nil {
+		opts = append(opts, "PROGRESS")
+	}
+	if b.opts.Fast {
+		opts = append(opts, "FAST")
+	}
+	if b.opts.WAL {
+		opts = append(opts, "WAL")
+	}
+	if b.opts.NoWait {
+		opts = append(opts, "NOWAIT")
+	}
+	if b.opts.MaxRate > 0 {
+		opts = append(opts, "MAX_RATE "+strconv.Itoa(b.opts.MaxRate))
+	}
+	if b.opts.TablespaceMap {
+		opts = append(opts, "TABLESPACE_MAP")
+	}
+	if b.opts.Manifest {
+		opts = append(opts, "MANIFEST 'yes'")
+	}
+	return "BASE_BACKUP " + strings.Join(opts, " ")
+}
+
+// parseHeader parses the result sets with the start position and tablespaces.
+func (b *BaseBackup) parseHeader(results [][][]string) error {
+	if len(results) != 2 || len(results[0]) != 1 || len(results[0][0]) < 2 {
+		return fmt.Errorf("pq: unexpected result for BASE_BACKUP: %q", results)
+	}
+	var err error
+	b.StartLSN, b.StartTimeline, err = parseWALPosition(results[0][0])
+	if err != nil {
+		return err
+	}
+
+	for _, row := range results[1] {
+		if len(row) < 3 {
+			return fmt.Errorf("pq: unexpected tablespace for BASE_BACKUP: %q", row)
+		}
+		var ts BackupTablespace
+		if row[0] != "" {
+			n, err := strconv.ParseUint(row[0], 10, 32)
+			if err != nil {
+				return fmt.Errorf("pq: parsing tablespace OID: %w", err)
+			}
+			ts.OID = uint32(n)
+		}
+		ts.Location = row[1]
+		if row[2] != "" {
+			ts.Size, err = strconv.ParseInt(row[2], 10, 64)
+			if err != nil {
+				return fmt.Errorf("pq: parsing tablespace size: %w", err)
+			}
+			ts.Size *= 1024
+		}
+		b.total += ts.Size
+		b.Tablespaces = append(b.Tablespaces, ts)
+	}
+	return nil
+}
+
+// parseWALPosition parses a row with a WAL location and timeline.
+func parseWALPosition(row []string) (LSN, int32, error) {
+	lsn, err := ParseLSN(row[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	tli, err := strconv.ParseInt(row[1], 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("pq: parsing timeline: %w", err)
+	}
+	return lsn, int32(tli), nil
+}
+
+// Next returns the next archive in the backup, or io.EOF if there are no more
+// archives. Any unread data in the previous archive is discarded.
+func (b *BaseBackup) Next() (*BackupArchive, error) {
+	if b.cur != nil && !b.cur.done {
+		if _, err := io.Copy(io.Discard, b.cur); err != nil {
+			return nil, err
+		}
+	}
+	b.cur = nil
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.finished {
+		return nil, io.EOF
+	}
+
+	var r readBuf
+	for {
+		t, err := b.rc.cn.recv1Buf(&r)
+		if err != nil {
+			return nil, b.fail(b.rc.cn.handleError(err))
+		}
+		switch t {
+		case proto.CopyOutResponse:
+			if !b.newProto {
+				if b.archives < len(b.Tablespaces) {
+					ts := &b.Tablespaces[b.archives]
+					name := "base.tar"
+					if ts.OID != 0 {
+						name = strconv.FormatUint(uint64(ts.OID), 10) + ".tar"
+					}
+					return b.newArchive(name, ts), nil
+				}
+				return b.newArchive("backup_manifest", nil), nil
+			}
+		case proto.CopyDataResponse:
+			if !b.newProto || len(r) == 0 {
+				break
+			}
+			switch r[0] {
+			case 'n': // New archive: name and tablespace location.
+				r = r[1:]
+				name, loc := r.string(), r.string()
+				var ts *BackupTablespace
+				for i := range b.Tablespaces {
+					if b.Tablespaces[i].Location == loc {
+						ts = &b.Tablespaces[i]
+						break
+					}
+				}
+				return b.newArchive(name, ts), nil
+			case 'm': // Manifest.
+				return b.newArchive("backup_manifest", nil), nil
+			}
+		case proto.CopyDoneResponse, proto.CommandComplete:
+			// Ignore.
+		case proto.RowDescription:
+			b.endTyps = parsePortalRowDescribe(&r).colTyps
+		case proto.DataRow:
+			row := readDataRow(&r, b.endTyps)
+			if len(row) < 2 {
+				b.rc.cn.err.set(driver.ErrBadConn)
+				return nil, b.fail(fmt.Errorf("pq: unexpected end position for BASE_BACKUP: %q", row))
+			}
+			b.EndLSN, b.EndTimeline, err = parseWALPosition(row)
+			if err != nil {
+				b.rc.cn.err.set(driver.ErrBadConn)
+				return nil, b.fail(err)
+			}
+		case proto.ErrorResponse:
+			return nil, b.readError(&r)
+		case proto.ReadyForQuery:
+			b.rc.cn.processReadyForQuery(&r)
+			b.finished = true
+			b.end()
+			return nil, io.EOF
+		default:
+			b.rc.cn.err.set(driver.ErrBadConn)
+			return nil, b.fail(fmt.Errorf("pq: unexpected message in BASE_BACKUP: %q", t))
+		}
+	}
+}
+
+func (b *BaseBackup) newArchive(name string, ts *BackupTablespace) *BackupArchive {
+	b.archives++
+	b.cur = &BackupArchive{Name: name, Tablespace: ts, b: b}
+	return b.cur
+}
+
+// Close stops the backup if not all archives were read, and discards the
+// remaining data. The connection can be used for other commands after this.
+//
+// The backup is stopped with a CancelRequest, so only the data the server
+// already sent is read. The rest of the backup is read and discarded if the
+// CancelRequest can't be sent or arrives after the server finished sending.
+func (b *BaseBackup) Close() error {
+	cancelled := false
+	if !b.finished && b.err == nil {
+		cancelled = b.rc.cn.cancel(context.Background()) == nil
+	}
+	for {
+		_, err := b.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if cancelled && As(err, "57014") != nil { // query_canceled
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Read data from the archive. It returns io.EOF at the end of the archive.
+func (a *BackupArchive) Read(p []byte) (int, error) {
+	for len(a.buf) == 0 {
+		if a.done {
+			return 0, io.EOF
+		}
+		if err := a.b.readData(a); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, a.buf)
+	a.buf = a.buf[n:]
+	a.b.done += int64(n)
+	if a.b.opts.Progress != nil {
+		a.b.opts.Progress(a.b.done, a.b.total)
+	}
+	return n, nil
+}
+
+// readData reads the next CopyData message for the archive a.
+func (b *BaseBackup) readData(a *BackupArchive) error {
+	if b.err != nil {
+		return b.err
+	}
+	var r readBuf
+	t, err := b.rc.cn.recv1Buf(&r)
+	if err != nil {
+		return b.fail(b.rc.cn.handleError(err))
+	}
+	switch t {
+	case proto.CopyDataResponse:
+		if !b.newProto {
+			a.buf = r
+			return nil
+		}
+		if len(r) == 0 {
+			return nil
+		}
+		switch r[0] {
+		case 'd':
+			a.buf = r[1:]
+		case 'p':
+			// Progress report; ignored, as progress is counted from the data
+			// that was read.
+		default: // Start of the next archive or manifest.
+			a.done = true
+			return b.rc.cn.saveMessage(t, &r)
+		}
+	case proto.CopyDoneResponse:
+		a.done = true
+	case proto.ErrorResponse:
+		a.done = true
+		return b.readError(&r)
+	default:
+		b.rc.cn.err.set(driver.ErrBadConn)
+		return b.fail(fmt.Errorf("pq: unexpected message in BASE_BACKUP: %q", t))
+	}
+	return nil
+}
+
+// readError reads the ReadyForQuery after an ErrorResponse, and ends the
+// backup with the error.
+func (b *BaseBackup) readError(r *readBuf) error {
+	resErr := parseError(r, "")
+	for {
+		t, err := b.rc.cn.recv1Buf(r)
+		if err != nil {
+			return b.fail(b.rc.cn.handleError(err))
+		}
+		if t == proto.ReadyForQuery {
+			b.rc.cn.processReadyForQuery(r)
+			b.finished = true
+			return b.fail(b.rc.cn.handleError(resErr))
+		}
+	}
+}
+
+func (b *BaseBackup) fail(err error) error {
+	b.err = err
+	b.end()
+	return err
+}
+
+func (b *BaseBackup) end() {
+	if b.finish != nil {
+		b.rc.cn.busy = nil
+		b.finish()
+		b.finish = nil
+	}
+}
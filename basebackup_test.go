@@ -0,0 +1,279 @@
+package pq
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lib/pq/internal/pqtest"
+	"github.com/lib/pq/internal/proto"
+)
+
+func TestBaseBackup(t *testing.T) {
+	pqtest.SkipPgbouncer(t)
+	pqtest.SkipPgpool(t)
+	pqtest.SkipCockroach(t)
+	t.Parallel()
+
+	var (
+		ctx = context.Background()
+		rc  = replicationConn(t, "replication=true")
+	)
+	var progress int64
+	b, err := rc.BaseBackup(ctx, &BaseBackupOptions{
+		Fast:     true,
+		NoWait:   true,
+		Manifest: true,
+		Progress: func(done, total int64) { progress = done },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.StartLSN == 0 || b.StartTimeline < 1 || len(b.Tablespaces) == 0 {
+		t.Errorf("%#v", b)
+	}
+
+	var names []string
+	for {
+		a, err := b.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := io.Copy(io.Discard, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			t.Errorf("%s: no data", a.Name)
+		}
+		names = append(names, a.Name)
+	}
+	if names[len(names)-2] != "base.tar" || names[len(names)-1] != "backup_manifest" {
+		t.Errorf("wrong archives: %q", names)
+	}
+	if b.EndLSN < b.StartLSN || progress == 0 {
+		t.Errorf("end: %s; progress: %d", b.EndLSN, progress)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.IdentifySystem(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBaseBackupFake(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		version string
+		query   string
+	}{
+		{"16.2", `BASE_BACKUP (LABEL 'it''s', PROGRESS, CHECKPOINT 'fast', WAL, MANIFEST 'yes')`},
+		{"14.7", `BASE_BACKUP LABEL 'it''s' PROGRESS FAST WAL MANIFEST 'yes'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			t.Parallel()
+			newProto := tt.version >= "15"
+			f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+				f.Startup(cn, map[string]string{"server_version": tt.version})
+				for {
+					code, msg, ok := f.ReadMsg(cn)
+					if !ok {
+						return
+					}
+					switch code {
+					case proto.Query:
+						if q := strings.TrimRight(string(msg), "\x00"); q != tt.query {
+							f.WriteMsg(cn, proto.ErrorResponse, "SERROR\x00C42601\x00Msyntax error: "+q+"\x00\x00")
+							f.WriteMsg(cn, proto.ReadyForQuery, "I")
+							continue
+						}
+						writeRows(f, cn, []string{"recptr", "tli"}, []any{"0/2000028", 1})
+						writeRows(f, cn, []string{"spcoid", "spclocation", "size"},
+							[]any{16384, "/tblspc", 1},
+							[]any{nil, nil, 2})
+
+						archives := []struct{ name, loc, data string }{
+							{"16384.tar", "/tblspc", "tblspc"},
+							{"base.tar", "", "base"},
+						}
+						if newProto {
+							f.WriteMsg(cn, proto.CopyOutResponse, "\x00\x00\x00")
+							for _, a := range archives {
+								f.WriteMsg(cn, proto.CopyDataResponse, "n"+a.name+"\x00"+a.loc+"\x00")
+								f.WriteMsg(cn, proto.CopyDataResponse, "d"+a.data)
+								f.WriteMsg(cn, proto.CopyDataResponse, "p\x00\x00\x00\x00\x00\x00\x00\x01")
+								f.WriteMsg(cn, proto.CopyDataResponse, "d"+a.data)
+							}
+							f.WriteMsg(cn, proto.CopyDataResponse, "m")
+							f.WriteMsg(cn, proto.CopyDataResponse, "dmanifest")
+							f.WriteMsg(cn, proto.CopyDataResponse, "dmanifest")
+							f.WriteMsg(cn, proto.CopyDoneResponse, "")
+						} else {
+							for _, a := range append(archives, struct{ name, loc, data string }{data: "manifest"}) {
+								f.WriteMsg(cn, proto.CopyOutResponse, "\x00\x00\x00")
+								f.WriteMsg(cn, proto.CopyDataResponse, a.data)
+								f.WriteMsg(cn, proto.CopyDataResponse, a.data)
+								f.WriteMsg(cn, proto.CopyDoneResponse, "")
+							}
+						}
+						writeRows(f, cn, []string{"recptr", "tli"}, []any{"0/2000100", 1})
+						f.WriteMsg(cn, proto.ReadyForQuery, "I")
+					case proto.Terminate:
+						cn.Close()
+						return
+					}
+				}
+			})
+			defer f.Close()
+
+			var (
+				ctx       = context.Background()
+				rc        = replicationConn(t, f.DSN())
+				done, tot int64
+				opts      = &BaseBackupOptions{Label: "it's", Fast: true, WAL: true, Manifest: true}
+			)
+			opts.Progress = func(d, t int64) { done, tot = d, t }
+			b, err := rc.BaseBackup(ctx, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.StartLSN != 0x2000028 || b.StartTimeline != 1 {
+				t.Errorf("start: %s %d", b.StartLSN, b.StartTimeline)
+			}
+			want := []BackupTablespace{{OID: 16384, Location: "/tblspc", Size: 1024}, {Size: 2048}}
+			if len(b.Tablespaces) != 2 || b.Tablespaces[0] != want[0] || b.Tablespaces[1] != want[1] {
+				t.Errorf("\nhave: %#v\nwant: %#v", b.Tablespaces, want)
+			}
+			if _, err := rc.IdentifySystem(ctx); err != errBaseBackupActive {
+				t.Errorf("wrong error: %v", err)
+			}
+
+			var have []string
+			for {
+				a, err := b.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := io.ReadAll(a)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ts := "-"
+				if a.Tablespace != nil {
+					ts = a.Tablespace.Location
+				}
+				have = append(have, a.Name+" "+ts+" "+string(data))
+			}
+			wantArchives := []string{"16384.tar /tblspc tblspctblspc", "base.tar  basebase", "backup_manifest - manifestmanifest"}
+			if strings.Join(have, "\n") != strings.Join(wantArchives, "\n") {
+				t.Errorf("\nhave: %q\nwant: %q", have, wantArchives)
+			}
+			if b.EndLSN != 0x2000100 || b.EndTimeline != 1 {
+				t.Errorf("end: %s %d", b.EndLSN, b.EndTimeline)
+			}
+			if done != 36 || tot != 3072 {
+				t.Errorf("progress: %d/%d", done, tot)
+			}
+			if err := b.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := rc.IdentifySystem(ctx); !pqtest.ErrorContains(err, "syntax error: IDENTIFY_SYSTEM") {
+				t.Errorf("wrong error: %v", err)
+			}
+		})
+	}
+}
+
+func TestBaseBackupClose(t *testing.T) {
+	t.Parallel()
+	var (
+		cancelCh = make(chan struct{}, 1)
+		finished atomic.Bool
+	)
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		code, _, ok := f.ReadStartupPacket(cn)
+		if !ok {
+			return
+		}
+		if code == proto.CancelRequestCode {
+			cancelCh <- struct{}{}
+			cn.Close()
+			return
+		}
+		f.WriteMsg(cn, proto.AuthenticationRequest, "\x00\x00\x00\x00")
+		f.WriteStartup(cn, map[string]string{"server_version": "16.2"})
+		f.WriteBackendKeyData(cn, 1, []byte{1, 2, 3, 4})
+		f.WriteMsg(cn, proto.ReadyForQuery, "I")
+		for {
+			code, msg, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			switch code {
+			case proto.Query:
+				if q := strings.TrimRight(string(msg), "\x00"); !strings.HasPrefix(q, "BASE_BACKUP") {
+					f.WriteMsg(cn, proto.ErrorResponse, "SERROR\x00C42601\x00Msyntax error: "+q+"\x00\x00")
+					f.WriteMsg(cn, proto.ReadyForQuery, "I")
+					continue
+				}
+				writeRows(f, cn, []string{"recptr", "tli"}, []any{"0/2000028", 1})
+				writeRows(f, cn, []string{"spcoid", "spclocation", "size"}, []any{nil, nil, nil})
+				f.WriteMsg(cn, proto.CopyOutResponse, "\x00\x00\x00")
+				f.WriteMsg(cn, proto.CopyDataResponse, "nbase.tar\x00\x00")
+				f.WriteMsg(cn, proto.CopyDataResponse, "dbase")
+
+				// Wait for the cancel, or send the rest of the backup.
+				select {
+				case <-cancelCh:
+					f.WriteMsg(cn, proto.ErrorResponse, "SERROR\x00C57014\x00Mcanceling statement due to user request\x00\x00")
+				case <-time.After(5 * time.Second):
+					finished.Store(true)
+					f.WriteMsg(cn, proto.CopyDataResponse, "dbase")
+					f.WriteMsg(cn, proto.CopyDoneResponse, "")
+					writeRows(f, cn, []string{"recptr", "tli"}, []any{"0/2000100", 1})
+				}
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.Terminate:
+				cn.Close()
+				return
+			}
+		}
+	})
+	defer f.Close()
+
+	ctx := context.Background()
+	rc := replicationConn(t, f.DSN()+" sslmode=disable")
+	b, err := rc.BaseBackup(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := b.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Read(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if finished.Load() {
+		t.Error("backup was not cancelled")
+	}
+	if _, err := rc.IdentifySystem(ctx); !pqtest.ErrorContains(err, "syntax error: IDENTIFY_SYSTEM") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+)
+
+// Batch is a list of queries that are sent to the server at once, and the
+// results are read with a single round trip.
+//
+// All queries in a batch are run in a single implicit transaction: if a query
+// fails then all changes are rolled back and all queries after it return
+// [ErrPipelineAborted].
+//
+// Use [Pipeline] for more control.
+type Batch struct {
+	queries []batchQuery
+}
+
+type batchQuery struct {
+	query string
+	args  []any
+}
+
+// Queue a query in the batch.
+func (b *Batch) Queue(query string, args ...any) {
+	b.queries = append(b.queries, batchQuery{query: query, args: args})
+}
+
+// Len returns the number of queued queries.
+func (b *Batch) Len() int {
+	return len(b.queries)
+}
+
+// SendBatch sends all queued queries to the server. The results must be read
+// in the same order as the queries were queued, and must be closed with
+// [BatchResults.Close] before the connection can be used again.
+//
+// c must be a pq connection, which can be retrieved with [sql.Conn.Raw]:
+//
+//	var b pq.Batch
+//	b.Queue(`insert into t values ($1)`, 1)
+//	b.Queue(`select * from t`)
+//
+//	err = c.Raw(func(driverConn any) error {
+//		br, err := b.SendBatch(ctx, driverConn.(driver.Conn))
+//		if err != nil {
+//			return err
+//		}
+//		defer br.Close()
+//
+//		_, err = br.Exec()
+//		if err != nil {
+//			return err
+//		}
+//		rows, err := br.Query()
+//		[..]
+//	})
+func (b *Batch) SendBatch(ctx context.Context, c driver.Conn) (*BatchResults, error) {
+	p, err := NewPipeline(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	for i, q := range b.queries {
+		err := p.Queue(q.query, q.args...)
+		if err != nil {
+			_ = p.Close()
+			return nil, fmt.Errorf("pq: batch query %d: %w", i+1, err)
+		}
+	}
+	err = p.Sync()
+	if err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+	return &BatchResults{p: p}, nil
+}
+
+// BatchResults reads the results from [Batch.SendBatch].
+type BatchResults struct {
+	p *Pipeline
+}
+
+// Exec reads the result of the next query in the batch, discarding any rows it
+// returned.
+func (br *BatchResults) Exec() (driver.Result, error) {
+	return br.p.Exec()
+}
+
+// Query reads the result of the next query in the batch as rows.
+//
+// The rows must be read or closed before the next result can be read; any
+// remaining rows are discarded if Exec or Query is called before that.
+func (br *BatchResults) Query() (driver.Rows, error) {
+	return br.p.Query()
+}
+
+// Close discards any remaining results, after which the connection can be used
+// again.
+func (br *BatchResults) Close() error {
+	return br.p.Close()
+}
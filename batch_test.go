@@ -0,0 +1,113 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+
+	"github.com/lib/pq/internal/pqtest"
+	"github.com/lib/pq/pqerror"
+)
+
+// sendBatch runs SendBatch() on a connection from db, and calls f with the
+// results.
+func sendBatch(t *testing.T, b *Batch, f func(*BatchResults)) {
+	t.Helper()
+	c, err := pqtest.MustDB(t).Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = c.Raw(func(driverConn any) error {
+		br, err := b.SendBatch(context.Background(), driverConn.(driver.Conn))
+		if err != nil {
+			return err
+		}
+		f(br)
+		return br.Close()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	t.Parallel()
+
+	var b Batch
+	b.Queue(`create temp table tbl (i int)`)
+	b.Queue(`insert into tbl values ($1), ($2)`, 1, int64(2))
+	b.Queue(`select i from tbl order by i`)
+	b.Queue(`select $1::text`, "x")
+	if b.Len() != 4 {
+		t.Fatalf("Len: %d", b.Len())
+	}
+
+	sendBatch(t, &b, func(br *BatchResults) {
+		if _, err := br.Exec(); err != nil {
+			t.Fatal(err)
+		}
+		res, err := br.Exec()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := res.RowsAffected(); n != 2 {
+			t.Errorf("RowsAffected: %d", n)
+		}
+		rows, err := br.Query()
+		have := readRows(t, rows, err)
+		if want := [][]string{{"1"}, {"2"}}; !reflect.DeepEqual(have, want) {
+			t.Errorf("\nhave: %v\nwant: %v", have, want)
+		}
+		// Don't read the last result; Close() should discard it.
+	})
+}
+
+func TestBatchError(t *testing.T) {
+	t.Parallel()
+
+	t.Run("query error", func(t *testing.T) {
+		var b Batch
+		b.Queue(`select 1`)
+		b.Queue(`select 1/0`)
+		b.Queue(`select 1`)
+		sendBatch(t, &b, func(br *BatchResults) {
+			if _, err := br.Exec(); err != nil {
+				t.Fatal(err)
+			}
+			_, err := br.Exec()
+			mustAs(t, err, pqerror.DivisionByZero)
+			_, err = br.Query()
+			if err != ErrPipelineAborted {
+				t.Errorf("wrong error: %v", err)
+			}
+		})
+	})
+
+	t.Run("argument error", func(t *testing.T) {
+		var b Batch
+		b.Queue(`select 1`)
+		b.Queue(`select $1`, struct{}{})
+
+		c, err := pqtest.MustDB(t).Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		err = c.Raw(func(driverConn any) error {
+			_, err := b.SendBatch(context.Background(), driverConn.(driver.Conn))
+			return err
+		})
+		if !pqtest.ErrorContains(err, "pq: batch query 2: pq: converting argument $1 type struct {}") {
+			t.Errorf("wrong error: %v", err)
+		}
+
+		// Connection is still usable.
+		var n int
+		if err := c.QueryRowContext(context.Background(), `select 1`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,613 @@
+package pq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq/internal/pqtime"
+	"github.com/lib/pq/oid"
+)
+
+// This file has the conversions from PostgreSQL's binary format for results.
+// Types which are returned as []byte in the text format are converted to the
+// same text that PostgreSQL would send, so it doesn't matter for the caller
+// which format was used.
+//
+// The exception is float4 and float8: the binary format has the exact value,
+// which is formatted as the shortest representation that round-trips. That's
+// what PostgreSQL 12 and newer send with the default extra_float_digits of 1,
+// but with extra_float_digits <= 0 or older servers the text format is rounded
+// to fewer digits. The server doesn't report extra_float_digits, so this can't
+// be matched.
+
+// binaryTypes are the types binaryDecode can decode, and that can be received
+// in the binary format with decideColumnFormats.
+var binaryTypes = map[oid.Oid]bool{
+	oid.T_bool: true, oid.T_float4: true, oid.T_float8: true, oid.T_numeric: true,
+	oid.T_date: true, oid.T_time: true, oid.T_timetz: true, oid.T_timestamp: true,
+	oid.T_timestamptz: true, oid.T_interval: true, oid.T_text: true,
+	oid.T_varchar: true, oid.T_bpchar: true, oid.T_name: true, oid.T_oid: true,
+	oid.T_json: true, oid.T_jsonb: true, oid.T_inet: true, oid.T_cidr: true,
+
+	oid.T__bool: true, oid.T__int2: true, oid.T__int4: true, oid.T__int8: true,
+	oid.T__float4: true, oid.T__float8: true, oid.T__numeric: true,
+	oid.T__date: true, oid.T__time: true, oid.T__timetz: true,
+	oid.T__timestamp: true, oid.T__timestamptz: true, oid.T__interval: true,
+	oid.T__text: true, oid.T__varchar: true, oid.T__bpchar: true,
+	oid.T__name: true, oid.T__oid: true, oid.T__json: true, oid.T__jsonb: true,
+	oid.T__inet: true, oid.T__cidr: true, oid.T__uuid: true, oid.T__pg_lsn: true,
+}
+
+func binaryLenErr(typ oid.Oid, s []byte) error {
+	return fmt.Errorf("pq: unable to decode %s; bad length: %d", strings.ToLower(oid.TypeName[typ]), len(s))
+}
+
+// binaryTimestamp decodes a binary timestamp or timestamptz, the same way as
+// parseTS does for the text format.
+func binaryTimestamp(ps *parameterStatus, s []byte, typ oid.Oid) (any, error) {
+	if len(s) != 8 {
+		return nil, binaryLenErr(typ, s)
+	}
+	switch us := int64(binary.BigEndian.Uint64(s)); us {
+	case math.MinInt64:
+		return parseTS(nil, "-infinity")
+	case math.MaxInt64:
+		return parseTS(nil, "infinity")
+	default:
+		t := pgTime(us)
+		if typ == oid.T_timestamptz && ps != nil && ps.currentLocation != nil {
+			return t.In(ps.currentLocation), nil
+		}
+		return t.In(pqtime.Location(0)), nil
+	}
+}
+
+// binaryDate decodes a binary date, the same way as parseTS does for the text
+// format.
+func binaryDate(s []byte) (any, error) {
+	if len(s) != 4 {
+		return nil, binaryLenErr(oid.T_date, s)
+	}
+	switch d := int32(binary.BigEndian.Uint32(s)); d {
+	case math.MinInt32:
+		return parseTS(nil, "-infinity")
+	case math.MaxInt32:
+		return parseTS(nil, "infinity")
+	default:
+		return time.Date(2000, 1, 1+int(d), 0, 0, 0, 0, pqtime.Location(0)), nil
+	}
+}
+
+// binaryTimeOfDay decodes a binary time, the same way as parseTime does for the
+// text format.
+func binaryTimeOfDay(s []byte) (time.Time, error) {
+	if len(s) != 8 {
+		return time.Time{}, binaryLenErr(oid.T_time, s)
+	}
+	us := int64(binary.BigEndian.Uint64(s))
+	return time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(us) * time.Microsecond), nil
+}
+
+// binaryFloat4 decodes a float4 to the same float64 as parsing the text format
+// from PostgreSQL 12 or newer with extra_float_digits > 0 does, which is the
+// shortest representation of the float32.
+func binaryFloat4(s []byte) (float64, error) {
+	if len(s) != 4 {
+		return 0, binaryLenErr(oid.T_float4, s)
+	}
+	f := math.Float32frombits(binary.BigEndian.Uint32(s))
+	if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+		return float64(f), nil
+	}
+	return strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+}
+
+// appendBinaryText appends the binary value s of type typ in the text format,
+// as PostgreSQL would send it.
+func appendBinaryText(buf []byte, ps *parameterStatus, s []byte, typ oid.Oid) ([]byte, error) {
+	switch typ {
+	case oid.T_bool:
+		if len(s) != 1 {
+			return nil, binaryLenErr(typ, s)
+		}
+		if s[0] != 0 {
+			return append(buf, 't'), nil
+		}
+		return append(buf, 'f'), nil
+	case oid.T_int2:
+		if len(s) != 2 {
+			return nil, binaryLenErr(typ, s)
+		}
+		return strconv.AppendInt(buf, int64(int16(binary.BigEndian.Uint16(s))), 10), nil
+	case oid.T_int4:
+		if len(s) != 4 {
+			return nil, binaryLenErr(typ, s)
+		}
+		return strconv.AppendInt(buf, int64(int32(binary.BigEndian.Uint32(s))), 10), nil
+	case oid.T_int8:
+		if len(s) != 8 {
+			return nil, binaryLenErr(typ, s)
+		}
+		return strconv.AppendInt(buf, int64(binary.BigEndian.Uint64(s)), 10), nil
+	case oid.T_oid:
+		if len(s) != 4 {
+			return nil, binaryLenErr(typ, s)
+		}
+		return strconv.AppendUint(buf, uint64(binary.BigEndian.Uint32(s)), 10), nil
+	case oid.T_float4:
+		if len(s) != 4 {
+			return nil, binaryLenErr(typ, s)
+		}
+		return appendFloatText(buf, float64(math.Float32frombits(binary.BigEndian.Uint32(s))), 32), nil
+	case oid.T_float8:
+		if len(s) != 8 {
+			return nil, binaryLenErr(typ, s)
+		}
+		return appendFloatText(buf, math.Float64frombits(binary.BigEndian.Uint64(s)), 64), nil
+	case oid.T_numeric:
+		return appendNumericText(buf, s)
+	case oid.T_text, oid.T_varchar, oid.T_bpchar, oid.T_name, oid.T_json:
+		return append(buf, s...), nil
+	case oid.T_jsonb:
+		if len(s) == 0 || s[0] != 1 {
+			return nil, fmt.Errorf("pq: unsupported jsonb version")
+		}
+		return append(buf, s[1:]...), nil
+	case oid.T_uuid:
+		u, err := decodeUUIDBinary(s)
+		return append(buf, u...), err
+	case oid.T_pg_lsn:
+		l, err := decodeLSNBinary(s)
+		return append(buf, l...), err
+	case oid.T_date:
+		if len(s) != 4 {
+			return nil, binaryLenErr(typ, s)
+		}
+		switch d := int32(binary.BigEndian.Uint32(s)); d {
+		case math.MinInt32:
+			return append(buf, "-infinity"...), nil
+		case math.MaxInt32:
+			return append(buf, "infinity"...), nil
+		default:
+			return appendDateText(buf, time.Date(2000, 1, 1+int(d), 0, 0, 0, 0, time.UTC), true), nil
+		}
+	case oid.T_timestamp, oid.T_timestamptz:
+		if len(s) != 8 {
+			return nil, binaryLenErr(typ, s)
+		}
+		switch us := int64(binary.BigEndian.Uint64(s)); us {
+		case math.MinInt64:
+			return append(buf, "-infinity"...), nil
+		case math.MaxInt64:
+			return append(buf, "infinity"...), nil
+		default:
+			t := pgTime(us).UTC()
+			if typ == oid.T_timestamptz && ps != nil && ps.currentLocation != nil {
+				t = t.In(ps.currentLocation)
+			}
+			bc := t.Year() <= 0
+			buf = appendDateText(buf, t, false)
+			buf = append(buf, ' ')
+			buf = appendTimeText(buf, int64(t.Hour()), t.Minute(), t.Second(), t.Nanosecond()/1000)
+			if typ == oid.T_timestamptz {
+				_, off := t.Zone()
+				buf = appendZoneText(buf, off)
+			}
+			if bc {
+				buf = append(buf, " BC"...)
+			}
+			return buf, nil
+		}
+	case oid.T_time:
+		t, err := binaryTimeOfDay(s)
+		if err != nil {
+			return nil, err
+		}
+		return appendTimeOfDayText(buf, t), nil
+	case oid.T_timetz:
+		if len(s) != 12 {
+			return nil, binaryLenErr(typ, s)
+		}
+		t, _ := binaryTimeOfDay(s[:8])
+		buf = appendTimeOfDayText(buf, t)
+		// The zone is in seconds west of UTC.
+		return appendZoneText(buf, -int(int32(binary.BigEndian.Uint32(s[8:])))), nil
+	case oid.T_interval:
+		return appendIntervalText(buf, s)
+	case oid.T_inet, oid.T_cidr:
+		return appendInetText(buf, s)
+	}
+	if _, ok := arrayElems[typ]; ok {
+		return appendArrayText(buf, ps, s)
+	}
+	return nil, fmt.Errorf("pq: don't know how to decode binary parameter of type %d", uint32(typ))
+}
+
+// appendFloatText formats f like PostgreSQL 12 and newer with
+// extra_float_digits > 0: the shortest representation that round-trips, in fixed notation if the exponent is in [-4, 6) for float4 or
+// [-4, 15) for float8, and in scientific notation otherwise.
+func appendFloatText(buf []byte, f float64, bitSize int) []byte {
+	switch {
+	case math.IsNaN(f):
+		return append(buf, "NaN"...)
+	case math.IsInf(f, 1):
+		return append(buf, "Infinity"...)
+	case math.IsInf(f, -1):
+		return append(buf, "-Infinity"...)
+	}
+	maxExp := 15
+	if bitSize == 32 {
+		maxExp = 6
+	}
+	e := strconv.FormatFloat(f, 'e', -1, bitSize)
+	exp, _ := strconv.Atoi(e[strings.IndexByte(e, 'e')+1:])
+	if exp < -4 || exp >= maxExp {
+		return append(buf, e...)
+	}
+	return strconv.AppendFloat(buf, f, 'f', -1, bitSize)
+}
+
+// appendNumericText formats a binary numeric like numeric_out.
+func appendNumericText(buf []byte, s []byte) ([]byte, error) {
+	if len(s) < 8 {
+		return nil, binaryLenErr(oid.T_numeric, s)
+	}
+	var (
+		ndigits = int(binary.BigEndian.Uint16(s))
+		weight  = int(int16(binary.BigEndian.Uint16(s[2:])))
+		sign    = binary.BigEndian.Uint16(s[4:])
+		dscale  = int(binary.BigEndian.Uint16(s[6:]))
+	)
+	if len(s) != 8+2*ndigits {
+		return nil, binaryLenErr(oid.T_numeric, s)
+	}
+	switch sign {
+	case 0xc000:
+		return append(buf, "NaN"...), nil
+	case 0xd000:
+		return append(buf, "Infinity"...), nil
+	case 0xf000:
+		return append(buf, "-Infinity"...), nil
+	case 0x4000:
+		buf = append(buf, '-')
+	}
+
+	// Digits are in base 10000, and weight is the power of 10000 of the first
+	// digit.
+	digit := func(i int) int {
+		if i < 0 || i >= ndigits {
+			return 0
+		}
+		return int(binary.BigEndian.Uint16(s[8+2*i:]))
+	}
+	appendDigit := func(buf []byte, d int) []byte {
+		return append(buf, byte('0'+d/1000), byte('0'+d/100%10), byte('0'+d/10%10), byte('0'+d%10))
+	}
+	if weight < 0 {
+		buf = append(buf, '0')
+	} else {
+		buf = strconv.AppendInt(buf, int64(digit(0)), 10)
+		for i := 1; i <= weight; i++ {
+			buf = appendDigit(buf, digit(i))
+		}
+	}
+	if dscale > 0 {
+		buf = append(buf, '.')
+		start := len(buf)
+		for i := weight + 1; len(buf)-start < dscale; i++ {
+			buf = appendDigit(buf, digit(i))
+		}
+		buf = buf[:start+dscale]
+	}
+	return buf, nil
+}
+
+// appendDateText appends the date of t in the ISO format, with a " BC" suffix
+// for years before 1 if bc is set.
+func appendDateText(buf []byte, t time.Time, bc bool) []byte {
+	y := t.Year()
+	if y <= 0 {
+		y = 1 - y
+	}
+	buf = fmt.Appendf(buf, "%04d-%02d-%02d", y, t.Month(), t.Day())
+	if bc && t.Year() <= 0 {
+		buf = append(buf, " BC"...)
+	}
+	return buf
+}
+
+// appendTimeText appends "hh:mm:ss" and up to 6 fractional digits for us,
+// without trailing zeros.
+func appendTimeText(buf []byte, h int64, m, sec, us int) []byte {
+	buf = fmt.Appendf(buf, "%02d:%02d:%02d", h, m, sec)
+	if us != 0 {
+		buf = append(buf, '.')
+		buf = append(buf, strings.TrimRight(fmt.Sprintf("%06d", us), "0")...)
+	}
+	return buf
+}
+
+// appendTimeOfDayText appends the time of the day of t, which may be 24:00:00.
+func appendTimeOfDayText(buf []byte, t time.Time) []byte {
+	if t.Day() == 2 {
+		return append(buf, "24:00:00"...)
+	}
+	return appendTimeText(buf, int64(t.Hour()), t.Minute(), t.Second(), t.Nanosecond()/1000)
+}
+
+// appendZoneText appends a time zone offset, in seconds east of UTC, as
+// "+hh[:mm[:ss]]".
+func appendZoneText(buf []byte, off int) []byte {
+	sign := byte('+')
+	if off < 0 {
+		sign, off = '-', -off
+	}
+	buf = fmt.Appendf(buf, "%c%02d", sign, off/3600)
+	if off%3600 != 0 {
+		buf = fmt.Appendf(buf, ":%02d", off/60%60)
+		if off%60 != 0 {
+			buf = fmt.Appendf(buf, ":%02d", off%60)
+		}
+	}
+	return buf
+}
+
+// appendIntervalText formats a binary interval like interval_out with
+// IntervalStyle=postgres.
+func appendIntervalText(buf []byte, s []byte) ([]byte, error) {
+	if len(s) != 16 {
+		return nil, binaryLenErr(oid.T_interval, s)
+	}
+	var (
+		us     = int64(binary.BigEndian.Uint64(s))
+		days   = int64(int32(binary.BigEndian.Uint32(s[8:])))
+		months = int64(int32(binary.BigEndian.Uint32(s[12:])))
+	)
+	switch {
+	case us == math.MinInt64 && days == math.MinInt32 && months == math.MinInt32:
+		return append(buf, "-infinity"...), nil
+	case us == math.MaxInt64 && days == math.MaxInt32 && months == math.MaxInt32:
+		return append(buf, "infinity"...), nil
+	}
+
+	isZero, isBefore := true, false
+	part := func(v int64, unit string) {
+		if v == 0 {
+			return
+		}
+		if !isZero {
+			buf = append(buf, ' ')
+		}
+		if isBefore && v > 0 {
+			buf = append(buf, '+')
+		}
+		buf = strconv.AppendInt(buf, v, 10)
+		buf = append(buf, ' ')
+		buf = append(buf, unit...)
+		if v != 1 {
+			buf = append(buf, 's')
+		}
+		// Each non-zero part sets isBefore for only the next one.
+		isBefore, isZero = v < 0, false
+	}
+	part(months/12, "year")
+	part(months%12, "mon")
+	part(days, "day")
+
+	const usPerHour, usPerMinute, usPerSecond = 3600_000_000, 60_000_000, 1_000_000
+	var (
+		hour = us / usPerHour
+		min  = us % usPerHour / usPerMinute
+		sec  = us % usPerMinute / usPerSecond
+		fsec = us % usPerSecond
+	)
+	if isZero || us != 0 {
+		if !isZero {
+			buf = append(buf, ' ')
+		}
+		if us < 0 {
+			buf = append(buf, '-')
+			hour, min, sec, fsec = -hour, -min, -sec, -fsec
+		} else if isBefore {
+			buf = append(buf, '+')
+		}
+		buf = appendTimeText(buf, hour, int(min), int(sec), int(fsec))
+	}
+	return buf, nil
+}
+
+// appendInetText formats a binary inet or cidr like PostgreSQL.
+func appendInetText(buf []byte, s []byte) ([]byte, error) {
+	if len(s) < 4 {
+		return nil, binaryLenErr(oid.T_inet, s)
+	}
+	var (
+		family, bits, isCIDR, n = s[0], int(s[1]), s[2] != 0, int(s[3])
+		addr                    = s[4:]
+		maxBits                 int
+	)
+	switch {
+	case family == 2 && n == 4 && len(addr) == 4: // PGSQL_AF_INET
+		maxBits = 32
+		buf = fmt.Appendf(buf, "%d.%d.%d.%d", addr[0], addr[1], addr[2], addr[3])
+	case family == 3 && n == 16 && len(addr) == 16: // PGSQL_AF_INET6
+		maxBits = 128
+		buf = appendIPv6Text(buf, addr)
+	default:
+		return nil, fmt.Errorf("pq: unable to decode inet; bad address family %d or length %d", family, n)
+	}
+	if isCIDR || bits != maxBits {
+		buf = append(buf, '/')
+		buf = strconv.AppendInt(buf, int64(bits), 10)
+	}
+	return buf, nil
+}
+
+// appendIPv6Text formats an IPv6 address like inet_ntop: the longest run of at
+// least two zero groups is replaced with "::", and IPv4-compatible and mapped
+// addresses end with the IPv4 address.
+func appendIPv6Text(buf []byte, addr []byte) []byte {
+	var words [8]uint16
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(addr[i*2:])
+	}
+	bestBase, bestLen, curBase, curLen := -1, 0, -1, 0
+	for i, w := range words {
+		if w == 0 {
+			if curBase == -1 {
+				curBase, curLen = i, 1
+			} else {
+				curLen++
+			}
+			if curLen > bestLen {
+				bestBase, bestLen = curBase, curLen
+			}
+		} else {
+			curBase = -1
+		}
+	}
+	if bestLen < 2 {
+		bestBase = -1
+	}
+
+	for i := 0; i < len(words); i++ {
+		if bestBase != -1 && i >= bestBase && i < bestBase+bestLen {
+			if i == bestBase {
+				buf = append(buf, ':')
+			}
+			continue
+		}
+		if i != 0 {
+			buf = append(buf, ':')
+		}
+		if i == 6 && bestBase == 0 && (bestLen == 6 || (bestLen == 5 && words[5] == 0xffff)) {
+			return fmt.Appendf(buf, "%d.%d.%d.%d", addr[12], addr[13], addr[14], addr[15])
+		}
+		buf = strconv.AppendUint(buf, uint64(words[i]), 16)
+	}
+	if bestBase != -1 && bestBase+bestLen == len(words) {
+		buf = append(buf, ':')
+	}
+	return buf
+}
+
+// arrayElems are the array types appendArrayText supports, and their element
+// type.
+var arrayElems = map[oid.Oid]oid.Oid{
+	oid.T__bool: oid.T_bool, oid.T__int2: oid.T_int2, oid.T__int4: oid.T_int4,
+	oid.T__int8: oid.T_int8, oid.T__float4: oid.T_float4,
+	oid.T__float8: oid.T_float8, oid.T__numeric: oid.T_numeric,
+	oid.T__date: oid.T_date, oid.T__time: oid.T_time, oid.T__timetz: oid.T_timetz,
+	oid.T__timestamp: oid.T_timestamp, oid.T__timestamptz: oid.T_timestamptz,
+	oid.T__interval: oid.T_interval, oid.T__text: oid.T_text,
+	oid.T__varchar: oid.T_varchar, oid.T__bpchar: oid.T_bpchar,
+	oid.T__name: oid.T_name, oid.T__oid: oid.T_oid, oid.T__json: oid.T_json,
+	oid.T__jsonb: oid.T_jsonb, oid.T__inet: oid.T_inet, oid.T__cidr: oid.T_cidr,
+	oid.T__uuid: oid.T_uuid, oid.T__pg_lsn: oid.T_pg_lsn,
+}
+
+// appendArrayText formats a binary array like array_out.
+func appendArrayText(buf []byte, ps *parameterStatus, s []byte) ([]byte, error) {
+	errShort := fmt.Errorf("pq: unable to decode array; bad length: %d", len(s))
+	if len(s) < 12 {
+		return nil, errShort
+	}
+	var (
+		ndim = int(int32(binary.BigEndian.Uint32(s)))
+		elem = oid.Oid(binary.BigEndian.Uint32(s[8:]))
+	)
+	s = s[12:]
+	if ndim == 0 {
+		return append(buf, "{}"...), nil
+	}
+	if ndim < 0 || ndim > 6 || len(s) < ndim*8 { // MAXDIM
+		return nil, errShort
+	}
+	dims := make([]int, ndim)
+	custom := false
+	for i := range dims {
+		dims[i] = int(int32(binary.BigEndian.Uint32(s[i*8:])))
+		if lbound := int32(binary.BigEndian.Uint32(s[i*8+4:])); lbound != 1 {
+			custom = true
+		}
+		if dims[i] < 0 {
+			return nil, errShort
+		}
+	}
+	if custom {
+		for i := range dims {
+			lbound := int(int32(binary.BigEndian.Uint32(s[i*8+4:])))
+			buf = fmt.Appendf(buf, "[%d:%d]", lbound, lbound+dims[i]-1)
+		}
+		buf = append(buf, '=')
+	}
+	s = s[ndim*8:]
+
+	var (
+		appendDim func(buf []byte, d int) ([]byte, error)
+		elemBuf   []byte
+	)
+	appendDim = func(buf []byte, d int) ([]byte, error) {
+		buf = append(buf, '{')
+		for i := 0; i < dims[d]; i++ {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			if d < ndim-1 {
+				var err error
+				if buf, err = appendDim(buf, d+1); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			if len(s) < 4 {
+				return nil, errShort
+			}
+			l := int(int32(binary.BigEndian.Uint32(s)))
+			s = s[4:]
+			if l < 0 {
+				buf = append(buf, "NULL"...)
+				continue
+			}
+			if len(s) < l {
+				return nil, errShort
+			}
+			var err error
+			elemBuf, err = appendBinaryText(elemBuf[:0], ps, s[:l], elem)
+			if err != nil {
+				return nil, err
+			}
+			s = s[l:]
+			buf = appendArrayQuotedText(buf, elemBuf)
+		}
+		return append(buf, '}'), nil
+	}
+	return appendDim(buf, 0)
+}
+
+// appendArrayQuotedText appends an array element, quoted if needed.
+func appendArrayQuotedText(buf []byte, v []byte) []byte {
+	quote := len(v) == 0 || strings.EqualFold(string(v), "NULL")
+	for _, c := range v {
+		switch c {
+		case '{', '}', ',', '"', '\\', ' ', '\t', '\n', '\r', '\v', '\f':
+			quote = true
+		}
+	}
+	if !quote {
+		return append(buf, v...)
+	}
+	buf = append(buf, '"')
+	for _, c := range v {
+		if c == '"' || c == '\\' {
+			buf = append(buf, '\\')
+		}
+		buf = append(buf, c)
+	}
+	return append(buf, '"')
+}
@@ -0,0 +1,243 @@
+package pq
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq/internal/pqtest"
+	"github.com/lib/pq/internal/pqtime"
+	"github.com/lib/pq/oid"
+)
+
+func TestBinaryDecode(t *testing.T) {
+	ams, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skip(err)
+	}
+	var (
+		ps    = &parameterStatus{currentLocation: ams}
+		be32  = func(n int32) string { return hex.EncodeToString(binary.BigEndian.AppendUint32(nil, uint32(n))) }
+		be64  = func(n int64) string { return hex.EncodeToString(binary.BigEndian.AppendUint64(nil, uint64(n))) }
+		hour  = int64(time.Hour / time.Microsecond)
+		zero  = pqtime.Location(0)
+		array = func(elem oid.Oid, lbound int32, vals ...string) string {
+			s := be32(1) + be32(0) + be32(int32(elem)) + be32(int32(len(vals))) + be32(lbound)
+			for _, v := range vals {
+				if v == "NULL" {
+					s += be32(-1)
+					continue
+				}
+				s += be32(int32(len(v)/2)) + v
+			}
+			return s
+		}
+	)
+	tests := []struct {
+		typ     oid.Oid
+		in      string // hex
+		want    any
+		wantErr string
+	}{
+		{oid.T_bool, "01", true, ""},
+		{oid.T_bool, "00", false, ""},
+		{oid.T_bool, "", nil, "pq: unable to decode bool; bad length: 0"},
+		{oid.T_float4, "3f8ccccd", 1.1, ""},
+		{oid.T_float8, "3ff199999999999a", 1.1, ""},
+		{oid.T_text, hex.EncodeToString([]byte("hé")), "hé", ""},
+		{oid.T_bpchar, "61202020", "a   ", ""},
+		{oid.T_name, "6e616d65", []byte("name"), ""},
+		{oid.T_oid, be32(-1), []byte("4294967295"), ""},
+		{oid.T_json, "7b7d", []byte("{}"), ""},
+		{oid.T_jsonb, "017b7d", []byte("{}"), ""},
+		{oid.T_jsonb, "027b7d", nil, "pq: unsupported jsonb version"},
+
+		{oid.T_date, be32(0), time.Date(2000, 1, 1, 0, 0, 0, 0, zero), ""},
+		{oid.T_date, be32(-1), time.Date(1999, 12, 31, 0, 0, 0, 0, zero), ""},
+		{oid.T_date, be32(math.MaxInt32), []byte("infinity"), ""},
+		{oid.T_timestamp, be64(hour + 1), time.Date(2000, 1, 1, 1, 0, 0, 1000, zero), ""},
+		{oid.T_timestamp, be64(math.MinInt64), []byte("-infinity"), ""},
+		{oid.T_timestamptz, be64(-hour), time.Date(2000, 1, 1, 0, 0, 0, 0, ams), ""},
+		{oid.T_time, be64(13*hour + 1_500_000), time.Date(0, 1, 1, 13, 0, 1, 500_000_000, time.UTC), ""},
+		{oid.T_time, be64(24 * hour), time.Date(0, 1, 2, 0, 0, 0, 0, time.UTC), ""},
+		{oid.T_timetz, be64(12*hour) + be32(-19800), mustParseTime(t, oid.T_timetz, "12:00:00+05:30"), ""},
+		{oid.T_timetz, be64(12*hour) + be32(0), mustParseTime(t, oid.T_timetz, "12:00:00+00"), ""},
+
+		{oid.T_interval, be64(0) + be32(0) + be32(0), []byte("00:00:00"), ""},
+		{oid.T_interval, be64(hour+2*60_000_000+3_500_000) + be32(-1) + be32(14), []byte("1 year 2 mons -1 days +01:02:03.5"), ""},
+		{oid.T_interval, be64(-hour) + be32(1) + be32(-1), []byte("-1 mons +1 day -01:00:00"), ""},
+		{oid.T_interval, be64(0) + be32(1) + be32(12), []byte("1 year 1 day"), ""},
+		{oid.T_interval, be64(1000*hour) + be32(0) + be32(0), []byte("1000:00:00"), ""},
+		{oid.T_interval, be64(math.MaxInt64) + be32(math.MaxInt32) + be32(math.MaxInt32), []byte("infinity"), ""},
+
+		{oid.T_inet, "02200004c0a80001", []byte("192.168.0.1"), ""},
+		{oid.T_inet, "02180004c0a80001", []byte("192.168.0.1/24"), ""},
+		{oid.T_cidr, "020801040a000000", []byte("10.0.0.0/8"), ""},
+		{oid.T_cidr, "022001040a000001", []byte("10.0.0.1/32"), ""},
+		{oid.T_inet, "03800010" + "20010db8000000000000000000000001", []byte("2001:db8::1"), ""},
+		{oid.T_inet, "03800010" + "00000000000000000000000000000001", []byte("::1"), ""},
+		{oid.T_inet, "03800010" + "00000000000000000000000000000000", []byte("::"), ""},
+		{oid.T_inet, "03800010" + "00010000000000000000000000000000", []byte("1::"), ""},
+		{oid.T_inet, "03800010" + "00010000000100000000000000000001", []byte("1:0:1::1"), ""},
+		{oid.T_inet, "03800010" + "00000000000000000000ffff01020304", []byte("::ffff:1.2.3.4"), ""},
+		{oid.T_inet, "03800010" + "00000000000000000000000001020304", []byte("::1.2.3.4"), ""},
+		{oid.T_cidr, "03400110" + "20010db8000000000000000000000000", []byte("2001:db8::/64"), ""},
+		{oid.T_inet, "0320", nil, "pq: unable to decode inet; bad length: 2"},
+
+		{oid.T__int4, array(oid.T_int4, 1, be32(1), "NULL", be32(-3)), []byte("{1,NULL,-3}"), ""},
+		{oid.T__int4, array(oid.T_int4, 0, be32(1), be32(2)), []byte("[0:1]={1,2}"), ""},
+		{oid.T__int4, be32(0) + be32(0) + be32(int32(oid.T_int4)), []byte("{}"), ""},
+		{oid.T__int4, be32(2) + be32(0) + be32(int32(oid.T_int4)) + be32(2) + be32(1) + be32(2) + be32(1) +
+			be32(4) + be32(1) + be32(4) + be32(2) + be32(4) + be32(3) + be32(4) + be32(4), []byte("{{1,2},{3,4}}"), ""},
+		{oid.T__text, array(oid.T_text, 1, "61", "6120622c", "", "6e756c6c", "225c", "NULL"), []byte(`{a,"a b,","","null","\"\\",NULL}`), ""},
+		{oid.T__float8, array(oid.T_float8, 1, "412e848000000000", "430c6bf526340000", "3eee9e50b87f37ef", "8000000000000000", "7ff8000000000000"),
+			[]byte("{1000000,1e+15,1.46e-05,-0,NaN}"), ""},
+		{oid.T__float4, array(oid.T_float4, 1, "49742400", "47f12000"), []byte("{1e+06,123456}"), ""},
+		{oid.T__timestamptz, array(oid.T_timestamptz, 1, be64(-hour), be64(181*24*hour)), []byte(`{"2000-01-01 00:00:00+01","2000-06-30 02:00:00+02"}`), ""},
+		{oid.T__timestamp, array(oid.T_timestamp, 1, be64(500_000)), []byte(`{"2000-01-01 00:00:00.5"}`), ""},
+		{oid.T__date, array(oid.T_date, 1, be32(-746117), be32(math.MinInt32)), []byte(`{"0044-03-15 BC",-infinity}`), ""},
+		{oid.T__time, array(oid.T_time, 1, be64(hour+1)), []byte(`{01:00:00.000001}`), ""},
+		{oid.T__timetz, array(oid.T_timetz, 1, be64(hour)+be32(-3600)), []byte(`{01:00:00+01}`), ""},
+		{oid.T__interval, array(oid.T_interval, 1, be64(0)+be32(2)+be32(0)), []byte(`{"2 days"}`), ""},
+		{oid.T__bool, array(oid.T_bool, 1, "01", "00"), []byte(`{t,f}`), ""},
+		{oid.T__uuid, array(oid.T_uuid, 1, "03a3522f8928498784d6937b36ec276f"), []byte(`{03a3522f-8928-4987-84d6-937b36ec276f}`), ""},
+		{oid.T__int4, array(oid.T_int4, 1, be32(1))[:40], nil, "pq: unable to decode array; bad length"},
+		{oid.T__int4, array(oid.T_bytea, 1, "00"), nil, "pq: don't know how to decode binary parameter of type 17"},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			in, err := hex.DecodeString(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			have, err := decode(ps, in, tt.typ, formatBinary)
+			if !pqtest.ErrorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error:\nhave: %s\nwant: %s", err, tt.wantErr)
+			}
+			if tt.wantErr != "" {
+				return
+			}
+			if h, ok := have.(time.Time); ok {
+				w := tt.want.(time.Time)
+				if h.String() != w.String() || h.Location().String() != w.Location().String() {
+					t.Errorf("\nhave: %s (%s)\nwant: %s (%s)", h, h.Location(), w, w.Location())
+				}
+				return
+			}
+			if !reflect.DeepEqual(have, tt.want) {
+				if b, ok := have.([]byte); ok {
+					have = string(b)
+				}
+				if b, ok := tt.want.([]byte); ok {
+					tt.want = string(b)
+				}
+				t.Errorf("\nhave: %#v\nwant: %#v", have, tt.want)
+			}
+		})
+	}
+}
+
+func mustParseTime(t *testing.T, typ oid.Oid, s string) time.Time {
+	t.Helper()
+	tm, err := parseTime(typ, []byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tm
+}
+
+func TestBinaryDecodeNumeric(t *testing.T) {
+	for _, s := range []string{"0", "1", "-1", "10000", "-12345.678", "0.0001", "0.00000001",
+		"123456789.000100", "99999999999999999999.99", "NaN", "Infinity", "-Infinity"} {
+		t.Run(s, func(t *testing.T) {
+			b, err := appendBinaryNumeric(nil, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			have, err := decode(nil, b, oid.T_numeric, formatBinary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(have.([]byte)) != s {
+				t.Errorf("\nhave: %s\nwant: %s", have, s)
+			}
+		})
+	}
+}
+
+// The binary format must give the same result as the text format.
+func TestBinaryDecodeQuery(t *testing.T) {
+	pqtest.SkipCockroach(t)
+	t.Parallel()
+	db := pqtest.MustDB(t, "timezone=Europe/Amsterdam")
+
+	queries := []string{
+		`true, false`,
+		`1.1::float4, 1e6::float4, 1.1::float8, 1e15::float8, 'NaN'::float8, '-Infinity'::float4`,
+		`0::numeric, -12345.678::numeric, 0.00000001::numeric, 'NaN'::numeric, 123456789.000100::numeric`,
+		`'2000-01-01'::date, '0044-03-15 BC'::date, 'infinity'::date`,
+		`'12:00:01.5'::time, '24:00'::time, '12:00+05:30'::timetz`,
+		`'2000-01-01 12:00:00.000001'::timestamp, '-infinity'::timestamp`,
+		`'2000-01-01 12:00:00+03'::timestamptz, '2000-07-01 12:00:00+03'::timestamptz`,
+		`'1 year 2 mons -1 days +01:02:03.5'::interval, '-1 hour'::interval, '0'::interval`,
+		`'text'::text, 'varchar'::varchar, 'bpchar'::char(8), 'name'::name, 1::oid`,
+		`'{"a": 1}'::json, '{"a": 1}'::jsonb`,
+		`'192.168.0.1'::inet, '192.168.0.1/24'::inet, '10.0.0.0/8'::cidr, '2001:db8::1'::inet, '::ffff:1.2.3.4'::inet`,
+		`'{1,NULL,3}'::int[], '[0:1]={1,2}'::int[], '{{1,2},{3,4}}'::int8[], '{}'::int2[]`,
+		`'{a,"a b",NULL,"null","\""}'::text[], '{"x y"}'::varchar[], '{a}'::name[]`,
+		`'{1.5,1e20,NaN}'::float8[], '{1.5}'::float4[], '{1.5,-2}'::numeric[], '{t,f}'::bool[]`,
+		`'{2000-01-01 12:00,infinity}'::timestamptz[], '{2000-01-01}'::timestamp[], '{2000-01-01}'::date[]`,
+		`'{12:00,12:00+01}'::timetz[], '{12:00}'::time[], '{1 day,-1 hour}'::interval[]`,
+		`'{192.168.0.1/24}'::inet[], '{10.0.0.0/8}'::cidr[], '{1}'::oid[]`,
+		`'{"{}"}'::json[], '{"{}"}'::jsonb[], '{03a3522f-8928-4987-84d6-937b36ec276f}'::uuid[], '{16/B374D848}'::pg_lsn[]`,
+	}
+	for _, q := range queries {
+		t.Run("", func(t *testing.T) {
+			// Text format: simple query protocol; binary: prepared statement.
+			text := queryValues(t, db, `select `+q)
+			bin := queryValues(t, db, `select `+q+` where $1`, true)
+			for i := range text {
+				if h, ok := bin[i].(time.Time); ok {
+					if w, ok := text[i].(time.Time); !ok || !h.Equal(w) || h.Location().String() != w.Location().String() {
+						t.Errorf("column %d\nbinary: %s\ntext:   %s", i, bin[i], text[i])
+					}
+					continue
+				}
+				if !reflect.DeepEqual(bin[i], text[i]) {
+					t.Errorf("column %d\nbinary: %s\ntext:   %s", i, bin[i], text[i])
+				}
+			}
+		})
+	}
+}
+
+func queryValues(t *testing.T, db *sql.DB, q string, args ...any) []any {
+	t.Helper()
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	cols, _ := rows.Columns()
+	vals := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range ptrs {
+		ptrs[i] = &vals[i]
+	}
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range vals {
+		if b, ok := v.([]byte); ok {
+			vals[i] = string(b)
+		}
+	}
+	return vals
+}
@@ -18,6 +18,12 @@ func (b *readBuf) int32() (n int) {
 	return
 }
 
+func (b *readBuf) int64() (n int64) {
+	n = int64(binary.BigEndian.Uint64(*b))
+	*b = (*b)[8:]
+	return
+}
+
 func (b *readBuf) oid() (n oid.Oid) {
 	n = oid.Oid(binary.BigEndian.Uint32(*b))
 	*b = (*b)[4:]
@@ -62,6 +68,10 @@ func (b *writeBuf) int32(n int) {
 	b.buf = append(b.buf, x...)
 }
 
+func (b *writeBuf) int64(n int64) {
+	b.buf = binary.BigEndian.AppendUint64(b.buf, uint64(n))
+}
+
 func (b *writeBuf) int16(n int) {
 	x := make([]byte, 2)
 	binary.BigEndian.PutUint16(x, uint16(n))
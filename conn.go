@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/md5"
 	"crypto/sha256"
+	"crypto/tls"
 	"database/sql"
 	"database/sql/driver"
 	"encoding/binary"
@@ -19,6 +20,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lib/pq/internal/pgpass"
@@ -96,6 +98,7 @@ type parameterStatus struct {
 	currentLocation                          *time.Location
 	inHotStandby, defaultTransactionReadOnly sql.NullBool
 	isRedshift                               bool
+	intervalStyle                            string
 }
 
 type format int
@@ -190,6 +193,33 @@ type conn struct {
 	noticeHandler       func(*Error)        // If not nil, notices will be synchronously sent here
 	notificationHandler func(*Notification) // If not nil, notifications will be synchronously sent here
 	gss                 GSS                 // GSSAPI context
+	channelBound        bool                // Authenticated with SCRAM-SHA-256-PLUS.
+	tokenProvider       TokenProvider       // For OAUTHBEARER authentication.
+	sslPassword         SSLPasswordProvider // For encrypted SSL keys if sslpassword isn't set.
+	tracer              Tracer              // Traces queries; may be nil.
+	protoTrace          *protoTrace         // Logs protocol messages; may be nil.
+	txnCtx              context.Context     // Context passed to BeginTx, for tracing.
+	timeoutSession      bool                // statement_timeout set for the session by setStatementTimeout.
+	timeoutLocal        bool                // statement_timeout set for the transaction by setStatementTimeout.
+	timeoutDefault      bool                // statement_timeout set to the default for the transaction by setStatementTimeout.
+	pendingSets         int                 // Responses to read for SET commands from setStatementTimeout.
+	timeoutDone         atomic.Value        // ctx.Done() of the context statement_timeout was last set for; read by watchCancel.
+	oauthScope          *string             // Scope from OAuth discovery; nil if not done.
+	oauthDiscovery      bool                // Sent an empty OAuth token for discovery.
+	stmtCache           *stmtCache          // Prepared statements for queries with parameters; nil if disabled.
+
+	// Set when an Execute with a row limit was sent with Flush instead of
+	// Sync, to fetch the rows in batches. A Sync must be sent before reading
+	// ReadyForQuery.
+	syncPending bool
+
+	// Set while a COPY FROM STDIN or pipeline is in progress; the connection
+	// can't be used for anything else until it's finished, and send() returns
+	// this error.
+	busy error
+
+	// Unfinished COPY FROM STDIN; set together with busy.
+	copyIn *copyin
 }
 
 type syncErr struct {
@@ -251,17 +281,29 @@ func DialOpen(d Dialer, dsn string) (_ driver.Conn, err error) {
 	return c.open(context.Background())
 }
 
+// asConn gets the pq connection from c, for functions that operate on a
+// connection retrieved with [sql.Conn.Raw].
+func asConn(c driver.Conn) (*conn, error) {
+	cn, ok := c.(*conn)
+	if !ok {
+		return nil, fmt.Errorf("pq: not a pq connection: %T", c)
+	}
+	return cn, nil
+}
+
 func (c *Connector) open(ctx context.Context) (*conn, error) {
 	tsa := c.cfg.TargetSessionAttrs
 restartAll:
 	var (
 		errs []error
+		end  traceEnd // For the current host.
 		app  = func(err error, cfg Config) bool {
 			if err != nil {
 				if debugProto {
 					fmt.Fprintln(os.Stderr, "CONNECT  (error)", err)
 				}
 				errs = append(errs, fmt.Errorf("connecting to %s:%d: %w", cfg.Host, cfg.Port, err))
+				end.done(nil, "", err)
 			}
 			return err != nil
 		}
@@ -271,13 +313,20 @@ restartAll:
 		if mode == "" {
 			mode = SSLModePrefer
 		}
+		gssMode := cfg.GSSEncMode
+		if gssMode == "" {
+			gssMode = GSSEncModePrefer
+		}
+		var oauthScope *string
+		end = trace(ctx, c.tracer, traceConnect, TraceData{Host: cfg.Host, Port: cfg.Port})
 	restartHost:
 		if debugProto {
 			fmt.Fprintln(os.Stderr, "CONNECT ", cfg.string())
 		}
 
 		cfg.SSLMode = mode
-		cn := &conn{cfg: cfg, dialer: c.dialer}
+		cn := &conn{cfg: cfg, dialer: c.dialer, stmtCache: newStmtCache(cfg.StatementCacheCapacity),
+			tokenProvider: c.tokenProvider, sslPassword: c.sslPassword, tracer: c.tracer, protoTrace: c.protoTrace, oauthScope: oauthScope}
 		cn.cfg.Password = pgpass.PasswordFromPgpass(cn.cfg.Passfile, cn.cfg.User, cn.cfg.Password,
 			cn.cfg.Host, strconv.Itoa(int(cn.cfg.Port)), cn.cfg.Database)
 
@@ -287,7 +336,34 @@ restartAll:
 			continue
 		}
 
-		err = cn.ssl(cn.cfg, mode)
+		gss, err := gssEncrypter(cn.cfg, gssMode)
+		if app(err, cfg) {
+			_ = cn.c.Close()
+			continue
+		}
+		if gss != nil {
+			err = cn.gssenc(cn.cfg, gss)
+			if err != nil && gssMode == GSSEncModePrefer {
+				// Continue on the same connection if the server rejected the
+				// request, and reconnect without GSSAPI encryption otherwise.
+				gssMode = GSSEncModeDisable
+				if !errors.Is(err, errGSSEncNotSupported) || cfg.SSLNegotiation == SSLNegotiationDirect {
+					_ = cn.c.Close()
+					goto restartHost
+				}
+				err = nil
+			}
+			if app(err, cfg) {
+				_ = cn.c.Close()
+				continue
+			}
+		}
+		if _, ok := cn.c.(*gssConn); ok {
+			// Don't use SSL on top of GSSAPI encryption.
+			err = nil
+		} else {
+			err = cn.ssl(ctx, cn.cfg, mode)
+		}
 		if err != nil && mode == SSLModePrefer {
 			mode = SSLModeDisable
 			goto restartHost
@@ -300,7 +376,13 @@ restartAll:
 		}
 
 		cn.buf = bufio.NewReader(cn.c)
-		err = cn.startup(cn.cfg)
+		err = cn.startup(ctx, cn.cfg)
+		if oerr := (*OAuthError)(nil); cn.oauthDiscovery && errors.As(err, &oerr) {
+			// Connect again with the scope the server asked for.
+			_ = cn.c.Close()
+			oauthScope = &oerr.Scope
+			goto restartHost
+		}
 		if err != nil && mode == SSLModeAllow {
 			mode = SSLModeRequire
 			goto restartHost
@@ -325,6 +407,7 @@ restartAll:
 			continue
 		}
 
+		end.done(nil, "", nil)
 		return cn, nil
 	}
 
@@ -514,28 +597,44 @@ func (cn *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx,
 		return nil, err
 	}
 
+	end := cn.trace(ctx, traceTx, TraceData{SQL: "BEGIN" + mode})
+	commandTag, err := cn.begin(mode)
+	end.done(nil, commandTag, err)
+	if err != nil {
+		return nil, err
+	}
+
+	cn.txnCtx = ctx
+	cn.txnFinish = cn.watchCancel(ctx, false)
+	return cn, nil
+}
+
+func (cn *conn) begin(mode string) (string, error) {
+	// The ctx passed to BeginTx is for the entire transaction, not for BEGIN.
+	if err := cn.setStatementTimeout(context.Background()); err != nil {
+		return "", cn.handleError(err)
+	}
 	_, commandTag, err := cn.simpleExec("BEGIN" + mode)
 	if err != nil {
-		return nil, cn.handleError(err)
+		return commandTag, cn.handleError(err)
 	}
 	if commandTag != "BEGIN" {
 		cn.err.set(driver.ErrBadConn)
-		return nil, fmt.Errorf("unexpected command tag %s", commandTag)
+		return commandTag, fmt.Errorf("unexpected command tag %s", commandTag)
 	}
 	if cn.txnStatus != txnStatusIdleInTransaction {
 		cn.err.set(driver.ErrBadConn)
-		return nil, fmt.Errorf("unexpected transaction status %v", cn.txnStatus)
+		return commandTag, fmt.Errorf("unexpected transaction status %v", cn.txnStatus)
 	}
-
-	cn.txnFinish = cn.watchCancel(ctx, false)
-	return cn, nil
+	return commandTag, nil
 }
 
-func (cn *conn) Commit() error {
+func (cn *conn) Commit() (err error) {
 	defer func() {
 		if cn.txnFinish != nil {
 			cn.txnFinish()
 		}
+		cn.txnCtx = nil
 	}()
 	if err := cn.err.get(); err != nil {
 		return err
@@ -543,6 +642,10 @@ func (cn *conn) Commit() error {
 	if err := cn.checkIsInTransaction(true); err != nil {
 		return err
 	}
+	if cn.tracer != nil {
+		end := cn.trace(cn.txnCtx, traceTx, TraceData{SQL: "COMMIT"})
+		defer func() { end.done(nil, "COMMIT", err) }()
+	}
 
 	// We don't want the client to think that everything is okay if it tries
 	// to commit a failed transaction.  However, no matter what we return,
@@ -557,6 +660,9 @@ func (cn *conn) Commit() error {
 		return ErrInFailedTransaction
 	}
 
+	if err := cn.setStatementTimeout(context.Background()); err != nil {
+		return cn.handleError(err)
+	}
 	_, commandTag, err := cn.simpleExec("COMMIT")
 	if err != nil {
 		if cn.isInTransaction() {
@@ -576,13 +682,16 @@ func (cn *conn) Rollback() error {
 		if cn.txnFinish != nil {
 			cn.txnFinish()
 		}
+		cn.txnCtx = nil
 	}()
 	if err := cn.err.get(); err != nil {
 		return err
 	}
 
-	err := cn.rollback()
-	return cn.handleError(err)
+	end := cn.trace(cn.txnCtx, traceTx, TraceData{SQL: "ROLLBACK"})
+	err := cn.handleError(cn.rollback())
+	end.done(nil, "ROLLBACK", err)
+	return err
 }
 
 func (cn *conn) rollback() (err error) {
@@ -702,7 +811,7 @@ func (cn *conn) simpleQuery(q string) (*rows, error) {
 		case proto.ReadyForQuery:
 			cn.processReadyForQuery(r)
 			if err == nil && res == nil {
-				res = &rows{done: true}
+				res = &rows{cn: cn, done: true}
 			}
 			return res, cn.handleError(resErr, q) // done
 		case proto.ErrorResponse:
@@ -730,7 +839,7 @@ func (cn *conn) simpleQuery(q string) (*rows, error) {
 
 // Decides which column formats to use for a prepared statement.  The input is
 // an array of type oids, one element per result column.
-func decideColumnFormats(colTyps []fieldDesc, forceText bool) (colFmts []format, colFmtData []byte, _ error) {
+func decideColumnFormats(ps *parameterStatus, colTyps []fieldDesc, forceText bool) (colFmts []format, colFmtData []byte, _ error) {
 	if len(colTyps) == 0 {
 		return nil, colFmtDataAllText, nil
 	}
@@ -743,22 +852,27 @@ func decideColumnFormats(colTyps []fieldDesc, forceText bool) (colFmts []format,
 	allBinary := true
 	allText := true
 	for i, t := range colTyps {
+		var useBinary bool
 		switch t.OID {
 		// This is the list of types to use binary mode for when receiving them
 		// through a prepared statement.  If a type appears in this list, it
 		// must also be implemented in binaryDecode in encode.go.
-		case oid.T_bytea:
-			fallthrough
-		case oid.T_int8:
-			fallthrough
-		case oid.T_int4:
-			fallthrough
-		case oid.T_int2:
-			fallthrough
-		case oid.T_uuid:
+		case oid.T_bytea, oid.T_int8, oid.T_int4, oid.T_int2, oid.T_uuid, oid.T_pg_lsn:
+			useBinary = true
+		case oid.T_timestamptz, oid.T__timestamptz:
+			// Need the session's time zone to return the same time as the text
+			// format.
+			useBinary = !ps.isRedshift && ps.currentLocation != nil
+		case oid.T_interval, oid.T__interval:
+			// Intervals are formatted in the default style by binaryDecode.
+			useBinary = !ps.isRedshift && (ps.intervalStyle == "" || ps.intervalStyle == "postgres")
+		default:
+			useBinary = !ps.isRedshift && binaryTypes[t.OID]
+		}
+		if useBinary {
 			colFmts[i] = formatBinary
 			allText = false
-		default:
+		} else {
 			allBinary = false
 		}
 	}
@@ -786,7 +900,7 @@ func (cn *conn) prepareTo(q, stmtName string) (*stmt, error) {
 		defer fmt.Fprintln(os.Stderr, "         END conn.prepareTo")
 	}
 
-	st := &stmt{cn: cn, name: stmtName}
+	st := &stmt{cn: cn, name: stmtName, query: q}
 
 	b := cn.writeBuf(proto.Parse)
 	b.string(st.name)
@@ -811,7 +925,7 @@ func (cn *conn) prepareTo(q, stmtName string) (*stmt, error) {
 	if err != nil {
 		return nil, err
 	}
-	st.colFmts, st.colFmtData, err = decideColumnFormats(st.colTyps, cn.cfg.DisablePreparedBinaryResult)
+	st.colFmts, st.colFmtData, err = decideColumnFormats(&cn.parameterStatus, st.colTyps, cn.cfg.DisablePreparedBinaryResult)
 	if err != nil {
 		return nil, err
 	}
@@ -823,21 +937,89 @@ func (cn *conn) prepareTo(q, stmtName string) (*stmt, error) {
 	return st, nil
 }
 
+// execCached binds and executes q with a statement from the statement cache,
+// preparing it first if it's not in the cache. A cached statement that became
+// invalid is prepared again, and retried if this is safe to do outside of a
+// transaction.
+func (cn *conn) execCached(q string, args []driver.NamedValue, fetch int) (*stmt, error) {
+	st, err := cn.prepareCached(q)
+	if err != nil {
+		return nil, err
+	}
+	err = st.exec(args, fetch)
+	if err == nil || !cn.stmtCache.invalidates(err) {
+		return st, err
+	}
+
+	cn.stmtCache.remove(q)
+	if cerr := st.Close(); cerr != nil {
+		return nil, cerr
+	}
+	if cn.txnStatus != txnStatusIdle {
+		return nil, err
+	}
+	st, err = cn.prepareCached(q)
+	if err != nil {
+		return nil, err
+	}
+	return st, st.exec(args, fetch)
+}
+
+// prepareCached gets the prepared statement for q from the statement cache, or
+// prepares and caches it if it's not cached yet.
+func (cn *conn) prepareCached(q string) (*stmt, error) {
+	if st := cn.stmtCache.get(q); st != nil {
+		return st, nil
+	}
+	if st := cn.stmtCache.evict(); st != nil {
+		if err := st.Close(); err != nil {
+			return nil, err
+		}
+	}
+	st, err := cn.prepareTo(q, cn.gname())
+	if err != nil {
+		return nil, err
+	}
+	cn.stmtCache.put(q, st)
+	return st, nil
+}
+
 // Implement [driver.ConnPrepareContext].
 func (cn *conn) PrepareContext(ctx context.Context, q string) (driver.Stmt, error) {
 	defer cn.watchCancel(ctx, false)()
 	if err := cn.err.get(); err != nil {
 		return nil, err
 	}
+	if err := cn.setStatementTimeout(ctx); err != nil {
+		return nil, cn.handleError(err)
+	}
 
 	if pqsql.StartsWithCopy(q) {
+		end := cn.trace(ctx, traceCopy, TraceData{SQL: q})
 		s, err := cn.prepareCopyIn(q)
-		return s, cn.handleError(err, q)
+		if err != nil {
+			err = cn.handleError(err, q)
+			end.done(nil, "", err)
+			return nil, err
+		}
+		if ci, ok := s.(*copyin); ok {
+			ci.trace = end
+		}
+		return s, nil
 	}
+	var names []string
+	if cn.cfg.NamedPlaceholders {
+		q, names = pqsql.Named(q)
+	}
+	end := cn.trace(ctx, tracePrepare, TraceData{SQL: q})
 	s, err := cn.prepareTo(q, cn.gname())
 	if err != nil {
-		return nil, cn.handleError(err, q)
+		err = cn.handleError(err, q)
+		end.done(nil, "", err)
+		return nil, err
 	}
+	end.done(nil, "", nil)
+	s.names = names
 	return s, nil
 }
 
@@ -852,6 +1034,57 @@ func (cn *conn) Close() error {
 	return cn.c.Close()
 }
 
+// bindNamed rewrites @name and :name placeholders in the query to $n if any of
+// the arguments have a name (from [sql.Named]), and orders the arguments to
+// match. Queries with $n placeholders are never rewritten, and the arguments
+// are used in order.
+func bindNamed(query string, args []driver.NamedValue) (string, []driver.NamedValue, error) {
+	if !slices.ContainsFunc(args, func(nv driver.NamedValue) bool { return nv.Name != "" }) {
+		return query, args, nil
+	}
+	q, names := pqsql.Named(query)
+	if names == nil {
+		return query, args, nil
+	}
+	args, err := orderNamed(names, args)
+	return q, args, err
+}
+
+// orderNamed orders the arguments to match names, which has the name for $1,
+// $2, etc. The arguments are used in order if none of them have a name.
+func orderNamed(names []string, args []driver.NamedValue) ([]driver.NamedValue, error) {
+	var named int
+	for _, a := range args {
+		if a.Name != "" {
+			named++
+		}
+	}
+	if named == 0 {
+		return args, nil
+	}
+	if named != len(args) {
+		return nil, errors.New("pq: can't mix named and positional arguments")
+	}
+	for _, a := range args {
+		if !slices.Contains(names, a.Name) {
+			return nil, fmt.Errorf("pq: named argument %q is not used in the query", a.Name)
+		}
+	}
+	if len(args) != len(names) {
+		return nil, fmt.Errorf("pq: got %d named arguments but the query has %d named parameters", len(args), len(names))
+	}
+
+	ordered := make([]driver.NamedValue, len(names))
+	for i, name := range names {
+		j := slices.IndexFunc(args, func(nv driver.NamedValue) bool { return nv.Name == name })
+		if j == -1 {
+			return nil, fmt.Errorf("pq: no value for named parameter %q", name)
+		}
+		ordered[i] = driver.NamedValue{Name: name, Ordinal: i + 1, Value: args[j].Value}
+	}
+	return ordered, nil
+}
+
 // CheckNamedValue implements [driver.NamedValueChecker].
 func (cn *conn) CheckNamedValue(nv *driver.NamedValue) error {
 	if cn.cfg.BinaryParameters {
@@ -899,21 +1132,48 @@ func (cn *conn) CheckNamedValue(nv *driver.NamedValue) error {
 	}
 }
 
+type fetchSizeKey struct{}
+
+// WithFetchSize returns a context to set the fetch size for queries run with
+// it, overriding the fetch_size connection parameter. A value of 0 fetches all
+// rows at once.
+func WithFetchSize(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, fetchSizeKey{}, n)
+}
+
+// fetchSize gets the number of rows to fetch at a time for a query.
+func (cn *conn) fetchSize(ctx context.Context) int {
+	if n, ok := ctx.Value(fetchSizeKey{}).(int); ok && n >= 0 {
+		return n
+	}
+	return cn.cfg.FetchSize
+}
+
 // Implement [driver.QueryerContext].
 func (cn *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	query, args, err := bindNamed(query, args)
+	if err != nil {
+		return nil, err
+	}
 	finish := cn.watchCancel(ctx, false)
-	r, err := cn.query(query, args)
+	end := cn.trace(ctx, traceQuery, TraceData{SQL: query, Args: len(args)})
+	var r *rows
+	err = cn.handleError(cn.setStatementTimeout(ctx))
+	if err == nil {
+		r, err = cn.query(query, args, cn.fetchSize(ctx))
+	}
 	if err != nil {
+		end.done(nil, "", err)
 		if finish != nil {
 			finish()
 		}
 		return nil, err
 	}
-	r.finish = finish
+	r.finish, r.trace = finish, end
 	return r, nil
 }
 
-func (cn *conn) query(query string, args []driver.NamedValue) (*rows, error) {
+func (cn *conn) query(query string, args []driver.NamedValue, fetch int) (*rows, error) {
 	if debugProto {
 		fmt.Fprintln(os.Stderr, "         START conn.query")
 		defer fmt.Fprintln(os.Stderr, "         END conn.query")
@@ -923,13 +1183,14 @@ func (cn *conn) query(query string, args []driver.NamedValue) (*rows, error) {
 	}
 
 	// Check to see if we can use the "simpleQuery" interface, which is
-	// *much* faster than going through prepare/exec
-	if len(args) == 0 {
+	// *much* faster than going through prepare/exec. The simple query protocol
+	// always returns all rows, so can't be used with a fetch size.
+	if len(args) == 0 && fetch == 0 {
 		return cn.simpleQuery(query)
 	}
 
 	if cn.cfg.BinaryParameters {
-		err := cn.sendBinaryModeQuery(query, args)
+		err := cn.sendBinaryModeQuery(query, args, fetch)
 		if err != nil {
 			return nil, cn.handleError(err, query)
 		}
@@ -942,7 +1203,7 @@ func (cn *conn) query(query string, args []driver.NamedValue) (*rows, error) {
 			return nil, cn.handleError(err, query)
 		}
 
-		rows := &rows{cn: cn}
+		rows := &rows{cn: cn, fetch: fetch}
 		rows.rowsHeader, err = cn.readPortalDescribeResponse()
 		if err != nil {
 			return nil, cn.handleError(err, query)
@@ -954,74 +1215,199 @@ func (cn *conn) query(query string, args []driver.NamedValue) (*rows, error) {
 		return rows, nil
 	}
 
-	st, err := cn.prepareTo(query, "")
-	if err != nil {
-		return nil, cn.handleError(err, query)
+	var (
+		st  *stmt
+		err error
+	)
+	if cn.stmtCache != nil {
+		st, err = cn.execCached(query, args, fetch)
+	} else {
+		st, err = cn.prepareTo(query, "")
+		if err == nil {
+			err = st.exec(args, fetch)
+		}
 	}
-	err = st.exec(args)
 	if err != nil {
 		return nil, cn.handleError(err, query)
 	}
 	return &rows{
 		cn:         cn,
 		rowsHeader: st.rowsHeader,
+		fetch:      fetch,
 	}, nil
 }
 
 // Implement [driver.ExecerContext].
 func (cn *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	query, args, err := bindNamed(query, args)
+	if err != nil {
+		return nil, err
+	}
 	defer cn.watchCancel(ctx, false)()
 	if err := cn.err.get(); err != nil {
 		return nil, err
 	}
+	if err := cn.setStatementTimeout(ctx); err != nil {
+		return nil, cn.handleError(err)
+	}
 
+	end := cn.trace(ctx, traceQuery, TraceData{SQL: query, Args: len(args)})
+	res, commandTag, err := cn.exec(query, args)
+	end.done(res, commandTag, err)
+	return res, err
+}
+
+func (cn *conn) exec(query string, args []driver.NamedValue) (driver.Result, string, error) {
 	// simpleExec is *much* faster than going through prepare/exec.
 	if len(args) == 0 {
-		r, _, err := cn.simpleExec(query) // Ignore commandTag, our caller doesn't care.
-		return r, cn.handleError(err, query)
+		r, commandTag, err := cn.simpleExec(query)
+		return r, commandTag, cn.handleError(err, query)
 	}
 
 	if cn.cfg.BinaryParameters {
-		err := cn.sendBinaryModeQuery(query, args)
+		err := cn.sendBinaryModeQuery(query, args, 0)
 		if err != nil {
-			return nil, cn.handleError(err, query)
+			return nil, "", cn.handleError(err, query)
 		}
 		err = cn.readParseResponse()
 		if err != nil {
-			return nil, cn.handleError(err, query)
+			return nil, "", cn.handleError(err, query)
 		}
 		err = cn.readBindResponse()
 		if err != nil {
-			return nil, cn.handleError(err, query)
+			return nil, "", cn.handleError(err, query)
 		}
 
 		_, err = cn.readPortalDescribeResponse()
 		if err != nil {
-			return nil, cn.handleError(err, query)
+			return nil, "", cn.handleError(err, query)
 		}
 		err = cn.postExecuteWorkaround()
 		if err != nil {
-			return nil, cn.handleError(err, query)
+			return nil, "", cn.handleError(err, query)
 		}
-		res, _, err := cn.readExecuteResponse("Execute")
-		return res, cn.handleError(err, query)
+		res, commandTag, err := cn.readExecuteResponse("Execute")
+		return res, commandTag, cn.handleError(err, query)
+	}
+
+	if cn.stmtCache != nil {
+		_, err := cn.execCached(query, args, 0)
+		if err != nil {
+			return nil, "", cn.handleError(err, query)
+		}
+		res, commandTag, err := cn.readExecuteResponse("Execute")
+		return res, commandTag, cn.handleError(err, query)
 	}
 
 	// Use the unnamed statement to defer planning until bind time, or else
 	// value-based selectivity estimates cannot be used.
 	st, err := cn.prepareTo(query, "")
 	if err != nil {
-		return nil, cn.handleError(err, query)
+		return nil, "", cn.handleError(err, query)
 	}
-	r, err := st.ExecContext(ctx, args)
+	err = st.exec(args, 0)
 	if err != nil {
-		return nil, cn.handleError(err, query)
+		return nil, "", cn.handleError(err, query)
+	}
+	res, commandTag, err := cn.readExecuteResponse("simple query")
+	return res, commandTag, cn.handleError(err, query)
+}
+
+// setStatementTimeout sets statement_timeout to the time left until the
+// deadline of ctx if deadline_statement_timeout is enabled, or resets it if
+// there is no deadline and it was set before. This must be called before
+// sending anything that runs a statement, so a timeout for an earlier query
+// doesn't apply to it. ROLLBACK is the exception, as it discards SET LOCAL
+// and can't be aborted.
+//
+// The SET is sent without waiting for the response, so it's in the same round
+// trip as the query sent after it. recvMessage reads the response before the
+// response to the query.
+func (cn *conn) setStatementTimeout(ctx context.Context) error {
+	if !cn.cfg.DeadlineStatementTimeout || cn.busy != nil {
+		return nil
+	}
+
+	var (
+		q            string
+		deadline, ok = ctx.Deadline()
+		left         = time.Until(deadline)
+		intxn        = cn.isInTransaction()
+	)
+	// statement_timeout is an int in milliseconds, which is about 24.8 days;
+	// deadlines further away are handled with a CancelRequest.
+	if left >= math.MaxInt32*time.Millisecond {
+		ok = false
+	}
+	// watchCancel only relies on the server timeout for this ctx.
+	var done <-chan struct{}
+	defer func() { cn.timeoutDone.Store(done) }()
+	switch {
+	case ok:
+		// Round up, as 0 disables the timeout. If the deadline already passed
+		// the query is aborted right away.
+		ms := max((left+time.Millisecond-1)/time.Millisecond, 1)
+		if intxn {
+			q = fmt.Sprintf("SET LOCAL statement_timeout = %d", ms)
+			cn.timeoutLocal, cn.timeoutDefault = true, false
+		} else {
+			q, cn.timeoutSession = fmt.Sprintf("SET statement_timeout = %d", ms), true
+		}
+		done = ctx.Done()
+	// A session-level RESET in a transaction is undone on rollback, so use SET
+	// LOCAL and reset the session value after the transaction.
+	case intxn && (cn.timeoutLocal || (cn.timeoutSession && !cn.timeoutDefault)):
+		q = "SET LOCAL statement_timeout TO DEFAULT"
+		cn.timeoutLocal, cn.timeoutDefault = false, true
+	case !intxn && cn.timeoutSession:
+		q, cn.timeoutSession = "RESET statement_timeout", false
+	default:
+		return nil
+	}
+
+	b := cn.writeBuf(proto.Query)
+	b.string(q)
+	if err := cn.send(b); err != nil {
+		done = nil
+		return err
+	}
+	cn.pendingSets++
+	return nil
+}
+
+// readSetResponse reads the response to a SET command from
+// setStatementTimeout. Errors from the server are ignored, as they also apply
+// to the query sent after it (e.g. in an aborted transaction).
+func (cn *conn) readSetResponse() error {
+	for {
+		var r readBuf
+		t, err := cn.recvMessage(&r)
+		if err != nil {
+			return err
+		}
+		switch t {
+		case proto.ReadyForQuery:
+			cn.processReadyForQuery(&r)
+			return nil
+		case proto.ParameterStatus:
+			cn.processParameterStatus(&r)
+		case proto.NoticeResponse:
+			if n := cn.noticeHandler; n != nil {
+				n(parseError(&r, ""))
+			}
+		case proto.CommandComplete, proto.ErrorResponse:
+		default:
+			cn.err.set(driver.ErrBadConn)
+			return fmt.Errorf("pq: unexpected message %q in response to SET statement_timeout", t)
+		}
 	}
-	return r, nil
 }
 
 func (cn *conn) Ping(ctx context.Context) error {
 	defer cn.watchCancel(ctx, false)()
+	if err := cn.setStatementTimeout(ctx); err != nil {
+		return driver.ErrBadConn
+	}
 	rows, err := cn.simpleQuery(";")
 	if err != nil {
 		return driver.ErrBadConn
@@ -1035,6 +1421,14 @@ type safeRetryError struct{ Err error }
 func (se *safeRetryError) Error() string { return se.Err.Error() }
 
 func (cn *conn) send(m *writeBuf) error {
+	if cn.busy != nil {
+		return cn.busy
+	}
+	return cn.write(m)
+}
+
+// write is like send, but doesn't check if the connection is busy.
+func (cn *conn) write(m *writeBuf) error {
 	if debugProto {
 		w := m.wrap()
 		for len(w) > 0 { // Can contain multiple messages.
@@ -1044,6 +1438,7 @@ func (cn *conn) send(m *writeBuf) error {
 			w = w[l+5:]
 		}
 	}
+	cn.protoTrace.frontend(m.wrap())
 
 	n, err := cn.c.Write(m.wrap())
 	if err != nil && n == 0 {
@@ -1057,6 +1452,7 @@ func (cn *conn) sendStartupPacket(m *writeBuf) error {
 		w := m.wrap()
 		fmt.Fprintf(os.Stderr, "CLIENT → %-20s %5d  %q\n", "Startup", int(binary.BigEndian.Uint32(w[1:5]))-4, w[5:])
 	}
+	cn.protoTrace.startup(m.wrap()[1:])
 	_, err := cn.c.Write((m.wrap())[1:])
 	return err
 }
@@ -1067,7 +1463,9 @@ func (cn *conn) sendSimpleMessage(typ proto.RequestCode) error {
 	if debugProto {
 		fmt.Fprintf(os.Stderr, "CLIENT → %-20s %5d  %q\n", typ, 0, []byte{})
 	}
-	_, err := cn.c.Write([]byte{byte(typ), '\x00', '\x00', '\x00', '\x04'})
+	msg := []byte{byte(typ), '\x00', '\x00', '\x00', '\x04'}
+	cn.protoTrace.frontend(msg)
+	_, err := cn.c.Write(msg)
 	return err
 }
 
@@ -1098,6 +1496,13 @@ func (cn *conn) recvMessage(r *readBuf) (proto.ResponseCode, error) {
 		return t, nil
 	}
 
+	for cn.pendingSets > 0 {
+		cn.pendingSets--
+		if err := cn.readSetResponse(); err != nil {
+			return 0, err
+		}
+	}
+
 	x := cn.scratch[:5]
 	_, err := io.ReadFull(cn.buf, x)
 	if err != nil {
@@ -1138,6 +1543,7 @@ func (cn *conn) recvMessage(r *readBuf) (proto.ResponseCode, error) {
 	if debugProto {
 		fmt.Fprintf(os.Stderr, "SERVER ← %-20s %5d  %q\n", t, n, y)
 	}
+	cn.protoTrace.backend(t, y)
 	return t, nil
 }
 
@@ -1207,37 +1613,76 @@ func (cn *conn) recv1() (proto.ResponseCode, *readBuf, error) {
 	return t, r, nil
 }
 
+// deadlineGracePeriod is how long to wait for the server to abort a query with
+// deadline_statement_timeout after the deadline passed, if cancel_grace_period
+// is shorter. This needs to cover the round trip to the server.
+const deadlineGracePeriod = time.Second
+
 // We need to let PostgreSQL know the query is cancelled: just dropping the
 // connection won't stop the query.
 //
 // So create a goroutine which selects on ctx.Done() and a finish channel.
 // Returns a function to send to this, which should be called after the query is
 // finished.
+//
+// With cancel_grace_period the connection isn't marked as bad: the server
+// responds to the cancel with an error and ReadyForQuery, which is read as
+// usual. Reading fails once the grace period has passed, and the connection is
+// closed if it wasn't drained by then. The finish func waits for the
+// CancelRequest to be sent, so it can't cancel the next query.
+//
+// With deadline_statement_timeout the server aborts the query itself when the
+// deadline passes, so no CancelRequest is sent if statement_timeout was last
+// set for this ctx; the response is waited for in the same way, for at least
+// deadlineGracePeriod. A CancelRequest is still sent for statements that ran
+// without it, such as a transaction from BeginTx or a COPY prepared with
+// another ctx.
 func (cn *conn) watchCancel(ctx context.Context, fromStmt bool) func() {
 	if ctx.Done() == nil { // "may return nil if this context can never be canceled"
 		return func() {}
 	}
 
-	finished := make(chan struct{}, 1)
+	var (
+		grace     = cn.cfg.CancelGracePeriod
+		finished  = make(chan struct{}, 1)
+		cancelled = make(chan struct{}) // Closed after sending the CancelRequest.
+	)
 	go func() {
 		select {
 		case <-finished: // Query finished successfully.
 		case <-ctx.Done():
+			serverTimeout := cn.cfg.DeadlineStatementTimeout && errors.Is(ctx.Err(), context.DeadlineExceeded) &&
+				cn.timeoutDone.Load() == any(ctx.Done())
+			if serverTimeout {
+				grace = max(grace, deadlineGracePeriod)
+			}
 			select {
 			case finished <- struct{}{}:
 			default: // Raced with the finish func, let the next query handle this with the context.
 				return
 			}
-			if !fromStmt {
+			if grace > 0 {
+				_ = cn.c.SetDeadline(time.Now().Add(grace))
+			} else if !fromStmt {
 				cn.err.set(ctx.Err()) // Set the connection state to bad so it does not get reused.
 			}
-			cn.sendCancelRequest() // TODO: maybe handle error, somehow?
+			if !serverTimeout {
+				// Can't pass in ctx, as that one is cancelled.
+				cn.cancel(context.Background()) // TODO: maybe handle error, somehow?
+			}
+			close(cancelled)
 		}
 	}()
 
 	return func() {
 		select {
 		case <-finished:
+			if grace > 0 {
+				if cn.waitCancel(cancelled, grace) {
+					return
+				}
+				fromStmt = false
+			}
 			if !fromStmt {
 				cn.err.set(ctx.Err())
 				cn.Close()
@@ -1247,25 +1692,94 @@ func (cn *conn) watchCancel(ctx context.Context, fromStmt bool) func() {
 	}
 }
 
-func (cn *conn) sendCancelRequest() error {
-	// Use a copy since a new connection is created here. This is necessary
-	// because cancel is called from a goroutine in watchCancel.
-	cfg := cn.cfg.Clone()
+// waitCancel waits for the CancelRequest from watchCancel to be sent, which is
+// signalled by closing cancelled, and reports if the connection can still be
+// used. This is called after the response was read, which fails if the grace
+// period passed.
+func (cn *conn) waitCancel(cancelled <-chan struct{}, grace time.Duration) bool {
+	t := time.NewTimer(grace)
+	defer t.Stop()
+	select {
+	case <-cancelled:
+	case <-t.C:
+		return false
+	}
+	return cn.err.get() == nil && cn.c.SetDeadline(time.Time{}) == nil
+}
 
-	// Can't pass in context from parent, as that one may be cancelled.
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second) // TODO: use connect_timeout?
+// Cancel asks the server to cancel the query that is currently running on the
+// connection c. It returns once the server has received the request, after
+// which the query fails with a query_canceled (57014) error if it was still
+// running. The connection can still be used afterwards.
+//
+// The request is sent on a new connection to the same server, with the same
+// SSL or GSSAPI encryption as c. It fails if that takes longer than
+// cancel_timeout or if ctx is done.
+//
+// Cancel is safe to call while a query is running on c from another goroutine.
+// c must be a pq connection, which can be retrieved with [sql.Conn.Raw]:
+//
+//	c, err := db.Conn(ctx)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer c.Close()
+//
+//	err = c.Raw(func(driverConn any) error {
+//		stop := context.AfterFunc(ctx, func() {
+//			_ = pq.Cancel(context.Background(), driverConn.(driver.Conn))
+//		})
+//		defer stop()
+//		_, err := driverConn.(driver.ExecerContext).ExecContext(context.Background(), `select pg_sleep(10)`, nil)
+//		return err
+//	})
+func Cancel(ctx context.Context, c driver.Conn) error {
+	cn, err := asConn(c)
+	if err != nil {
+		return err
+	}
+	return cn.cancel(ctx)
+}
+
+// cancel sends a CancelRequest for the query running on cn.
+func (cn *conn) cancel(ctx context.Context) error {
+	timeout := cn.cfg.CancelTimeout
+	if timeout <= 0 {
+		timeout = cn.cfg.ConnectTimeout
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	// Use a copy since a new connection is created here. This is necessary
+	// because cancel is called from a goroutine in watchCancel. The connect
+	// timeout sets a deadline for the entire request in dial.
+	cfg := cn.cfg.Clone()
+	deadline, _ := ctx.Deadline()
+	cfg.ConnectTimeout = max(time.Until(deadline), time.Millisecond)
+
 	c, err := dial(ctx, cn.dialer, cfg)
 	if err != nil {
 		return err
 	}
-	defer c.Close()
+	cn2 := conn{c: c, cfg: cfg, sslPassword: cn.sslPassword, protoTrace: cn.protoTrace}
+	defer func() { _ = cn2.c.Close() }()
 
-	cn2 := conn{c: c}
-	if err := cn2.ssl(cfg, cfg.SSLMode); err != nil {
+	if _, ok := cn.c.(*gssConn); ok {
+		gss, err := gssEncrypter(cfg, GSSEncModeRequire)
+		if err != nil {
+			return err
+		}
+		err = cn2.gssenc(cfg, gss)
+		if err != nil {
+			return err
+		}
+	} else if err := cn2.ssl(ctx, cfg, cfg.SSLMode); err != nil {
 		return err
 	}
+
 	w := cn2.writeBuf(0)
 	w.int32(proto.CancelRequestCode)
 	w.int32(cn.pid)
@@ -1275,14 +1789,19 @@ func (cn *conn) sendCancelRequest() error {
 	}
 
 	// Read until EOF to ensure that the server received the cancel.
-	_, err = io.Copy(io.Discard, c)
+	_, err = io.Copy(io.Discard, cn2.c)
 	return err
 }
 
 // Don't refer to Config.SSLMode here, as the mode in arguments may be different
 // in case of sslmode=allow or prefer.
-func (cn *conn) ssl(cfg Config, mode SSLMode) error {
-	upgrade, err := ssl(cfg, mode)
+func (cn *conn) ssl(ctx context.Context, cfg Config, mode SSLMode) error {
+	upgrade, err := ssl(cfg, mode, func(file string) (string, error) {
+		if cfg.SSLPassword != "" || cn.sslPassword == nil {
+			return cfg.SSLPassword, nil
+		}
+		return cn.sslPassword(ctx, file)
+	})
 	if err != nil {
 		return err
 	}
@@ -1304,6 +1823,7 @@ func (cn *conn) ssl(cfg Config, mode SSLMode) error {
 		if err != nil {
 			return err
 		}
+		cn.protoTrace.response("SSLResponse", b[0])
 
 		if b[0] != 'S' {
 			return ErrSSLNotSupported
@@ -1314,7 +1834,7 @@ func (cn *conn) ssl(cfg Config, mode SSLMode) error {
 	return err
 }
 
-func (cn *conn) startup(cfg Config) error {
+func (cn *conn) startup(ctx context.Context, cfg Config) error {
 	w := cn.writeBuf(0)
 	// Send maximum protocol version in startup; if the server doesn't support
 	// this version it responds with NegotiateProtocolVersion and the maximum
@@ -1329,7 +1849,10 @@ func (cn *conn) startup(cfg Config) error {
 		w.string("database")
 		w.string(cfg.Database)
 	}
-	// w.string("replication") // Sent by libpq, but we don't support that.
+	if cfg.Replication != "" && cfg.Replication != ReplicationOff {
+		w.string("replication")
+		w.string(string(cfg.Replication))
+	}
 	if cfg.Options != "" {
 		w.string("options")
 		w.string(cfg.Options)
@@ -1377,7 +1900,7 @@ func (cn *conn) startup(cfg Config) error {
 			if code != proto.AuthReqOk {
 				didauth = true
 			}
-			err := cn.auth(code, r, cfg)
+			err := cn.auth(ctx, code, r, cfg)
 			if err != nil {
 				return err
 			}
@@ -1399,18 +1922,33 @@ func (cn *conn) startup(cfg Config) error {
 	}
 }
 
-func (cn *conn) auth(code proto.AuthCode, r *readBuf, cfg Config) error {
+// checkAuth checks if the authentication method m is allowed by require_auth and
+// channel_binding.
+func (cn *conn) checkAuth(m RequireAuth) error {
+	if !cn.cfg.RequireAuth.allows(m) {
+		return fmt.Errorf("pq: authentication method requirement %q failed: server requested %q", cn.cfg.RequireAuth, m)
+	}
+	if m != RequireAuthScramSHA256 && cn.cfg.ChannelBinding == ChannelBindingRequire {
+		return fmt.Errorf("pq: channel binding required, but server requested %q authentication", m)
+	}
+	return nil
+}
+
+func (cn *conn) auth(ctx context.Context, code proto.AuthCode, r *readBuf, cfg Config) error {
 	switch code {
 	default:
 		return fmt.Errorf("pq: unknown authentication response: %s", code)
 	case proto.AuthReqKrb4, proto.AuthReqKrb5, proto.AuthReqCrypt, proto.AuthReqSSPI:
 		return fmt.Errorf("pq: unsupported authentication method: %s", code)
 	case proto.AuthReqOk:
+		if cfg.ChannelBinding == ChannelBindingRequire && !cn.channelBound {
+			return errors.New("pq: channel binding required, but server authenticated client without channel binding")
+		}
 		return nil
 
 	case proto.AuthReqPassword:
-		if len(cn.cfg.RequireAuth) > 0 && !slices.Contains(cn.cfg.RequireAuth, RequireAuthPassword) && !slices.Contains(cn.cfg.RequireAuth, RequireAuthAny) {
-			return fmt.Errorf("pq: authentication method requirement %q failed: server requested %q", cn.cfg.RequireAuth, RequireAuthPassword)
+		if err := cn.checkAuth(RequireAuthPassword); err != nil {
+			return err
 		}
 		w := cn.writeBuf(proto.PasswordMessage)
 		w.string(cfg.Password)
@@ -1419,8 +1957,8 @@ func (cn *conn) auth(code proto.AuthCode, r *readBuf, cfg Config) error {
 		return cn.send(w)
 
 	case proto.AuthReqMD5:
-		if len(cn.cfg.RequireAuth) > 0 && !slices.Contains(cn.cfg.RequireAuth, RequireAuthMD5) && !slices.Contains(cn.cfg.RequireAuth, RequireAuthAny) {
-			return fmt.Errorf("pq: authentication method requirement %q failed: server requested %q", cn.cfg.RequireAuth, RequireAuthMD5)
+		if err := cn.checkAuth(RequireAuthMD5); err != nil {
+			return err
 		}
 		s := string(r.next(4))
 		w := cn.writeBuf(proto.PasswordMessage)
@@ -1429,6 +1967,9 @@ func (cn *conn) auth(code proto.AuthCode, r *readBuf, cfg Config) error {
 		return cn.send(w)
 
 	case proto.AuthReqGSS: // GSSAPI, startup
+		if err := cn.checkAuth(RequireAuthGSS); err != nil {
+			return err
+		}
 		if newGss == nil {
 			return fmt.Errorf("pq: kerberos error: no GSSAPI provider registered (import github.com/lib/pq/auth/kerberos)")
 		}
@@ -1437,18 +1978,7 @@ func (cn *conn) auth(code proto.AuthCode, r *readBuf, cfg Config) error {
 			return fmt.Errorf("pq: kerberos error: %w", err)
 		}
 
-		var token []byte
-		if cfg.KrbSpn != "" {
-			// Use the supplied SPN if provided.
-			token, err = cli.GetInitTokenFromSpn(cfg.KrbSpn)
-		} else {
-			// Allow the kerberos service name to be overridden.
-			service := "postgres"
-			if cfg.KrbSrvname != "" {
-				service = cfg.KrbSrvname
-			}
-			token, err = cli.GetInitToken(cfg.Host, service)
-		}
+		token, err := gssInitToken(cli, cfg)
 		if err != nil {
 			return fmt.Errorf("pq: failed to get Kerberos ticket: %w", err)
 		}
@@ -1484,10 +2014,49 @@ func (cn *conn) auth(code proto.AuthCode, r *readBuf, cfg Config) error {
 		return nil
 
 	case proto.AuthReqSASL:
-		if len(cn.cfg.RequireAuth) > 0 && !slices.Contains(cn.cfg.RequireAuth, RequireAuthScramSHA256) && !slices.Contains(cn.cfg.RequireAuth, RequireAuthAny) {
-			return fmt.Errorf("pq: authentication method requirement %q failed: server requested %q", cn.cfg.RequireAuth, RequireAuthScramSHA256)
+		var mechs []string
+		for len(*r) > 0 {
+			m := r.string()
+			if m == "" {
+				break
+			}
+			mechs = append(mechs, m)
+		}
+		if slices.Contains(mechs, "OAUTHBEARER") {
+			if err := cn.checkAuth(RequireAuthOAuth); err != nil {
+				return err
+			}
+			return cn.oauth(ctx, cfg)
+		}
+
+		// SCRAM-SHA-256-PLUS is also "scram-sha-256" for require_auth, same as
+		// libpq.
+		if err := cn.checkAuth(RequireAuthScramSHA256); err != nil {
+			return err
 		}
+
 		sc := scram.NewClient(sha256.New, cfg.User, cfg.Password)
+		mech := "SCRAM-SHA-256"
+		if tc, ok := cn.c.(*tls.Conn); ok && cfg.ChannelBinding != ChannelBindingDisable {
+			if slices.Contains(mechs, "SCRAM-SHA-256-PLUS") {
+				data, err := tlsServerEndPoint(tc.ConnectionState())
+				if err != nil {
+					return err
+				}
+				mech = "SCRAM-SHA-256-PLUS"
+				sc.ChannelBinding("tls-server-end-point", data)
+			} else {
+				sc.ChannelBinding("", nil)
+			}
+		}
+		if cfg.ChannelBinding == ChannelBindingRequire && mech != "SCRAM-SHA-256-PLUS" {
+			if _, ok := cn.c.(*tls.Conn); !ok {
+				return errors.New("pq: channel binding required, but SSL is not in use")
+			}
+			return errors.New("pq: channel binding required, but server does not support SCRAM-SHA-256-PLUS")
+		}
+		cn.channelBound = mech == "SCRAM-SHA-256-PLUS"
+
 		sc.Step(nil)
 		if sc.Err() != nil {
 			return fmt.Errorf("pq: SCRAM-SHA-256 error: %w", sc.Err())
@@ -1495,7 +2064,7 @@ func (cn *conn) auth(code proto.AuthCode, r *readBuf, cfg Config) error {
 		scOut := sc.Out()
 
 		w := cn.writeBuf(proto.SASLResponse)
-		w.string("SCRAM-SHA-256")
+		w.string(mech)
 		w.int32(len(scOut))
 		w.bytes(scOut)
 		err := cn.send(w)
@@ -1646,12 +2215,33 @@ func (cn *conn) sendBinaryParameters(b *writeBuf, args []driver.NamedValue) erro
 	return nil
 }
 
-func (cn *conn) sendBinaryModeQuery(query string, args []driver.NamedValue) error {
+func (cn *conn) sendBinaryModeQuery(query string, args []driver.NamedValue, fetch int) error {
+	b := cn.writeBuf(proto.Parse)
+	err := cn.writeBinaryModeQuery(b, query, args, fetch)
+	if err != nil {
+		return err
+	}
+	if fetch > 0 {
+		b.next(proto.Flush)
+	} else {
+		b.next(proto.Sync)
+	}
+	err = cn.send(b)
+	if err != nil {
+		return err
+	}
+	cn.syncPending = fetch > 0
+	return nil
+}
+
+// writeBinaryModeQuery writes the Parse, Bind, Describe, and Execute messages
+// for query to b, which must have a Parse message started. The Execute fetches
+// at most maxRows rows, or all rows if it's 0.
+func (cn *conn) writeBinaryModeQuery(b *writeBuf, query string, args []driver.NamedValue, maxRows int) error {
 	if len(args) >= 65536 {
 		return fmt.Errorf("pq: got %d parameters but PostgreSQL only supports 65535 parameters", len(args))
 	}
 
-	b := cn.writeBuf(proto.Parse)
 	b.byte(0) // unnamed statement
 	b.string(query)
 	b.int16(0)
@@ -1670,10 +2260,8 @@ func (cn *conn) sendBinaryModeQuery(query string, args []driver.NamedValue) erro
 
 	b.next(proto.Execute)
 	b.byte(0)
-	b.int32(0)
-
-	b.next(proto.Sync)
-	return cn.send(b)
+	b.int32(maxRows)
+	return nil
 }
 
 func (cn *conn) processParameterStatus(r *readBuf) {
@@ -1688,6 +2276,8 @@ func (cn *conn) processParameterStatus(r *readBuf) {
 		if err == nil {
 			cn.parameterStatus.serverVersion = major1*10000 + major2*100
 		}
+	case "IntervalStyle":
+		cn.parameterStatus.intervalStyle = r.string()
 	case "TimeZone":
 		switch tz := r.string(); tz {
 		case "UTC", "Etc/UTC", "Etc/Universal", "Etc/Zulu", "Etc/UCT":
@@ -1717,9 +2307,15 @@ func (cn *conn) processParameterStatus(r *readBuf) {
 
 func (cn *conn) processReadyForQuery(r *readBuf) {
 	cn.txnStatus = transactionStatus(r.byte())
+	if cn.txnStatus == txnStatusIdle {
+		cn.timeoutLocal, cn.timeoutDefault = false, false
+	}
 }
 
 func (cn *conn) readReadyForQuery() error {
+	if err := cn.sendPendingSync(); err != nil {
+		return err
+	}
 	t, r, err := cn.recv1()
 	if err != nil {
 		return err
@@ -1738,6 +2334,24 @@ func (cn *conn) readReadyForQuery() error {
 	}
 }
 
+// sendPendingSync sends a Sync message if syncPending is set.
+func (cn *conn) sendPendingSync() error {
+	if !cn.syncPending {
+		return nil
+	}
+	cn.syncPending = false
+	return cn.send(cn.writeBuf(proto.Sync))
+}
+
+// sendExecute sends an Execute for the next n rows of the unnamed portal.
+func (cn *conn) sendExecute(n int) error {
+	w := cn.writeBuf(proto.Execute)
+	w.byte(0)
+	w.int32(n)
+	w.next(proto.Flush)
+	return cn.send(w)
+}
+
 func (cn *conn) readParseResponse() error {
 	t, r, err := cn.recv1()
 	if err != nil {
@@ -1934,9 +2548,34 @@ func (cn *conn) ResetSession(ctx context.Context) error {
 	// Ensure bad connections are reported: From database/sql/driver:
 	// If a connection is never returned to the connection pool but immediately reused, then
 	// ResetSession is called prior to reuse but IsValid is not called.
-	return cn.err.get()
+	if err := cn.err.get(); err != nil {
+		return err
+	}
+	// The connection was returned to the pool with an unfinished COPY, which
+	// can only happen if it was prepared on a sql.DB. Abort it so the data
+	// isn't committed, and Exec() on the statement returns an error.
+	if ci := cn.copyIn; ci != nil {
+		ci.released = true
+		if err := ci.Close(); err != nil {
+			return driver.ErrBadConn
+		}
+	}
+	// An unfinished pipeline; the connection can't be used by anyone else, so
+	// make sure it's discarded.
+	if cn.busy != nil {
+		return driver.ErrBadConn
+	}
+	// Reset statement_timeout from deadline_statement_timeout; this is sent
+	// with whatever the connection is used for next.
+	return cn.handleError(cn.setStatementTimeout(context.Background()))
 }
 
 func (cn *conn) IsValid() bool {
-	return cn.err.get() == nil
+	// An unfinished COPY is aborted in ResetSession before the connection is
+	// reused, or in copyin.Close if the pool closes it.
+	if cn.copyIn != nil {
+		cn.copyIn.released = true
+		return cn.err.get() == nil
+	}
+	return cn.err.get() == nil && cn.busy == nil
 }
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
@@ -17,6 +18,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -1390,6 +1392,458 @@ func TestIssue617(t *testing.T) {
 	t.Errorf("goroutine leak detected, was %d, now %d", numGoroutineStart, numGoroutineFinish)
 }
 
+func TestCancelGracePeriod(t *testing.T) {
+	// respond is false if the server doesn't respond to the cancel.
+	fake := func(t *testing.T, respond bool) (pqtest.Fake, *atomic.Int32) {
+		var (
+			conns    atomic.Int32
+			cancelCh = make(chan struct{}, 1)
+		)
+		f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+			code, _, ok := f.ReadStartupPacket(cn)
+			if !ok {
+				return
+			}
+			if code == proto.CancelRequestCode {
+				cancelCh <- struct{}{}
+				cn.Close()
+				return
+			}
+			conns.Add(1)
+			f.WriteMsg(cn, proto.AuthenticationRequest, "\x00\x00\x00\x00")
+			f.WriteBackendKeyData(cn, 1, []byte{1, 2, 3, 4})
+			f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			for {
+				code, q, ok := f.ReadMsg(cn)
+				if !ok {
+					return
+				}
+				switch code {
+				case proto.Terminate:
+					cn.Close()
+					return
+				case proto.Query:
+					switch q := string(q[:bytes.IndexByte(q, 0)]); q {
+					case "select pg_sleep(10)":
+						<-cancelCh
+						if !respond {
+							continue
+						}
+						f.WriteMsg(cn, proto.ErrorResponse, "SERROR\x00C57014\x00Mcanceling statement due to user request\x00\x00")
+						f.WriteMsg(cn, proto.ReadyForQuery, "I")
+					default:
+						f.SimpleQuery(cn, "SELECT 1", "x", 1)
+						f.WriteMsg(cn, proto.ReadyForQuery, "I")
+					}
+				}
+			}
+		})
+		return f, &conns
+	}
+
+	t.Run("drain", func(t *testing.T) {
+		t.Parallel()
+		f, conns := fake(t, true)
+		defer f.Close()
+		db := pqtest.MustDB(t, f.DSN()+" sslmode=disable cancel_grace_period=5")
+		db.SetMaxOpenConns(1)
+
+		for range 3 {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			_, err := db.ExecContext(ctx, "select pg_sleep(10)")
+			cancel()
+			mustAs(t, err, pqerror.QueryCanceled)
+			pqtest.QueryRow[int](t, db, "select 1")
+		}
+		if n := conns.Load(); n != 1 {
+			t.Errorf("%d connections", n)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		t.Parallel()
+		f, conns := fake(t, false)
+		defer f.Close()
+		db := pqtest.MustDB(t, f.DSN()+" sslmode=disable cancel_grace_period=1")
+		db.SetMaxOpenConns(1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := db.ExecContext(ctx, "select pg_sleep(10)")
+		if !pqtest.ErrorContains(err, "i/o timeout") {
+			t.Errorf("wrong error: %v", err)
+		}
+		pqtest.QueryRow[int](t, db, "select 1")
+		if n := conns.Load(); n != 2 {
+			t.Errorf("%d connections", n)
+		}
+	})
+}
+
+func TestCancel(t *testing.T) {
+	cert, err := tls.LoadX509KeyPair("testdata/ssl/server.crt", "testdata/ssl/server.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := bytes.Repeat([]byte{0xab}, 32) // Protocol 3.2 allows up to 256 bytes.
+
+	// Server that only accepts SSL connections, and doesn't close the
+	// connection for the CancelRequest if hang is set.
+	fake := func(t *testing.T, hang bool) (pqtest.Fake, chan []byte) {
+		cancelCh := make(chan []byte, 1)
+		f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+			defer cn.Close()
+			code, _, ok := f.ReadStartupPacket(cn)
+			if !ok || code != proto.NegotiateSSLCode {
+				return
+			}
+			cn.Write([]byte("S"))
+			tc := tls.Server(cn, &tls.Config{Certificates: []tls.Certificate{cert}})
+			code, msg, ok := f.ReadStartupPacket(tc)
+			if !ok {
+				return
+			}
+			if code == proto.CancelRequestCode {
+				cancelCh <- msg
+				if hang {
+					io.Copy(io.Discard, tc) // Until the client gives up.
+				}
+				return
+			}
+
+			f.WriteMsg(tc, proto.AuthenticationRequest, "\x00\x00\x00\x00")
+			f.WriteBackendKeyData(tc, 42, key)
+			f.WriteMsg(tc, proto.ReadyForQuery, "I")
+			for {
+				code, _, ok := f.ReadMsg(tc)
+				if !ok || code == proto.Terminate {
+					return
+				}
+				f.SimpleQuery(tc, "SELECT 1", "x", 1)
+				f.WriteMsg(tc, proto.ReadyForQuery, "I")
+			}
+		})
+		t.Cleanup(f.Close)
+		return f, cancelCh
+	}
+
+	t.Run("ssl", func(t *testing.T) {
+		t.Parallel()
+		f, cancelCh := fake(t, false)
+		db := pqtest.MustDB(t, f.DSN()+" sslmode=require")
+		c, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		err = c.Raw(func(driverConn any) error {
+			return Cancel(context.Background(), driverConn.(driver.Conn))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := append([]byte{0, 0, 0, 42}, key...)
+		if have := <-cancelCh; !bytes.Equal(have, want) {
+			t.Errorf("\nhave: %x\nwant: %x", have, want)
+		}
+
+		// Still usable.
+		var n int
+		if err := c.QueryRowContext(context.Background(), "select 1").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("cancel_timeout", func(t *testing.T) {
+		t.Parallel()
+		f, _ := fake(t, true)
+		db := pqtest.MustDB(t, f.DSN()+" sslmode=require cancel_timeout=1")
+		c, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		start := time.Now()
+		err = c.Raw(func(driverConn any) error {
+			return Cancel(context.Background(), driverConn.(driver.Conn))
+		})
+		if !pqtest.ErrorContains(err, "i/o timeout") {
+			t.Errorf("wrong error: %v", err)
+		}
+		if d := time.Since(start); d > 3*time.Second {
+			t.Errorf("took %s", d)
+		}
+	})
+
+	t.Run("not pq", func(t *testing.T) {
+		err := Cancel(context.Background(), nil)
+		if !pqtest.ErrorContains(err, "not a pq connection") {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+}
+
+func TestDeadlineStatementTimeout(t *testing.T) {
+	t.Parallel()
+
+	var (
+		conns, cancels atomic.Int32
+		queries        = make(chan string, 100)
+		cancelCh       = make(chan struct{}, 1)
+	)
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		code, _, ok := f.ReadStartupPacket(cn)
+		if !ok {
+			return
+		}
+		if code == proto.CancelRequestCode {
+			cancels.Add(1)
+			cancelCh <- struct{}{}
+			cn.Close()
+			return
+		}
+		conns.Add(1)
+		f.WriteMsg(cn, proto.AuthenticationRequest, "\x00\x00\x00\x00")
+		f.WriteBackendKeyData(cn, 1, []byte{1, 2, 3, 4})
+		f.WriteMsg(cn, proto.ReadyForQuery, "I")
+		var (
+			status  = "I"
+			timeout time.Duration
+		)
+		for {
+			code, q, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			switch code {
+			case proto.Terminate:
+				cn.Close()
+				return
+			case proto.Query:
+				q := string(q[:bytes.IndexByte(q, 0)])
+				switch {
+				case strings.HasPrefix(q, "SET statement_timeout = "), strings.HasPrefix(q, "SET LOCAL statement_timeout = "):
+					ms, _ := strconv.Atoi(q[strings.LastIndexByte(q, ' ')+1:])
+					timeout = time.Duration(ms) * time.Millisecond
+					queries <- q[:strings.LastIndexByte(q, ' ')] + " N"
+					f.WriteMsg(cn, proto.CommandComplete, "SET\x00")
+				case strings.HasPrefix(q, "SET"), q == "RESET statement_timeout":
+					queries <- q
+					timeout = 0
+					f.WriteMsg(cn, proto.CommandComplete, "SET\x00")
+				case q == "select pg_sleep(10)":
+					queries <- q
+					if timeout > 0 {
+						time.Sleep(timeout)
+						f.WriteMsg(cn, proto.ErrorResponse, "SERROR\x00C57014\x00Mcanceling statement due to statement timeout\x00\x00")
+						break
+					}
+					select {
+					case <-cancelCh:
+					case <-time.After(5 * time.Second):
+					}
+					f.WriteMsg(cn, proto.ErrorResponse, "SERROR\x00C57014\x00Mcanceling statement due to user request\x00\x00")
+				case strings.HasPrefix(q, "BEGIN"):
+					queries <- q
+					status = "T"
+					f.WriteMsg(cn, proto.CommandComplete, "BEGIN\x00")
+				case q == "COMMIT":
+					queries <- q
+					status = "I"
+					f.WriteMsg(cn, proto.CommandComplete, "COMMIT\x00")
+				default:
+					queries <- q
+					f.SimpleQuery(cn, "SELECT 1", "x", 1)
+				}
+				f.WriteMsg(cn, proto.ReadyForQuery, status)
+			case proto.Parse:
+				queries <- "parse " + strings.Split(string(q), "\x00")[1]
+				f.WriteMsg(cn, proto.ParseComplete, "")
+			case proto.Bind:
+				f.WriteMsg(cn, proto.BindComplete, "")
+			case proto.Describe:
+				f.WriteMsg(cn, proto.NoData, "")
+			case proto.Execute:
+				f.WriteMsg(cn, proto.CommandComplete, "SELECT 0\x00")
+			case proto.Sync:
+				f.WriteMsg(cn, proto.ReadyForQuery, status)
+			case proto.FunctionCall:
+				queries <- "function call"
+				f.WriteMsg(cn, proto.FunctionCallResponse, "\x00\x00\x00\x04\x00\x00\x40\x00")
+				f.WriteMsg(cn, proto.ReadyForQuery, status)
+			}
+		}
+	})
+	defer f.Close()
+	db := pqtest.MustDB(t, f.DSN()+" sslmode=disable deadline_statement_timeout=1")
+	db.SetMaxOpenConns(1)
+
+	deadline := func() context.Context {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		t.Cleanup(cancel)
+		return ctx
+	}
+	exec := func(e interface {
+		ExecContext(context.Context, string, ...any) (sql.Result, error)
+	}, ctx context.Context, q string) {
+		t.Helper()
+		if _, err := e.ExecContext(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := db.ExecContext(deadline(), "select pg_sleep(10)")
+	mustAs(t, err, pqerror.QueryCanceled)
+	exec(db, context.Background(), "select 1")
+	exec(db, context.Background(), "select 2")
+
+	tx := pqtest.Begin(t, db)
+	exec(tx, deadline(), "select 3")
+	exec(tx, context.Background(), "select 4")
+	exec(tx, context.Background(), "select 5")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	exec(db, deadline(), "select 6")
+	tx = pqtest.Begin(t, db)
+	exec(tx, context.Background(), "select 7")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	exec(db, context.Background(), "select 8")
+
+	// Batches, large objects, and COMMIT also use the default.
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec(c, deadline(), "select 9")
+	err = c.Raw(func(driverConn any) error {
+		var b Batch
+		b.Queue("select 10")
+		br, err := b.SendBatch(context.Background(), driverConn.(driver.Conn))
+		if err != nil {
+			return err
+		}
+		if _, err := br.Exec(); err != nil {
+			return err
+		}
+		return br.Close()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err = c.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec(tx, deadline(), "select 11")
+	err = c.Raw(func(driverConn any) error {
+		lo, err := NewLargeObjects(driverConn.(driver.Conn))
+		if err != nil {
+			return err
+		}
+		_, err = lo.Create(context.Background(), 0)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec(tx, deadline(), "select 12")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Too far away for statement_timeout.
+	exec(db, deadline(), "select 13")
+	ctx, cancel := context.WithTimeout(context.Background(), 25*24*time.Hour)
+	defer cancel()
+	exec(db, ctx, "select 14")
+
+	if n := conns.Load(); n != 1 {
+		t.Errorf("%d connections", n)
+	}
+	if n := cancels.Load(); n != 0 {
+		t.Errorf("%d cancel requests", n)
+	}
+	var have []string
+	for len(queries) > 0 {
+		have = append(have, <-queries)
+	}
+	want := []string{
+		";", // Ping from MustDB.
+		"SET statement_timeout = N",
+		"select pg_sleep(10)",
+		"RESET statement_timeout",
+		"select 1",
+		"select 2",
+		"BEGIN READ WRITE",
+		"SET LOCAL statement_timeout = N",
+		"select 3",
+		"SET LOCAL statement_timeout TO DEFAULT",
+		"select 4",
+		"select 5",
+		"COMMIT",
+		"SET statement_timeout = N",
+		"select 6",
+		"RESET statement_timeout",
+		"BEGIN READ WRITE",
+		"select 7",
+		"COMMIT",
+		"select 8",
+		"SET statement_timeout = N",
+		"select 9",
+		"RESET statement_timeout",
+		"parse select 10",
+		"BEGIN READ WRITE",
+		"SET LOCAL statement_timeout = N",
+		"select 11",
+		"SET LOCAL statement_timeout TO DEFAULT",
+		"function call",
+		"SET LOCAL statement_timeout = N",
+		"select 12",
+		"SET LOCAL statement_timeout TO DEFAULT",
+		"COMMIT",
+		"SET statement_timeout = N",
+		"select 13",
+		"RESET statement_timeout",
+		"select 14",
+	}
+	if h, w := strings.Join(have, "\n"), strings.Join(want, "\n"); h != w {
+		t.Errorf("\nhave:\n%s\nwant:\n%s", h, w)
+	}
+
+	// statement_timeout isn't set for the ctx of BeginTx, so a CancelRequest
+	// is still needed when its deadline passes.
+	tx, err = db.BeginTx(deadline(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tx.ExecContext(context.Background(), "select pg_sleep(10)")
+	mustAs(t, err, pqerror.QueryCanceled)
+	if !pqtest.ErrorContains(err, "user request") {
+		t.Errorf("wrong error: %v", err)
+	}
+	_ = tx.Rollback()
+	if n := cancels.Load(); n != 1 {
+		t.Errorf("%d cancel requests", n)
+	}
+}
+
 func TestContextCancelBegin(t *testing.T) {
 	t.Parallel()
 	pqtest.SkipPgpool(t) // TODO: flaky in CI
@@ -1618,7 +2072,7 @@ func TestAuth(t *testing.T) {
 	for _, tt := range tests {
 		t.Run("", func(t *testing.T) {
 			t.Run("unsupported auth", func(t *testing.T) {
-				err := (&conn{}).auth(tt.code, &readBuf{}, Config{})
+				err := (&conn{}).auth(context.Background(), tt.code, &readBuf{}, Config{})
 				if !pqtest.ErrorContains(err, tt.wantErr) {
 					t.Errorf("wrong error:\nhave: %s\nwant: %s", err, tt.wantErr)
 				}
@@ -1663,10 +2117,19 @@ func TestAuth(t *testing.T) {
 			{"user=pqgopassword password=wordpass require_auth=!md5,!password", `"!md5,!password" failed: server requested "password"`},
 			{"user=pqgoscram password=wordpass require_auth=!md5,!password,!scram-sha-256", `"!md5,!password,!scram-sha-256" failed: server requested "scram-sha-256"`},
 			{"user=pqgomd5 password=wordpass require_auth=password", `"password" failed: server requested "md5"`},
+			{"user=pqgoscram password=wordpass require_auth=!md5,!password", ``},
+			{"user=pqgomd5 password=wordpass require_auth=!password", ``},
 
 			{"user=pqgo password=unused require_auth=none", ``},
 			{"user=pqgo password=unused require_auth=!none", `"!none" failed: server did not perform any authentication`},
 			{"user=pqgo password=unused require_auth=md5,password,scram-sha-256", `"md5,password,scram-sha-256" failed: server did not perform any authentication`},
+
+			// channel_binding
+			{"user=pqgoscram password=wordpass sslmode=require channel_binding=require", ``},
+			{"user=pqgoscram password=wordpass sslmode=require channel_binding=disable", ``},
+			{"user=pqgoscram password=wordpass sslmode=require require_auth=scram-sha-256 channel_binding=require", ``},
+			{"user=pqgomd5 password=wordpass sslmode=require channel_binding=require", `channel binding required, but server requested "md5" authentication`},
+			{"user=pqgo password=unused sslmode=require channel_binding=require", `channel binding required, but server authenticated client without channel binding`},
 		}
 
 		for _, tt := range tests {
@@ -1674,6 +2137,9 @@ func TestAuth(t *testing.T) {
 				if strings.Contains(tt.conn, "md5") {
 					pqtest.SkipCockroach(t) // md5 not supported
 				}
+				if strings.Contains(tt.conn, "channel_binding") {
+					pqtest.SkipCockroach(t) // SCRAM-SHA-256-PLUS not supported
+				}
 				_, err := pqtest.DB(t, tt.conn)
 				if !pqtest.ErrorContains(err, tt.wantErr) {
 					t.Errorf("wrong error:\nhave: %s\nwant: %s", err, tt.wantErr)
@@ -1748,6 +2214,130 @@ func TestJSONRawMessage(t *testing.T) {
 	}
 }
 
+func TestNamedArgs(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu  sync.Mutex
+		log []string
+	)
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		f.Startup(cn, nil)
+		var nparams int
+		for {
+			code, msg, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			mu.Lock()
+			switch code {
+			case proto.Terminate:
+				cn.Close()
+				mu.Unlock()
+				return
+			case proto.Query:
+				f.WriteMsg(cn, proto.EmptyQueryResponse, "")
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.Parse:
+				q := strings.Split(string(msg), "\x00")[1]
+				log = append(log, "parse "+q)
+				nparams = 0
+				for strings.Contains(q, "$"+strconv.Itoa(nparams+1)) {
+					nparams++
+				}
+				f.WriteMsg(cn, proto.ParseComplete, "")
+			case proto.Describe:
+				f.WriteMsg(cn, proto.ParameterDescription, "\x00"+string(rune(nparams))+strings.Repeat("\x00\x00\x00\x19", nparams))
+				f.WriteMsg(cn, proto.NoData, "")
+			case proto.Bind:
+				r := readBuf(msg)
+				r.string()
+				r.string()
+				for range r.int16() {
+					r.int16()
+				}
+				var params []string
+				for range r.int16() {
+					params = append(params, string(r.next(r.int32())))
+				}
+				log = append(log, "bind "+strings.Join(params, " "))
+				f.WriteMsg(cn, proto.BindComplete, "")
+			case proto.Execute:
+				f.WriteMsg(cn, proto.CommandComplete, "INSERT 0 1\x00")
+			case proto.Close:
+				f.WriteMsg(cn, proto.CloseComplete, "")
+			case proto.Sync:
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			}
+			mu.Unlock()
+		}
+	})
+	defer f.Close()
+	db := pqtest.MustDB(t, f.DSN())
+
+	pqtest.Exec(t, db, `insert into tbl values (@a, :b, @a)`, sql.Named("b", 2), sql.Named("a", 1))
+	pqtest.Exec(t, db, `insert into tbl values ($1, $2)`, sql.Named("b", 1), sql.Named("a", 2))
+
+	// Only rewritten with named_placeholders, as @x could be the @ operator.
+	st, err := db.Prepare(`select @x from tbl`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+
+	st, err = pqtest.MustDB(t, f.DSN()+" named_placeholders=1").Prepare(`insert into tbl values (@a, @b)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if _, err := st.Exec(sql.Named("b", "y"), sql.Named("a", "x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Exec("p", "q"); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	have := strings.Join(log, "\n")
+	mu.Unlock()
+	want := strings.Join([]string{
+		"parse insert into tbl values ($1, $2, $1)",
+		"bind 1 2",
+		"parse insert into tbl values ($1, $2)",
+		"bind 1 2",
+		"parse select @x from tbl",
+		"parse insert into tbl values ($1, $2)",
+		"bind x y",
+		"bind p q",
+	}, "\n")
+	if have != want {
+		t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+	}
+
+	tests := []struct {
+		query   string
+		args    []any
+		wantErr string
+	}{
+		{`select @a`, []any{sql.Named("a", 1), 2}, `pq: can't mix named and positional arguments`},
+		{`select @a`, []any{sql.Named("b", 1)}, `pq: named argument "b" is not used in the query`},
+		{`select @a, @b`, []any{sql.Named("a", 1)}, `pq: got 1 named arguments but the query has 2 named parameters`},
+		{`select @a, @b`, []any{sql.Named("a", 1), sql.Named("a", 2)}, `pq: no value for named parameter "b"`},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			_, err := db.Exec(tt.query, tt.args...)
+			if !pqtest.ErrorContains(err, tt.wantErr) {
+				t.Errorf("wrong error:\nhave: %v\nwant: %s", err, tt.wantErr)
+			}
+		})
+	}
+	_, err = st.Exec(sql.Named("a", 1), sql.Named("a", 2))
+	if !pqtest.ErrorContains(err, `pq: no value for named parameter "b"`) {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
 func TestPreProtocolError(t *testing.T) {
 	tests := []struct {
 		msg     string
@@ -4,7 +4,9 @@ import (
 	"context"
 	"crypto/tls"
 	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
 	"maps"
 	"math/rand"
 	"net"
@@ -32,12 +34,18 @@ type (
 	// SSLNegotiation is a sslnegotiation setting.
 	SSLNegotiation string
 
+	// GSSEncMode is a gssencmode setting.
+	GSSEncMode string
+
 	// TargetSessionAttrs is a target_session_attrs setting.
 	TargetSessionAttrs string
 
 	// LoadBalanceHosts is a load_balance_hosts setting.
 	LoadBalanceHosts string
 
+	// Replication is a replication setting.
+	Replication string
+
 	// ProtocolVersion is a min_protocol_version or max_protocol_version
 	// setting.
 	ProtocolVersion string
@@ -51,6 +59,9 @@ type (
 
 	// RequireAuths is a require_auth setting.
 	RequireAuths []RequireAuth
+
+	// ChannelBinding is a channel_binding setting.
+	ChannelBinding string
 )
 
 // Values for [SSLMode] that pq supports.
@@ -97,6 +108,21 @@ const (
 
 var sslNegotiations = []SSLNegotiation{SSLNegotiationPostgres, SSLNegotiationDirect}
 
+// Values for [GSSEncMode] that pq supports.
+const (
+	// Don't use GSSAPI encryption.
+	GSSEncModeDisable = GSSEncMode("disable")
+
+	// Use GSSAPI encryption if the registered GSS provider supports it and the
+	// server accepts it, or continue without it. This is the default.
+	GSSEncModePrefer = GSSEncMode("prefer")
+
+	// Require GSSAPI encryption.
+	GSSEncModeRequire = GSSEncMode("require")
+)
+
+var gssEncModes = []GSSEncMode{GSSEncModeDisable, GSSEncModePrefer, GSSEncModeRequire}
+
 // Values for [TargetSessionAttrs] that pq supports.
 const (
 	// Any successful connection is acceptable. This is the default.
@@ -142,6 +168,22 @@ const (
 
 var loadBalanceHosts = []LoadBalanceHosts{LoadBalanceHostsDisable, LoadBalanceHostsRandom}
 
+// Values for [Replication] that pq supports.
+const (
+	// Regular connection. This is the default.
+	ReplicationOff = Replication("false")
+
+	// Physical replication connection, which can't run SQL queries and isn't
+	// tied to a database.
+	ReplicationPhysical = Replication("true")
+
+	// Logical replication connection to the database in dbname, which can run
+	// SQL queries as well as replication commands.
+	ReplicationDatabase = Replication("database")
+)
+
+var replications = []Replication{ReplicationOff, ReplicationPhysical, ReplicationDatabase}
+
 // Values for [ProtocolVersion] that pq supports.
 const (
 	// ProtocolVersion30 is the default protocol version, supported in
@@ -197,17 +239,17 @@ const (
 	RequireAuthNotMD5         = RequireAuth("!md5")
 	RequireAuthNotGSS         = RequireAuth("!gss")
 	RequireAuthNotScramSHA256 = RequireAuth("!scram-sha-256")
+	RequireAuthOAuth          = RequireAuth("oauth")
+	RequireAuthNotOAuth       = RequireAuth("!oauth")
 
 	// Not (yet) supported by pq
 	// RequireAuthSSPI           = "sspi"
-	// RequireAuthOAuth          = "oauth"
 	// RequireAuthNotSSPI        = "!sspi"
-	// RequireAuthNotOAuth       = "!oauth"
 )
 
 var requireAuths = []RequireAuth{RequireAuthNone, RequireAuthPassword, RequireAuthMD5,
-	RequireAuthGSS, RequireAuthScramSHA256, RequireAuthAny, RequireAuthNotPassword,
-	RequireAuthNotMD5, RequireAuthNotGSS, RequireAuthNotScramSHA256}
+	RequireAuthGSS, RequireAuthScramSHA256, RequireAuthOAuth, RequireAuthAny, RequireAuthNotPassword,
+	RequireAuthNotMD5, RequireAuthNotGSS, RequireAuthNotScramSHA256, RequireAuthNotOAuth}
 
 func (r RequireAuths) String() string {
 	var b strings.Builder
@@ -220,12 +262,42 @@ func (r RequireAuths) String() string {
 	return b.String()
 }
 
+// allows reports if the authentication method m is allowed.
+func (r RequireAuths) allows(m RequireAuth) bool {
+	if len(r) == 0 {
+		return true
+	}
+	if strings.HasPrefix(string(r[0]), "!") {
+		return !slices.Contains(r, "!"+m)
+	}
+	return slices.Contains(r, m)
+}
+
+// Values for [ChannelBinding] that pq supports.
+const (
+	// Don't use channel binding.
+	ChannelBindingDisable = ChannelBinding("disable")
+
+	// Use channel binding if the connection uses SSL and the server supports
+	// it. This is the default.
+	ChannelBindingPrefer = ChannelBinding("prefer")
+
+	// Require channel binding.
+	ChannelBindingRequire = ChannelBinding("require")
+)
+
+var channelBindings = []ChannelBinding{ChannelBindingDisable, ChannelBindingPrefer, ChannelBindingRequire}
+
 // Connector represents a fixed configuration for the pq driver with a given
 // dsn. Connector satisfies the [database/sql/driver.Connector] interface and
 // can be used to create any number of DB Conn's via [sql.OpenDB].
 type Connector struct {
-	cfg    Config
-	dialer Dialer
+	cfg           Config
+	dialer        Dialer
+	tokenProvider TokenProvider
+	sslPassword   SSLPasswordProvider
+	tracer        Tracer
+	protoTrace    *protoTrace
 }
 
 // NewConnector returns a connector for the pq driver in a fixed configuration
@@ -255,6 +327,34 @@ func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) { return c
 // Dialer allows change the dialer used to open connections.
 func (c *Connector) Dialer(dialer Dialer) { c.dialer = dialer }
 
+// TokenProvider sets the function to get OAuth bearer tokens with, for servers
+// that use OAUTHBEARER authentication.
+func (c *Connector) TokenProvider(p TokenProvider) { c.tokenProvider = p }
+
+// SSLPasswordProvider sets the function to get the password for an encrypted
+// SSL key with, if sslpassword isn't set.
+func (c *Connector) SSLPasswordProvider(p SSLPasswordProvider) { c.sslPassword = p }
+
+// Tracer sets the tracer for connections opened with this Connector.
+func (c *Connector) Tracer(t Tracer) { c.tracer = t }
+
+// ProtocolTrace logs all protocol messages exchanged with the server to w,
+// similar to PQtrace() in libpq. This is intended for debugging problems with
+// the server or with poolers and proxies in between; a nil w disables it.
+//
+// Every message is logged on one line with the time, the direction (F for
+// messages sent to the server, B for messages received from the server), the
+// length, the message type, and a summary of the contents. Passwords, SASL
+// messages, and cancellation keys are redacted, and the values of parameters
+// and rows aren't logged. w can be shared between connections; every line is
+// written with a single Write call.
+func (c *Connector) ProtocolTrace(w io.Writer) {
+	c.protoTrace = nil
+	if w != nil {
+		c.protoTrace = &protoTrace{w: w, now: time.Now}
+	}
+}
+
 // Driver returns the underlying driver of this Connector.
 func (c *Connector) Driver() driver.Driver { return &Driver{} }
 
@@ -335,6 +435,14 @@ type Config struct {
 	// Commandline options to send to the server at connection start.
 	Options string `postgres:"options" env:"PGOPTIONS"`
 
+	// Open a replication connection rather than a regular one. Accepts the
+	// same values as libpq: "true", "on", "yes", and "1" for physical
+	// replication, "database" for logical replication, and "false", "off",
+	// "no", and "0" for a regular connection.
+	//
+	// This is usually set by [NewReplicationConn], rather than directly.
+	Replication Replication `postgres:"replication" env:"-"`
+
 	// Application name, displayed in pg_stat_activity and log entries.
 	ApplicationName string `postgres:"application_name" env:"PGAPPNAME"`
 
@@ -355,14 +463,28 @@ type Config struct {
 
 	// Path to client SSL certificate. The file must contain PEM encoded data.
 	//
+	// Files with a .p12 or .pfx extension are loaded as a PKCS #12 file with
+	// both the certificate and key, in which case sslkey is ignored. This is a
+	// pq extension, not supported in libpq.
+	//
 	// Defaults to ~/.postgresql/postgresql.crt
 	SSLCert string `postgres:"sslcert" env:"PGSSLCERT"`
 
-	// Path to secret key for sslcert. The file must contain PEM encoded data.
+	// Path to secret key for sslcert. The file must contain PEM encoded data,
+	// which may be encrypted with sslpassword.
 	//
 	// Defaults to ~/.postgresql/postgresql.key
 	SSLKey string `postgres:"sslkey" env:"PGSSLKEY"`
 
+	// Password for sslkey if it's encrypted, either as PKCS #8 ("ENCRYPTED
+	// PRIVATE KEY") or with the legacy OpenSSL encryption ("Proc-Type:
+	// 4,ENCRYPTED"), or for a PKCS #12 file in sslcert. Ignored if the key isn't
+	// encrypted.
+	//
+	// [Connector.SSLPasswordProvider] can be used to get the password at
+	// runtime instead.
+	SSLPassword string `postgres:"sslpassword" env:"-"`
+
 	// Path to root certificate. The file must contain PEM encoded data.
 	//
 	// The special value "system" can be used to load the system's root
@@ -374,6 +496,20 @@ type Config struct {
 	// Defaults to ~/.postgresql/root.crt.
 	SSLRootCert string `postgres:"sslrootcert" env:"PGSSLROOTCERT"`
 
+	// Path to a file with SSL certificate revocation lists (CRLs), in either PEM
+	// or DER format. Server certificates on a list are rejected with
+	// sslmode=verify-ca or verify-full, in which case every certificate in the
+	// chain other than the root must have a CRL from its issuer.
+	//
+	// Defaults to ~/.postgresql/root.crl if neither sslcrl nor sslcrldir are
+	// set.
+	SSLCRL string `postgres:"sslcrl" env:"PGSSLCRL"`
+
+	// Path to a directory with SSL certificate revocation lists, as prepared by
+	// "openssl rehash". CRLs are looked up by the hash of the issuer name, and
+	// are used in addition to sslcrl.
+	SSLCRLDir string `postgres:"sslcrldir" env:"PGSSLCRLDIR"`
+
 	// By default SNI is on, any value which is not starting with "1" disables
 	// SNI.
 	SSLSNI bool `postgres:"sslsni" env:"PGSSLSNI"`
@@ -395,6 +531,15 @@ type Config struct {
 	// PEM file. This is a pq extension, not supported in libpq.
 	SSLInline bool `postgres:"sslinline" env:"-"`
 
+	// Whether to use GSSAPI transport encryption. If used the connection is
+	// encrypted with GSSAPI rather than SSL, regardless of sslmode.
+	//
+	// This requires a provider registered with [RegisterGSSProvider] that
+	// implements [GSSEncrypter]; with the default of "prefer" GSSAPI
+	// encryption is only tried if there is such a provider. The provider from
+	// auth/kerberos doesn't implement GSSEncrypter.
+	GSSEncMode GSSEncMode `postgres:"gssencmode" env:"PGGSSENCMODE"`
+
 	// GSS (Kerberos) service name when constructing the SPN (default is
 	// postgres). This will be combined with the host to form the full SPN:
 	// krbsrvname/host.
@@ -408,6 +553,39 @@ type Config struct {
 	// specified means wait indefinitely
 	ConnectTimeout time.Duration `postgres:"connect_timeout" env:"PGCONNECT_TIMEOUT"`
 
+	// Keep the connection open when a query is cancelled because its context
+	// is done, and wait this long (in seconds) for the server to cancel the
+	// query and finish the response. The connection is closed if that takes
+	// longer. Zero or not specified closes the connection right away. This is
+	// a pq extension, not supported in libpq.
+	CancelGracePeriod time.Duration `postgres:"cancel_grace_period" env:"-"`
+
+	// Maximum time to wait while sending a request to cancel a query, in
+	// seconds. Zero or not specified uses connect_timeout, or 10 seconds if
+	// that's not set either. This is a pq extension, not supported in libpq.
+	CancelTimeout time.Duration `postgres:"cancel_timeout" env:"-"`
+
+	// Set statement_timeout to the time left until the context deadline for
+	// queries, so the server aborts the query when the deadline passes, even if
+	// the client has gone away. This is done with SET LOCAL in transactions and
+	// SET outside transactions, which is sent in the same round trip as the
+	// query. statement_timeout is reset to the default (like RESET) before
+	// anything else is run on the connection, including transactions,
+	// pipelines, and large object calls, and when the connection is reused
+	// from the pool. It shouldn't be changed with SET when this is enabled; use
+	// the statement_timeout runtime parameter instead. This is ignored for
+	// [ReplicationConn].
+	//
+	// No CancelRequest is sent when the deadline passes; the query fails with
+	// the query_canceled (57014) error from the server and the connection can
+	// still be used. The connection is closed if the server doesn't respond
+	// within cancel_grace_period, or one second if that's shorter. A
+	// CancelRequest is still sent for a context that statement_timeout wasn't
+	// set for, such as the one passed to BeginTx, or if the deadline is more
+	// than about 24 days away (the maximum for statement_timeout). This is a pq
+	// extension, not supported in libpq.
+	DeadlineStatementTimeout bool `postgres:"deadline_statement_timeout" env:"-"`
+
 	// Whether to always send []byte parameters over as binary. Enables single
 	// round-trip mode for non-prepared Query calls. This is a pq extension, not
 	// supported in libpq.
@@ -418,6 +596,30 @@ type Config struct {
 	// pq extension, not supported in libpq.
 	DisablePreparedBinaryResult bool `postgres:"disable_prepared_binary_result" env:"-"`
 
+	// Number of prepared statements to cache per connection. Queries with
+	// parameters use a cached named prepared statement, instead of parsing the
+	// query again for every call. The least recently used statement is closed
+	// if the cache is full. 0 (the default) disables the cache. The cache isn't
+	// used with binary_parameters. This is a pq extension, not supported in
+	// libpq.
+	StatementCacheCapacity int `postgres:"statement_cache_capacity" env:"-"`
+
+	// Number of rows to fetch at a time for queries; the next rows are fetched
+	// from the server when they're read with Rows.Next. 0 (the default)
+	// fetches all rows at once. This can be set per query with
+	// [WithFetchSize]. Queries without parameters use the extended query
+	// protocol if this is set, so can only contain a single statement. This is
+	// a pq extension, not supported in libpq.
+	FetchSize int `postgres:"fetch_size" env:"-"`
+
+	// Rewrite @name and :name placeholders to $1, $2, etc. in statements
+	// prepared with Prepare, so they can be executed with named arguments from
+	// [sql.Named]. Queries run with Query or Exec are always rewritten if they
+	// have named arguments. This isn't the default as the placeholders are
+	// ambiguous with the prefix @ operator and array slices. This is a pq
+	// extension, not supported in libpq.
+	NamedPlaceholders bool `postgres:"named_placeholders" env:"-"`
+
 	// Client encoding; pq only supports UTF8 and this must be blank or "UTF8".
 	ClientEncoding string `postgres:"client_encoding" env:"PGCLIENTENCODING"`
 
@@ -491,6 +693,25 @@ type Config struct {
 	// to skip authentication altogether.
 	RequireAuth RequireAuths `postgres:"require_auth" env:"PGREQUIREAUTH"`
 
+	// Issuer identifier or discovery URI of the OAuth authorization server,
+	// for OAUTHBEARER authentication; this must match the issuer the server
+	// is configured with. Tokens are retrieved with the function set with
+	// [Connector.TokenProvider].
+	OAuthIssuer string `postgres:"oauth_issuer" env:"-"`
+
+	// OAuth scope to request a token for. If not set, the server is asked
+	// which scope to use, which needs an extra connection.
+	OAuthScope string `postgres:"oauth_scope" env:"-"`
+
+	// Whether to use channel binding with SCRAM-SHA-256-PLUS authentication,
+	// which binds the authentication to the SSL connection to prevent
+	// man-in-the-middle attacks.
+	//
+	// With "require" the connection fails unless the server authenticates with
+	// SCRAM-SHA-256-PLUS over SSL, even with sslmode=require which doesn't
+	// verify the server certificate.
+	ChannelBinding ChannelBinding `postgres:"channel_binding" env:"PGCHANNELBINDING"`
+
 	// Runtime parameters: any unrecognized parameter in the DSN will be added
 	// to this and sent to PostgreSQL during startup.
 	Runtime map[string]string `postgres:"-" env:"-"`
@@ -696,6 +917,16 @@ func newConfig(dsn string, env []string) (Config, error) {
 				cfg.SSLMode)
 		}
 	}
+	if cfg.ChannelBinding == ChannelBindingRequire {
+		if cfg.SSLMode == SSLModeDisable {
+			return Config{}, errors.New(`pq: channel_binding=require may not be used with sslmode=disable`)
+		}
+		if !cfg.RequireAuth.allows(RequireAuthScramSHA256) {
+			return Config{}, fmt.Errorf(
+				`pq: channel_binding=require may not be used with require_auth=%s (channel binding requires scram-sha-256)`,
+				cfg.RequireAuth)
+		}
+	}
 	if cfg.SSLRootCert == "system" {
 		if !cfg.isset("sslmode") {
 			cfg.SSLMode = SSLModeVerifyFull
@@ -732,8 +963,7 @@ func (cfg *Config) fromEnv(env []string) error {
 		}
 		switch k {
 		case "PGREQUIRESSL", "PGSSLCOMPRESSION", // Deprecated.
-			"PGREALM", "PGGSSENCMODE", "PGGSSDELEGATION", "PGGSSLIB", // krb stuff
-			"PGCHANNELBINDING", "PGSSLCRL", "PGSSLCRLDIR",
+			"PGREALM", "PGGSSDELEGATION", "PGGSSLIB", // krb stuff
 			"PGSSLCERTMODE", "PGREQUIREPEER":
 			return fmt.Errorf("pq: environment variable $%s is not supported", k)
 		case "PGKRBSRVNAME":
@@ -884,12 +1114,12 @@ func (cfg *Config) setFromTag(o map[string]string, tag string, service bool) err
 			rt                    = types.Field(i)
 			rv                    = values.Field(i)
 			k                     = rt.Tag.Get(tag)
-			connectTimeout        = (tag == "postgres" && k == "connect_timeout") || (tag == "env" && k == "PGCONNECT_TIMEOUT")
 			host                  = (tag == "postgres" && k == "host") || (tag == "env" && k == "PGHOST")
 			hostaddr              = (tag == "postgres" && k == "hostaddr") || (tag == "env" && k == "PGHOSTADDR")
 			port                  = (tag == "postgres" && k == "port") || (tag == "env" && k == "PGPORT")
 			sslmode               = (tag == "postgres" && k == "sslmode") || (tag == "env" && k == "PGSSLMODE")
 			sslnegotiation        = (tag == "postgres" && k == "sslnegotiation") || (tag == "env" && k == "PGSSLNEGOTIATION")
+			gssencmode            = (tag == "postgres" && k == "gssencmode") || (tag == "env" && k == "PGGSSENCMODE")
 			targetsessionattrs    = (tag == "postgres" && k == "target_session_attrs") || (tag == "env" && k == "PGTARGETSESSIONATTRS")
 			loadbalancehosts      = (tag == "postgres" && k == "load_balance_hosts") || (tag == "env" && k == "PGLOADBALANCEHOSTS")
 			minprotocolversion    = (tag == "postgres" && k == "min_protocol_version") || (tag == "env" && k == "PGMINPROTOCOLVERSION")
@@ -897,6 +1127,8 @@ func (cfg *Config) setFromTag(o map[string]string, tag string, service bool) err
 			sslminprotocolversion = (tag == "postgres" && k == "ssl_min_protocol_version") || (tag == "env" && k == "PGSSLMINPROTOCOLVERSION")
 			sslmaxprotocolversion = (tag == "postgres" && k == "ssl_max_protocol_version") || (tag == "env" && k == "PGSSLMAXPROTOCOLVERSION")
 			requireauth           = (tag == "postgres" && k == "require_auth") || (tag == "env" && k == "PGREQUIREAUTH")
+			channelbinding        = (tag == "postgres" && k == "channel_binding") || (tag == "env" && k == "PGCHANNELBINDING")
+			replication           = tag == "postgres" && k == "replication"
 		)
 		if k == "" || k == "-" {
 			continue
@@ -947,6 +1179,12 @@ func (cfg *Config) setFromTag(o map[string]string, tag string, service bool) err
 				if sslnegotiation && !slices.Contains(sslNegotiations, SSLNegotiation(v)) {
 					return fmt.Errorf(f+`%q is not supported; supported values are %s`, k, v, pqutil.Join(sslNegotiations))
 				}
+				if gssencmode && !slices.Contains(gssEncModes, GSSEncMode(v)) {
+					return fmt.Errorf(f+`%q is not supported; supported values are %s`, k, v, pqutil.Join(gssEncModes))
+				}
+				if channelbinding && !slices.Contains(channelBindings, ChannelBinding(v)) {
+					return fmt.Errorf(f+`%q is not supported; supported values are %s`, k, v, pqutil.Join(channelBindings))
+				}
 				if targetsessionattrs && !slices.Contains(targetSessionAttrs, TargetSessionAttrs(v)) {
 					return fmt.Errorf(f+`%q is not supported; supported values are %s`, k, v, pqutil.Join(targetSessionAttrs))
 				}
@@ -959,6 +1197,17 @@ func (cfg *Config) setFromTag(o map[string]string, tag string, service bool) err
 				if (sslminprotocolversion || sslmaxprotocolversion) && !slices.Contains(sslProtocolVersions, SSLProtocolVersion(v)) {
 					return fmt.Errorf(f+`%q is not supported; supported values are %s`, k, v, pqutil.Join(sslProtocolVersions))
 				}
+				if replication {
+					switch v {
+					case "on", "yes", "1":
+						v = string(ReplicationPhysical)
+					case "off", "no", "0":
+						v = string(ReplicationOff)
+					}
+					if !slices.Contains(replications, Replication(v)) {
+						return fmt.Errorf(f+`%q is not supported; supported values are %s`, k, v, pqutil.Join(replications))
+					}
+				}
 				if host {
 					vv := strings.Split(v, ",")
 					v = vv[0]
@@ -1000,10 +1249,19 @@ func (cfg *Config) setFromTag(o map[string]string, tag string, service bool) err
 				if err != nil {
 					return fmt.Errorf(f+"%w", k, err)
 				}
-				if connectTimeout {
+				if rt.Type == reflect.TypeFor[time.Duration]() { // In seconds.
 					n = int64(time.Duration(n) * time.Second)
 				}
 				rv.SetInt(n)
+			case reflect.Int:
+				n, err := strconv.ParseInt(v, 10, 0)
+				if err != nil {
+					return fmt.Errorf(f+"%w", k, err)
+				}
+				if n < 0 {
+					return fmt.Errorf(f+"must be 0 or greater", k)
+				}
+				rv.SetInt(n)
 			case reflect.Uint16:
 				if port {
 					vv := strings.Split(v, ",")
@@ -1084,12 +1342,14 @@ func (cfg Config) tomap() map[string]string {
 				} else {
 					o[k] = rv.String()
 				}
+			case reflect.Int:
+				o[k] = strconv.FormatInt(rv.Int(), 10)
 			case reflect.Uint16:
 				n := rv.Uint()
 				o[k] = strconv.FormatUint(n, 10)
 			case reflect.Int64:
 				n := rv.Int()
-				if k == "connect_timeout" {
+				if rv.Type() == reflect.TypeFor[time.Duration]() {
 					n = int64(time.Duration(n) / time.Second)
 				}
 				o[k] = strconv.FormatInt(n, 10)
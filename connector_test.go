@@ -365,6 +365,10 @@ func TestNewConfig(t *testing.T) {
 		{"", []string{"PGCONNECT_TIMEOUT=5"}, "connect_timeout=5", ""},
 		{"connect_timeout=5s", nil, "", `pq: wrong value for "connect_timeout": strconv.ParseInt: parsing "5s": invalid syntax`},
 		{"", []string{"PGCONNECT_TIMEOUT=5s"}, "", `pq: wrong value for $PGCONNECT_TIMEOUT: strconv.ParseInt: parsing "5s": invalid syntax`},
+		{"cancel_grace_period=2", nil, "cancel_grace_period=2", ""},
+		{"cancel_timeout=3", nil, "cancel_timeout=3", ""},
+		{"deadline_statement_timeout=1", nil, "deadline_statement_timeout=yes", ""},
+		{"named_placeholders=1", nil, "named_placeholders=yes", ""},
 		{"port=5s", nil, "", `pq: wrong value for "port": strconv.ParseUint: parsing "5s": invalid syntax`},
 		{"", []string{"PGPORT=5s"}, "", `pq: wrong value for $PGPORT: strconv.ParseUint: parsing "5s": invalid syntax`},
 		{"host=a,b port=1,a", nil, "", `strconv.ParseUint: parsing "a": invalid syntax`},
@@ -403,6 +407,8 @@ func TestNewConfig(t *testing.T) {
 		{"postgres://u:pw@example.com:1/db?sslmode=sslmeharder", nil, "", `pq: wrong value for "sslmode"`},
 		{"", []string{"PGSSLMODE=sslmeharder"}, "", `pq: wrong value for $PGSSLMODE`},
 		{"sslnegotiation=sslmeharder", nil, "", `pq: wrong value for "sslnegotiation"`},
+		{"gssencmode=allow", nil, "", `pq: wrong value for "gssencmode"`},
+		{"channel_binding=always", nil, "", `pq: wrong value for "channel_binding"`},
 		{"postgres://u:pw@example.com:1/db?sslnegotiation=sslmeharder", nil, "", `pq: wrong value for "sslnegotiation"`},
 		{"", []string{"PGSSLNEGOTIATION=sslmeharder"}, "", `pq: wrong value for $PGSSLNEGOTIATION`},
 
@@ -444,6 +450,31 @@ func TestNewConfig(t *testing.T) {
 		{"require_auth=!md5,!scram-sha-256", nil, "require_auth=!md5,!scram-sha-256", ""},
 		{"require_auth=md5,!password", nil, "", `negative require_auth method "!password" cannot be mixed with non-negative methods`},
 		{"require_auth=!md5,password", nil, "", `require_auth method "password" cannot be mixed with negative methods`},
+
+		// replication
+		{"replication=database", nil, "replication=database", ""},
+		{"replication=true", nil, "replication=true", ""},
+		{"replication=on", nil, "replication=true", ""},
+		{"replication=0", nil, "replication=false", ""},
+		{"replication=logical", nil, "", `pq: wrong value for "replication": "logical" is not supported`},
+		{"statement_cache_capacity=512", nil, "statement_cache_capacity=512", ""},
+		{"statement_cache_capacity=-1", nil, "", `pq: wrong value for "statement_cache_capacity": must be 0 or greater`},
+		{"statement_cache_capacity=x", nil, "", `pq: wrong value for "statement_cache_capacity": strconv.ParseInt: parsing "x": invalid syntax`},
+		{"fetch_size=100", nil, "fetch_size=100", ""},
+		{"gssencmode=require", nil, "gssencmode=require", ""},
+		{"", []string{"PGGSSENCMODE=disable"}, "gssencmode=disable", ""},
+		{"channel_binding=require", nil, "channel_binding=require", ""},
+		{"oauth_issuer=https://idp.example.com oauth_scope='openid db' require_auth=oauth", nil,
+			"oauth_issuer=https://idp.example.com oauth_scope='openid db' require_auth=oauth", ""},
+		{"", []string{"PGCHANNELBINDING=disable"}, "channel_binding=disable", ""},
+		{"channel_binding=require sslmode=disable", nil, "", `pq: channel_binding=require may not be used with sslmode=disable`},
+		{"channel_binding=require require_auth=md5", nil, "", `pq: channel_binding=require may not be used with require_auth=md5`},
+		{"channel_binding=require require_auth=!scram-sha-256", nil, "", `pq: channel_binding=require may not be used with require_auth=!scram-sha-256`},
+		{"sslcrl=/crl/root.crl sslcrldir=/crl", nil, "sslcrl=/crl/root.crl sslcrldir=/crl", ""},
+		{"", []string{"PGSSLCRL=/crl/root.crl", "PGSSLCRLDIR=/crl"}, "sslcrl=/crl/root.crl sslcrldir=/crl", ""},
+		{"sslpassword=secret", nil, "sslpassword=secret", ""},
+		{"channel_binding=require require_auth=!md5", nil, "channel_binding=require require_auth=!md5", ""},
+		{"fetch_size=-1", nil, "", `pq: wrong value for "fetch_size": must be 0 or greater`},
 	}
 
 	t.Parallel()
@@ -459,7 +490,7 @@ func TestNewConfig(t *testing.T) {
 		})
 	}
 
-	// Make sure connect_timeout is parsed as seconds.
+	// Make sure connect_timeout and cancel_grace_period are parsed as seconds.
 	t.Run("connect_timeout", func(t *testing.T) {
 		{
 			have, err := newConfig("connect_timeout=3", []string{})
@@ -479,6 +510,15 @@ func TestNewConfig(t *testing.T) {
 				t.Errorf("\nhave: %q\nwant: %q", have.ConnectTimeout, 4*time.Second)
 			}
 		}
+		{
+			have, err := newConfig("cancel_grace_period=2", []string{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have.CancelGracePeriod != 2*time.Second {
+				t.Errorf("\nhave: %q\nwant: %q", have.CancelGracePeriod, 2*time.Second)
+			}
+		}
 	})
 }
 
@@ -6,26 +6,38 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 
+	"github.com/lib/pq/internal/pqsql"
 	"github.com/lib/pq/internal/proto"
+	"github.com/lib/pq/oid"
 )
 
 var (
-	errCopyInClosed               = errors.New("pq: copyin statement has already been closed")
-	errBinaryCopyNotSupported     = errors.New("pq: only text format supported for COPY")
-	errCopyToNotSupported         = errors.New("pq: COPY TO is not supported")
-	errCopyNotSupportedOutsideTxn = errors.New("pq: COPY is only allowed inside a transaction")
+	errCopyInClosed       = errors.New("pq: copyin statement has already been closed")
+	errBinaryCopyColumns  = errors.New("pq: could not determine the column types for binary COPY")
+	errCopyToNotSupported = errors.New("pq: COPY TO is not supported with Prepare; use CopyTo()")
+	errCopyInProgress     = errors.New("pq: COPY FROM STDIN in progress; call Exec() without arguments to finish it")
+	errCopyInReleased     = errors.New("pq: COPY FROM STDIN aborted as the connection was returned to the pool; prepare it on a sql.Conn or sql.Tx")
+	errNotCopyTo          = errors.New("pq: CopyTo can only be used with COPY TO STDOUT")
+	errNotCopyFrom        = errors.New("pq: CopyFrom can only be used with COPY FROM STDIN")
 )
 
 type copyin struct {
-	cn      *conn
-	buffer  []byte
-	rowData chan []byte
-	done    chan bool
-	closed  bool
-	mu      struct {
+	cn       *conn
+	buffer   []byte
+	rowData  chan []byte
+	done     chan bool
+	closed   bool
+	released bool      // Returned to the pool unfinished; aborted instead of committed on Close.
+	binary   bool      // Binary format, with a row encoded per colTyps.
+	colTyps  []oid.Oid // Column types for binary format.
+	trace    traceEnd
+	mu       struct {
 		sync.Mutex
 		err error
 		driver.Result
@@ -38,11 +50,10 @@ const (
 	ciBufferFlushSize = 63 * 1024
 )
 
+// prepareCopyIn starts a COPY FROM STDIN. This doesn't need a transaction: the
+// connection stays in the COPY state until the copyin is closed, after which
+// the server commits the implicit transaction (if any) and it's idle again.
 func (cn *conn) prepareCopyIn(q string) (_ driver.Stmt, resErr error) {
-	if !cn.isInTransaction() {
-		return nil, errCopyNotSupportedOutsideTxn
-	}
-
 	ci := &copyin{
 		cn:      cn,
 		buffer:  make([]byte, 0, ciBufferSize),
@@ -52,6 +63,27 @@ func (cn *conn) prepareCopyIn(q string) (_ driver.Stmt, resErr error) {
 	// add CopyData identifier + 4 bytes for message length
 	ci.buffer = append(ci.buffer, byte(proto.CopyDataRequest), 0, 0, 0, 0)
 
+	// The binary format needs the column types to encode the values, which we
+	// get from pg_attribute, or by preparing a query for the listed columns.
+	if cp, ok := pqsql.ParseCopyFrom(q); ok && cp.Binary {
+		if cp.Columns == "" {
+			var err error
+			ci.colTyps, err = cn.copyColumnTypes(cp.Table)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			st, err := cn.prepareTo("select "+cp.Columns+" from "+cp.Table+" limit 0", "")
+			if err != nil {
+				return nil, err
+			}
+			ci.colTyps = make([]oid.Oid, len(st.colTyps))
+			for i := range st.colTyps {
+				ci.colTyps[i] = st.colTyps[i].OID
+			}
+		}
+	}
+
 	b := cn.writeBuf(proto.Query)
 	b.string(q)
 	err := cn.send(b)
@@ -68,9 +100,16 @@ awaitCopyInResponse:
 		switch t {
 		case proto.CopyInResponse:
 			if r.byte() != 0 {
-				resErr = errBinaryCopyNotSupported
-				break awaitCopyInResponse
+				if ci.colTyps == nil || r.int16() != len(ci.colTyps) {
+					resErr = errBinaryCopyColumns
+					break awaitCopyInResponse
+				}
+				// Signature, flags, and header extension length.
+				ci.binary = true
+				ci.buffer = append(ci.buffer, "PGCOPY\n\xff\r\n\x00"...)
+				ci.buffer = append(ci.buffer, 0, 0, 0, 0, 0, 0, 0, 0)
 			}
+			cn.busy, cn.copyIn = errCopyInProgress, ci
 			go ci.resploop()
 			return ci, nil
 		case proto.CopyOutResponse:
@@ -118,6 +157,41 @@ awaitCopyInResponse:
 	}
 }
 
+// copyColumnTypes gets the types of the columns that COPY uses without a
+// column list, which are all columns except generated ones. "select *" can't
+// be used for this, as that includes generated columns.
+func (cn *conn) copyColumnTypes(table string) ([]oid.Oid, error) {
+	q := "select atttypid::int8 from pg_attribute where attrelid = " + QuoteLiteral(table) +
+		"::regclass and attnum > 0 and not attisdropped"
+	if cn.parameterStatus.serverVersion >= 120000 { // Generated columns were added in 12.
+		q += " and attgenerated = ''"
+	}
+	res, err := cn.simpleQuery(q + " order by attnum")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var (
+		typs []oid.Oid
+		v    = make([]driver.Value, 1)
+	)
+	for {
+		err := res.Next(v)
+		if err == io.EOF {
+			return typs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		typ, ok := v[0].(int64)
+		if !ok {
+			return nil, fmt.Errorf("pq: unexpected type %T for column type", v[0])
+		}
+		typs = append(typs, oid.Oid(typ))
+	}
+}
+
 func (ci *copyin) flush(buf []byte) error {
 	if len(buf)-1 > proto.MaxUint32 {
 		return errors.New("pq: too many columns")
@@ -126,6 +200,7 @@ func (ci *copyin) flush(buf []byte) error {
 		fmt.Fprintf(os.Stderr, "CLIENT → %-20s %5d  %q\n", proto.RequestCode(buf[0]), len(buf)-5, buf[5:])
 	}
 	binary.BigEndian.PutUint32(buf[1:], uint32(len(buf)-1)) // Set message length (without message identifier).
+	ci.cn.protoTrace.frontend(buf)
 	_, err := ci.cn.c.Write(buf)
 	return err
 }
@@ -226,6 +301,9 @@ func (ci *copyin) Query(v []driver.Value) (r driver.Rows, err error) {
 // to the user.
 func (ci *copyin) Exec(v []driver.Value) (driver.Result, error) {
 	if ci.closed {
+		if ci.released {
+			return nil, errCopyInReleased
+		}
 		return nil, errCopyInClosed
 	}
 	if err := ci.getBad(); err != nil {
@@ -242,6 +320,29 @@ func (ci *copyin) Exec(v []driver.Value) (driver.Result, error) {
 		return ci.getResult(), nil
 	}
 
+	if ci.binary {
+		if err := ci.appendBinaryRow(v); err != nil {
+			return nil, ci.cn.handleError(err)
+		}
+	} else {
+		if err := ci.appendTextRow(v); err != nil {
+			return nil, ci.cn.handleError(err)
+		}
+	}
+
+	if len(ci.buffer) > ciBufferFlushSize {
+		err := ci.flush(ci.buffer)
+		if err != nil {
+			return nil, ci.cn.handleError(err)
+		}
+		// reset buffer, keep bytes for message identifier and length
+		ci.buffer = ci.buffer[:5]
+	}
+
+	return driver.RowsAffected(0), nil
+}
+
+func (ci *copyin) appendTextRow(v []driver.Value) error {
 	var (
 		numValues = len(v)
 		err       error
@@ -249,25 +350,43 @@ func (ci *copyin) Exec(v []driver.Value) (driver.Result, error) {
 	for i, value := range v {
 		ci.buffer, err = appendEncodedText(ci.buffer, value)
 		if err != nil {
-			return nil, ci.cn.handleError(err)
+			return err
 		}
 		if i < numValues-1 {
 			ci.buffer = append(ci.buffer, '\t')
 		}
 	}
-
 	ci.buffer = append(ci.buffer, '\n')
+	return nil
+}
 
-	if len(ci.buffer) > ciBufferFlushSize {
-		err := ci.flush(ci.buffer)
+// appendBinaryRow appends a row in the binary format: the number of fields,
+// followed by the length and value for every field. The buffer is left
+// unchanged on errors, so the COPY can continue with the next row.
+func (ci *copyin) appendBinaryRow(v []driver.Value) error {
+	if len(v) != len(ci.colTyps) {
+		return fmt.Errorf("pq: got %d values for binary COPY, but the table has %d columns", len(v), len(ci.colTyps))
+	}
+	var (
+		start = len(ci.buffer)
+		err   error
+	)
+	ci.buffer = binary.BigEndian.AppendUint16(ci.buffer, uint16(len(v)))
+	for i, value := range v {
+		if value == nil {
+			ci.buffer = binary.BigEndian.AppendUint32(ci.buffer, 0xffffffff) // -1
+			continue
+		}
+		l := len(ci.buffer)
+		ci.buffer = append(ci.buffer, 0, 0, 0, 0)
+		ci.buffer, err = appendBinary(ci.buffer, value, ci.colTyps[i])
 		if err != nil {
-			return nil, ci.cn.handleError(err)
+			ci.buffer = ci.buffer[:start]
+			return err
 		}
-		// reset buffer, keep bytes for message identifier and length
-		ci.buffer = ci.buffer[:5]
+		binary.BigEndian.PutUint32(ci.buffer[l:], uint32(len(ci.buffer)-l-4))
 	}
-
-	return driver.RowsAffected(0), nil
+	return nil
 }
 
 // CopyData inserts a raw string into the COPY stream. The insert is
@@ -279,6 +398,9 @@ func (ci *copyin) Exec(v []driver.Value) (driver.Result, error) {
 // to the user.
 func (ci *copyin) CopyData(ctx context.Context, line string) (driver.Result, error) {
 	if ci.closed {
+		if ci.released {
+			return nil, errCopyInReleased
+		}
 		return nil, errCopyInClosed
 	}
 	defer ci.cn.watchCancel(ctx, false)()
@@ -288,6 +410,9 @@ func (ci *copyin) CopyData(ctx context.Context, line string) (driver.Result, err
 	if err := ci.err(); err != nil {
 		return nil, err
 	}
+	if ci.binary {
+		return nil, errors.New("pq: CopyData can't be used with binary COPY")
+	}
 
 	ci.buffer = append(ci.buffer, []byte(line)...)
 	ci.buffer = append(ci.buffer, '\n')
@@ -305,16 +430,26 @@ func (ci *copyin) CopyData(ctx context.Context, line string) (driver.Result, err
 	return driver.RowsAffected(0), nil
 }
 
-func (ci *copyin) Close() error {
+func (ci *copyin) Close() (err error) {
 	if ci.closed { // Don't do anything, we're already closed
 		return nil
 	}
 	ci.closed = true
+	defer func() { ci.cn.busy, ci.cn.copyIn = nil, nil }()
+	if ci.trace != nil {
+		defer func() { ci.trace(ci.getResult(), "COPY", err) }()
+	}
 
 	if err := ci.getBad(); err != nil {
 		return err
 	}
+	if ci.released {
+		return ci.abort()
+	}
 
+	if ci.binary {
+		ci.buffer = append(ci.buffer, 0xff, 0xff) // Trailer.
+	}
 	if len(ci.buffer) > 0 {
 		err := ci.flush(ci.buffer)
 		if err != nil {
@@ -322,7 +457,7 @@ func (ci *copyin) Close() error {
 		}
 	}
 	// Avoid touching the scratch buffer as resploop could be using it.
-	err := ci.cn.sendSimpleMessage(proto.CopyDoneRequest)
+	err = ci.cn.sendSimpleMessage(proto.CopyDoneRequest)
 	if err != nil {
 		return ci.cn.handleError(err)
 	}
@@ -334,3 +469,336 @@ func (ci *copyin) Close() error {
 	}
 	return nil
 }
+
+// abort aborts the COPY with CopyFail, so none of the data is committed.
+func (ci *copyin) abort() error {
+	ci.setError(errCopyInReleased)
+	// Avoid touching the scratch buffer as resploop could be using it.
+	buf := append([]byte{byte(proto.CopyFail), 0, 0, 0, 0}, errCopyInReleased.Error()...)
+	if err := ci.flush(append(buf, 0)); err != nil {
+		return ci.cn.handleError(err)
+	}
+	<-ci.done
+	return nil
+}
+
+// CopyTo runs a "COPY [..] TO STDOUT" query and streams the data to w as it is
+// received from the server. It returns the number of rows copied.
+//
+// The data is written as-is, so the format depends on the options in the query
+// (e.g. text, csv, or binary). If writing to w fails the query is cancelled and
+// the write error is returned once the server has stopped sending data. The
+// query is also cancelled if ctx is cancelled.
+//
+// c must be a pq connection, which can be retrieved with [sql.Conn.Raw]:
+//
+//	c, err := db.Conn(ctx)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer c.Close()
+//
+//	var n int64
+//	err = c.Raw(func(driverConn any) error {
+//		n, err = pq.CopyTo(ctx, driverConn.(driver.Conn), `copy tbl to stdout (format csv)`, w)
+//		return err
+//	})
+func CopyTo(ctx context.Context, c driver.Conn, query string, w io.Writer) (int64, error) {
+	cn, err := asConn(c)
+	if err != nil {
+		return 0, err
+	}
+	defer cn.watchCancel(ctx, false)()
+	if err := cn.err.get(); err != nil {
+		return 0, err
+	}
+
+	end := cn.trace(ctx, traceCopy, TraceData{SQL: query})
+	err = cn.setStatementTimeout(ctx)
+	var n int64
+	if err == nil {
+		n, err = cn.copyTo(query, w)
+	}
+	err = cn.handleError(err, query)
+	end.done(driver.RowsAffected(n), "COPY", err)
+	return n, err
+}
+
+func (cn *conn) copyTo(q string, w io.Writer) (int64, error) {
+	if debugProto {
+		fmt.Fprintln(os.Stderr, "         START conn.copyTo")
+		defer fmt.Fprintln(os.Stderr, "         END conn.copyTo")
+	}
+
+	b := cn.writeBuf(proto.Query)
+	b.string(q)
+	err := cn.send(b)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		n             int64
+		resErr, wrErr error
+		r             readBuf
+		sawCopyOut    bool
+		cancelSent    bool
+	)
+	for {
+		t, err := cn.recv1Buf(&r)
+		if err != nil {
+			return 0, err
+		}
+		switch t {
+		case proto.CopyOutResponse:
+			sawCopyOut = true
+		case proto.CopyDataResponse:
+			if wrErr != nil {
+				continue // Discard the rest while waiting for the cancel.
+			}
+			_, wrErr = w.Write(r)
+			if wrErr != nil && !cancelSent {
+				// There is no way to stop a COPY OUT from the protocol, so ask
+				// the server to cancel the query and drain what's left.
+				cancelSent = true
+				_ = cn.cancel(context.Background())
+			}
+		case proto.CopyDoneResponse:
+		case proto.CommandComplete:
+			res, _, err := cn.parseComplete(r.string())
+			if err != nil {
+				return 0, err
+			}
+			n, _ = res.RowsAffected()
+		case proto.ErrorResponse:
+			resErr = parseError(&r, q)
+		case proto.CopyInResponse:
+			// Wrong direction; abort the COPY FROM and wait for the error.
+			resErr = errNotCopyTo
+			fail := cn.writeBuf(proto.CopyFail)
+			fail.string(resErr.Error())
+			if err := cn.send(fail); err != nil {
+				return 0, err
+			}
+		case proto.RowDescription, proto.DataRow, proto.EmptyQueryResponse:
+			if resErr == nil {
+				resErr = errNotCopyTo
+			}
+		case proto.ReadyForQuery:
+			cn.processReadyForQuery(&r)
+			if wrErr != nil {
+				return 0, wrErr
+			}
+			if resErr != nil {
+				return 0, resErr
+			}
+			if !sawCopyOut {
+				return 0, errNotCopyTo
+			}
+			return n, nil
+		default:
+			cn.err.set(driver.ErrBadConn)
+			return 0, fmt.Errorf("pq: unknown response for COPY TO: %q", t)
+		}
+	}
+}
+
+// CopyFrom runs a "COPY [..] FROM STDIN" query and streams the data from r to
+// the server. It returns the number of rows copied.
+//
+// The data is sent as-is as it's read, so it must already be in the format set
+// in the query (e.g. text, csv, or binary). If reading from r fails or ctx is
+// cancelled the COPY is aborted and the read or context error is returned. ctx
+// is checked between reads; a Read that blocks isn't interrupted.
+// Errors from the server include the line number of the data that failed, if
+// known; use [As] or [errors.As] to get the [Error].
+//
+// c must be a pq connection, which can be retrieved with [sql.Conn.Raw]:
+//
+//	fp, err := os.Open("data.csv")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer fp.Close()
+//
+//	c, err := db.Conn(ctx)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer c.Close()
+//
+//	var n int64
+//	err = c.Raw(func(driverConn any) error {
+//		n, err = pq.CopyFrom(ctx, driverConn.(driver.Conn), `copy tbl from stdin (format csv)`, fp)
+//		return err
+//	})
+func CopyFrom(ctx context.Context, c driver.Conn, query string, r io.Reader) (int64, error) {
+	cn, err := asConn(c)
+	if err != nil {
+		return 0, err
+	}
+	if err := cn.err.get(); err != nil {
+		return 0, err
+	}
+
+	end := cn.trace(ctx, traceCopy, TraceData{SQL: query})
+	err = cn.setStatementTimeout(ctx)
+	var n int64
+	if err == nil {
+		n, err = cn.copyFrom(ctx, query, r)
+	}
+	err = cn.handleError(err, query)
+	end.done(driver.RowsAffected(n), "COPY", err)
+	return n, err
+}
+
+func (cn *conn) copyFrom(ctx context.Context, q string, r io.Reader) (int64, error) {
+	if debugProto {
+		fmt.Fprintln(os.Stderr, "         START conn.copyFrom")
+		defer fmt.Fprintln(os.Stderr, "         END conn.copyFrom")
+	}
+
+	b := cn.writeBuf(proto.Query)
+	b.string(q)
+	err := cn.send(b)
+	if err != nil {
+		return 0, err
+	}
+
+	// Only send a CancelRequest while waiting for the server; if ctx is
+	// cancelled while sending data the COPY is aborted with CopyFail instead.
+	finish := cn.watchCancel(ctx, true)
+	defer func() { finish() }()
+
+	var (
+		n      int64
+		resErr error
+		abort  error // Reader or context error.
+		rb     readBuf
+	)
+	for {
+		t, err := cn.recv1Buf(&rb)
+		if err != nil {
+			return 0, err
+		}
+		switch t {
+		case proto.CopyInResponse:
+			finish()
+			finish = func() {}
+			abort, err = cn.copyFromReader(ctx, r)
+			if err != nil {
+				return 0, err
+			}
+			if abort == nil {
+				finish = cn.watchCancel(ctx, true)
+			}
+		case proto.CopyOutResponse, proto.CopyDataResponse, proto.CopyDoneResponse,
+			proto.RowDescription, proto.DataRow, proto.EmptyQueryResponse:
+			// Wrong kind of query; discard everything and wait for the end.
+			if resErr == nil {
+				resErr = errNotCopyFrom
+			}
+		case proto.CommandComplete:
+			if resErr != nil {
+				continue
+			}
+			res, tag, err := cn.parseComplete(rb.string())
+			if err != nil {
+				return 0, err
+			}
+			if tag != "COPY" {
+				resErr = errNotCopyFrom
+			}
+			n, _ = res.RowsAffected()
+		case proto.ErrorResponse:
+			resErr = parseError(&rb, q)
+		case proto.ReadyForQuery:
+			cn.processReadyForQuery(&rb)
+			if abort != nil {
+				return 0, abort
+			}
+			if resErr != nil {
+				return 0, copyLineErr(resErr)
+			}
+			return n, nil
+		default:
+			cn.err.set(driver.ErrBadConn)
+			return 0, fmt.Errorf("pq: unknown response for COPY FROM: %q", t)
+		}
+	}
+}
+
+// copyFromReader sends all data from r as CopyData messages, followed by
+// CopyDone. The COPY is aborted with CopyFail if reading fails or ctx is
+// cancelled; this error is returned as abort. err is only set for errors
+// writing to the connection.
+//
+// Every Read is sent as soon as it returns, the same as psql, so data from a
+// pipe or socket isn't held back until the buffer is full.
+func (cn *conn) copyFromReader(ctx context.Context, r io.Reader) (abort, err error) {
+	buf := make([]byte, 5+ciBufferSize)
+	buf[0] = byte(proto.CopyDataRequest)
+	for {
+		if abort = ctx.Err(); abort != nil {
+			break
+		}
+		l, rdErr := r.Read(buf[5:])
+		if l > 0 {
+			if debugProto {
+				fmt.Fprintf(os.Stderr, "CLIENT → %-20s %5d  %q\n", proto.CopyDataRequest, l, buf[5:5+l])
+			}
+			binary.BigEndian.PutUint32(buf[1:], uint32(l+4))
+			cn.protoTrace.frontend(buf[:5+l])
+			if _, err := cn.c.Write(buf[:5+l]); err != nil {
+				return nil, err
+			}
+		}
+		if rdErr == io.EOF {
+			return nil, cn.send(cn.writeBuf(proto.CopyDoneRequest))
+		}
+		if rdErr != nil {
+			abort = rdErr
+			break
+		}
+	}
+
+	fail := cn.writeBuf(proto.CopyFail)
+	fail.string(abort.Error())
+	return abort, cn.send(fail)
+}
+
+// copyLineError adds the line number of the COPY data to an Error.
+type copyLineError struct {
+	line int
+	err  *Error
+}
+
+func (e *copyLineError) Error() string {
+	return "pq: line " + strconv.Itoa(e.line) + ": " + strings.TrimPrefix(e.err.Error(), "pq: ")
+}
+
+func (e *copyLineError) Unwrap() error { return e.err }
+
+// copyLineErr adds the line number to err if it's a pq Error with a COPY
+// context, which looks like:
+//
+//	COPY tbl, line 2, column num: "x"
+func copyLineErr(err error) error {
+	pqErr, ok := err.(*Error)
+	if !ok || !strings.HasPrefix(pqErr.Where, "COPY ") {
+		return err
+	}
+	_, after, ok := strings.Cut(pqErr.Where, ", line ")
+	if !ok {
+		return err
+	}
+	end := strings.IndexFunc(after, func(r rune) bool { return r < '0' || r > '9' })
+	if end == -1 {
+		end = len(after)
+	}
+	line, convErr := strconv.Atoi(after[:end])
+	if convErr != nil {
+		return err
+	}
+	return &copyLineError{line: line, err: pqErr}
+}
@@ -1,15 +1,23 @@
 package pq
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/lib/pq/internal/pqtest"
+	"github.com/lib/pq/internal/proto"
 	"github.com/lib/pq/pqerror"
 )
 
@@ -18,8 +26,8 @@ func TestCopyInError(t *testing.T) {
 		query   string
 		wantErr string
 	}{
-		{`copy tbl (num) from stdin with binary`, `only text format supported for COPY`},
-		{"-- comment\n  /* comment */  copy tbl (num) to stdout", `COPY TO is not supported`},
+		{`copy tbl (nope) from stdin with binary`, `column "nope" does not exist`},
+		{"-- comment\n  /* comment */  copy tbl (num) to stdout", `COPY TO is not supported with Prepare`},
 		{`copy syntax error`, `or:syntax error at or near "error" at column 13|at or near "error": syntax error`},
 	}
 
@@ -53,14 +61,143 @@ func TestCopyInErrorWrongType(t *testing.T) {
 	mustAs(t, err, pqerror.InvalidTextRepresentation)
 }
 
-func TestCopyInErrorOutsideTransaction(t *testing.T) {
+func TestCopyInOutsideTransaction(t *testing.T) {
 	t.Parallel()
 	db := pqtest.MustDB(t)
+	ctx := context.Background()
 
-	_, err := db.Prepare(`copy tbl (num) from stdin`)
-	if err != errCopyNotSupportedOutsideTxn {
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.ExecContext(ctx, `create temp table tbl (num integer)`); err != nil {
+		t.Fatal(err)
+	}
+
+	stmt, err := c.PrepareContext(ctx, `copy tbl (num) from stdin`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	for i := range 3 {
+		if _, err := stmt.Exec(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Can't use the connection while the COPY is in progress.
+	_, err = c.ExecContext(ctx, `select 1`)
+	if !errors.Is(err, errCopyInProgress) {
 		t.Errorf("wrong error: %v", err)
 	}
+
+	res, err := stmt.Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 3 {
+		t.Errorf("RowsAffected: %d", n)
+	}
+
+	// Committed, and the connection is idle and usable again.
+	var n int
+	err = c.QueryRowContext(ctx, `select count(*) from tbl`).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("count: %d", n)
+	}
+	err = c.Raw(func(driverConn any) error {
+		if s := driverConn.(*conn).txnStatus; s != txnStatusIdle {
+			t.Errorf("txnStatus: %s", s)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopyInBinary(t *testing.T) {
+	t.Parallel()
+	db := pqtest.MustDB(t)
+	tx := pqtest.Begin(t, db)
+	pqtest.Exec(t, tx, `create temp table tbl (
+		i2 int2, i4 int4, i8 int8, f4 float4, f8 float8, b bool, ba bytea, t text,
+		ts timestamp, tstz timestamptz, u uuid, n numeric, ai int[], at text[]
+	)`)
+
+	ts := time.Date(2026, 3, 15, 17, 45, 47, 123456000, time.UTC)
+	stmt := pqtest.Prepare(t, tx, `copy tbl from stdin (format binary)`, db)
+	stmt.MustExec(t, int16(-1), int32(2), int64(3), float32(1.5), 2.5, true, []byte{0, 1},
+		"hé", ts, ts, "03a3522f-8928-4987-84d6-937b36ec276f", "-123.450",
+		Array([]int64{1, 2}), Array([]string{"a", "b,c"}))
+	stmt.MustExec(t, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	res := stmt.MustExec(t)
+	if n, _ := res.RowsAffected(); n != 2 {
+		t.Errorf("RowsAffected: %d", n)
+	}
+	stmt.MustClose(t)
+
+	have := pqtest.QueryRow[string](t, tx, `select concat_ws(' ', i2, i4, i8, f4, f8, b, ba, t,
+		ts, tstz at time zone 'UTC', u, n, ai, at) from tbl where i2 is not null`)
+	want := map[string]string{"concat_ws": `-1 2 3 1.5 2.5 t \x0001 hé 2026-03-15 17:45:47.123456 ` +
+		`2026-03-15 17:45:47.123456 03a3522f-8928-4987-84d6-937b36ec276f -123.450 {1,2} {a,"b,c"}`}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %q\nwant: %q", have, want)
+	}
+	if n := pqtest.QueryRow[int64](t, tx, `select count(*) from tbl where i2 is null and at is null`); n["count"] != 1 {
+		t.Errorf("null row: %v", n)
+	}
+}
+
+// Generated columns are skipped by COPY without a column list.
+func TestCopyInBinaryGenerated(t *testing.T) {
+	t.Parallel()
+	pqtest.SkipBeforeVersion(t, 12)
+	db := pqtest.MustDB(t)
+	tx := pqtest.Begin(t, db)
+	pqtest.Exec(t, tx, `create temp table tbl (a int, dropped int, b int generated always as (a * 2) stored, c text)`)
+	pqtest.Exec(t, tx, `alter table tbl drop column dropped`)
+
+	stmt := pqtest.Prepare(t, tx, `copy tbl from stdin (format binary)`, db)
+	stmt.MustExec(t, 21, "x")
+	res := stmt.MustExec(t)
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Errorf("RowsAffected: %d", n)
+	}
+	stmt.MustClose(t)
+
+	have := pqtest.QueryRow[string](t, tx, `select concat_ws(' ', a, b, c) from tbl`)
+	if want := "21 42 x"; have["concat_ws"] != want {
+		t.Errorf("\nhave: %q\nwant: %q", have["concat_ws"], want)
+	}
+}
+
+func TestCopyInBinaryError(t *testing.T) {
+	t.Parallel()
+	db := pqtest.MustDB(t)
+	tx := pqtest.Begin(t, db)
+	pqtest.Exec(t, tx, `create temp table tbl (a int, b bool)`)
+
+	stmt := pqtest.Prepare(t, tx, `copy tbl from stdin binary`, db)
+	_, err := stmt.Exec(1)
+	if !pqtest.ErrorContains(err, "got 1 values for binary COPY, but the table has 2 columns") {
+		t.Errorf("wrong error: %v", err)
+	}
+	_, err = stmt.Exec(1, "not a bool")
+	if !pqtest.ErrorContains(err, `parsing "not a bool"`) {
+		t.Errorf("wrong error: %v", err)
+	}
+
+	// The failed rows aren't sent.
+	stmt.MustExec(t, 1, true)
+	res := stmt.MustExec(t)
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Errorf("RowsAffected: %d", n)
+	}
 }
 
 func TestCopyInNull(t *testing.T) {
@@ -263,6 +400,552 @@ func TestCopyInRespLoopConnectionError(t *testing.T) {
 	}
 }
 
+// copyTo runs CopyTo() on a connection from db.
+func copyTo(t testing.TB, db *sql.DB, q string, w io.Writer) (int64, error) {
+	t.Helper()
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var n int64
+	err = c.Raw(func(driverConn any) error {
+		var err error
+		n, err = CopyTo(context.Background(), driverConn.(driver.Conn), q, w)
+		return err
+	})
+	return n, err
+}
+
+type errWriter struct{ n int }
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("write error")
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestCopyTo(t *testing.T) {
+	t.Parallel()
+	db := pqtest.MustDB(t)
+	db.SetMaxOpenConns(1)
+	pqtest.Exec(t, db, `create temp table tbl (i int, t text)`)
+	pqtest.Exec(t, db, `insert into tbl values (1, 'one'), (2, 'two, or "2"'), (3, null)`)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`copy tbl to stdout`, "1\tone\n2\ttwo, or \"2\"\n3\t\\N\n"},
+		{`copy tbl (t) to stdout (format csv)`, "one\n\"two, or \"\"2\"\"\"\n\n"},
+		{`copy (select * from tbl where i = 1) to stdout with (format csv, header)`, "i,t\n1,one\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		n, err := copyTo(t, db, tt.query, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have := buf.String(); have != tt.want {
+			t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+		}
+		if want := int64(strings.Count(tt.want, "\n")); strings.Contains(tt.query, "header") {
+			if n != want-1 {
+				t.Errorf("wrong row count: %d", n)
+			}
+		} else if n != want {
+			t.Errorf("wrong row count: %d", n)
+		}
+	}
+}
+
+func TestCopyToError(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{`copy syntax error`, `syntax error`},
+		{`copy tbl from stdin`, `CopyTo can only be used with COPY TO STDOUT`},
+		{`select 1`, `CopyTo can only be used with COPY TO STDOUT`},
+		{`copy doesnotexist to stdout`, `relation "doesnotexist" does not exist`},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+			db := pqtest.MustDB(t)
+			db.SetMaxOpenConns(1)
+			pqtest.Exec(t, db, `create temp table tbl (i int)`)
+
+			_, err := copyTo(t, db, tt.query, io.Discard)
+			if !pqtest.ErrorContains(err, tt.wantErr) {
+				t.Errorf("wrong error:\nhave: %s\nwant: %s", err, tt.wantErr)
+			}
+
+			// Make sure the connection is still usable.
+			pqtest.QueryRow[int](t, db, `select count(*) from tbl`)
+		})
+	}
+}
+
+func TestCopyToWriteError(t *testing.T) {
+	pqtest.SkipPgbouncer(t) // Cancel requests go to a different backend.
+	t.Parallel()
+	db := pqtest.MustDB(t)
+	db.SetMaxOpenConns(1)
+
+	_, err := copyTo(t, db, `copy (select generate_series(1, 10000000)) to stdout`, &errWriter{n: 2})
+	if !pqtest.ErrorContains(err, "write error") {
+		t.Fatalf("wrong error: %v", err)
+	}
+	pqtest.QueryRow[int](t, db, `select 1`)
+}
+
+func TestCopyToFake(t *testing.T) {
+	t.Parallel()
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		f.Startup(cn, nil)
+		for {
+			code, q, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			switch code {
+			case proto.Query:
+				if string(q) == ";\x00" { // Ping()
+					f.WriteMsg(cn, proto.EmptyQueryResponse, "")
+					f.WriteMsg(cn, proto.ReadyForQuery, "I")
+					continue
+				}
+				f.WriteMsg(cn, proto.CopyOutResponse, "\x00\x00\x01\x00\x00")
+				f.WriteMsg(cn, proto.CopyDataResponse, "one\n")
+				f.WriteMsg(cn, proto.CopyDataResponse, "two\n")
+				f.WriteMsg(cn, proto.CopyDoneResponse, "")
+				f.WriteMsg(cn, proto.CommandComplete, "COPY 2\x00")
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.Terminate:
+				cn.Close()
+				return
+			}
+		}
+	})
+	defer f.Close()
+
+	var buf bytes.Buffer
+	n, err := copyTo(t, pqtest.MustDB(t, f.DSN()), `copy tbl to stdout`, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || buf.String() != "one\ntwo\n" {
+		t.Errorf("n=%d; buf=%q", n, buf.String())
+	}
+}
+
+// copyFrom runs CopyFrom() on a connection from db.
+func copyFrom(ctx context.Context, t testing.TB, db *sql.DB, q string, r io.Reader) (int64, error) {
+	t.Helper()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var n int64
+	err = c.Raw(func(driverConn any) error {
+		n, err = CopyFrom(ctx, driverConn.(driver.Conn), q, r)
+		return err
+	})
+	return n, err
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("read error") }
+
+// cancelReader calls cancel on every read.
+type cancelReader struct{ cancel func() }
+
+func (r cancelReader) Read(p []byte) (int, error) {
+	r.cancel()
+	for i := range p {
+		p[i] = 'x'
+	}
+	return len(p), nil
+}
+
+func TestCopyFrom(t *testing.T) {
+	t.Parallel()
+	db := pqtest.MustDB(t)
+	db.SetMaxOpenConns(1)
+	pqtest.Exec(t, db, `create temp table tbl (a int, b text)`)
+
+	tests := []struct {
+		query, data string
+		want        int64
+	}{
+		{`copy tbl from stdin`, "1\tone\n2\t\\N\n", 2},
+		{`copy tbl from stdin (format csv, header)`, "a,b\n3,\"th,ree\"\n", 1},
+		{`copy tbl (a) from stdin`, strings.Repeat("4\n", ciBufferSize), ciBufferSize / 2},
+	}
+	for _, tt := range tests {
+		n, err := copyFrom(context.Background(), t, db, tt.query, strings.NewReader(tt.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != tt.want {
+			t.Errorf("%s: n=%d, want %d", tt.query, n, tt.want)
+		}
+	}
+
+	have := pqtest.Query[any](t, db, `select * from tbl where a < 4 order by a`)
+	want := []map[string]any{
+		{"a": int64(1), "b": "one"},
+		{"a": int64(2), "b": nil},
+		{"a": int64(3), "b": "th,ree"},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %#v\nwant: %#v", have, want)
+	}
+}
+
+func TestCopyFromError(t *testing.T) {
+	t.Parallel()
+	db := pqtest.MustDB(t)
+	db.SetMaxOpenConns(1)
+	pqtest.Exec(t, db, `create temp table tbl (a int)`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		ctx     context.Context
+		query   string
+		r       io.Reader
+		wantErr string
+	}{
+		{context.Background(), `copy tbl from stdin`, strings.NewReader("1\nx\n"), `line 2: invalid input syntax for type integer: "x" (22P02)`},
+		{context.Background(), `copy tbl from stdin`, errReader{}, `read error`},
+		{ctx, `copy tbl from stdin`, strings.NewReader("1\n"), `context canceled`},
+		{context.Background(), `copy tbl to stdout`, strings.NewReader("1\n"), `CopyFrom can only be used with COPY FROM STDIN`},
+		{context.Background(), `select 1`, strings.NewReader("1\n"), `CopyFrom can only be used with COPY FROM STDIN`},
+	}
+	for _, tt := range tests {
+		_, err := copyFrom(tt.ctx, t, db, tt.query, tt.r)
+		if !pqtest.ErrorContains(err, tt.wantErr) {
+			t.Errorf("wrong error:\nhave: %s\nwant: %s", err, tt.wantErr)
+		}
+	}
+
+	// Nothing was copied, and the connection is still usable.
+	if have := pqtest.QueryRow[int](t, db, `select count(*) from tbl`); have["count"] != 0 {
+		t.Errorf("count: %d", have["count"])
+	}
+}
+
+// An unfinished COPY on a connection that is returned to the pool is aborted
+// instead of committed.
+func TestCopyInPool(t *testing.T) {
+	t.Parallel()
+	var (
+		conns atomic.Int32
+		mu    sync.Mutex
+		got   []string
+	)
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		f.Startup(cn, nil)
+		conns.Add(1)
+		for {
+			code, msg, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			switch code {
+			case proto.Query:
+				switch string(msg) {
+				case ";\x00": // Ping()
+					f.WriteMsg(cn, proto.EmptyQueryResponse, "")
+				case "select 1\x00":
+					f.SimpleQuery(cn, "SELECT 1", "x", 1)
+				default:
+					f.WriteMsg(cn, proto.CopyInResponse, "\x00\x00\x01\x00\x00")
+					continue
+				}
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.CopyDoneRequest:
+				mu.Lock()
+				got = append(got, "done")
+				mu.Unlock()
+				f.WriteMsg(cn, proto.CommandComplete, "COPY 1\x00")
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.CopyFail:
+				mu.Lock()
+				got = append(got, "fail")
+				mu.Unlock()
+				f.WriteMsg(cn, proto.ErrorResponse, "SERROR\x00C57014\x00MCOPY from stdin failed: "+string(msg)+"\x00\x00")
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.Terminate:
+				cn.Close()
+				return
+			}
+		}
+	})
+	defer f.Close()
+
+	t.Run("sql.Conn", func(t *testing.T) {
+		mu.Lock()
+		got = nil
+		mu.Unlock()
+		db := pqtest.MustDB(t, f.DSN()+" sslmode=disable")
+		c, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmt, err := c.PrepareContext(context.Background(), `copy tbl from stdin`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stmt.Exec(1); err != nil {
+			t.Fatal(err)
+		}
+		// Return it to the pool without finishing the COPY.
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		pqtest.QueryRow[int](t, db, `select 1`)
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.Join(got, " ") != "fail" {
+			t.Errorf("got: %q", got)
+		}
+	})
+
+	t.Run("sql.DB", func(t *testing.T) {
+		mu.Lock()
+		got = nil
+		mu.Unlock()
+		db := pqtest.MustDB(t, f.DSN()+" sslmode=disable")
+		stmt, err := db.Prepare(`copy tbl from stdin`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range 3 {
+			if _, err := stmt.Exec(1); !errors.Is(err, errCopyInReleased) {
+				t.Errorf("wrong error: %v", err)
+			}
+		}
+		if err := stmt.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.Join(got, " ") != "fail" {
+			t.Errorf("got: %q", got)
+		}
+	})
+
+	// The connection is reused in both cases.
+	if n := conns.Load(); n != 2 {
+		t.Errorf("%d connections", n)
+	}
+}
+
+func TestCopyFromFake(t *testing.T) {
+	t.Parallel()
+	var got bytes.Buffer
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		f.Startup(cn, nil)
+		for {
+			code, msg, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			switch code {
+			case proto.Query:
+				if string(msg) == ";\x00" { // Ping()
+					f.WriteMsg(cn, proto.EmptyQueryResponse, "")
+					f.WriteMsg(cn, proto.ReadyForQuery, "I")
+					continue
+				}
+				f.WriteMsg(cn, proto.CopyInResponse, "\x00\x00\x01\x00\x00")
+			case proto.CopyDataRequest:
+				got.Write(msg)
+			case proto.CopyDoneRequest:
+				f.WriteMsg(cn, proto.CommandComplete, "COPY 2\x00")
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.CopyFail:
+				f.WriteMsg(cn, proto.ErrorResponse, "SERROR\x00C57014\x00MCOPY from stdin failed: "+string(msg)+"\x00\x00")
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.Terminate:
+				cn.Close()
+				return
+			}
+		}
+	})
+	defer f.Close()
+	db := pqtest.MustDB(t, f.DSN())
+
+	data := strings.Repeat("x", ciBufferSize+10)
+	n, err := copyFrom(context.Background(), t, db, `copy tbl from stdin`, strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || got.String() != data {
+		t.Errorf("n=%d; len(got)=%d", n, got.Len())
+	}
+
+	_, err = copyFrom(context.Background(), t, db, `copy tbl from stdin`, errReader{})
+	if !pqtest.ErrorContains(err, "read error") {
+		t.Errorf("wrong error: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Data is sent as soon as it's read, rather than when the buffer is full.
+func TestCopyFromStream(t *testing.T) {
+	t.Parallel()
+	data := make(chan string, 10)
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		f.Startup(cn, nil)
+		for {
+			code, msg, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			switch code {
+			case proto.Query:
+				if string(msg) == ";\x00" { // Ping()
+					f.WriteMsg(cn, proto.EmptyQueryResponse, "")
+					f.WriteMsg(cn, proto.ReadyForQuery, "I")
+					continue
+				}
+				f.WriteMsg(cn, proto.CopyInResponse, "\x00\x00\x01\x00\x00")
+			case proto.CopyDataRequest:
+				data <- string(msg)
+			case proto.CopyDoneRequest:
+				f.WriteMsg(cn, proto.CommandComplete, "COPY 2\x00")
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.Terminate:
+				cn.Close()
+				return
+			}
+		}
+	})
+	defer f.Close()
+	db := pqtest.MustDB(t, f.DSN())
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := copyFrom(context.Background(), t, db, `copy tbl from stdin`, pr)
+		done <- err
+	}()
+	for _, line := range []string{"1\n", "2\n"} {
+		if _, err := pw.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case have := <-data:
+			if have != line {
+				t.Errorf("have %q; want %q", have, line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%q not sent", line)
+		}
+	}
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Cancelling ctx while sending data aborts the COPY with CopyFail, without
+// also sending a CancelRequest.
+func TestCopyFromCancel(t *testing.T) {
+	t.Parallel()
+	var cancels, fails atomic.Int32
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		code, _, ok := f.ReadStartupPacket(cn)
+		if !ok {
+			return
+		}
+		if code == proto.CancelRequestCode {
+			cancels.Add(1)
+			cn.Close()
+			return
+		}
+		f.WriteMsg(cn, proto.AuthenticationRequest, "\x00\x00\x00\x00")
+		f.WriteBackendKeyData(cn, 1, []byte{1, 2, 3, 4})
+		f.WriteMsg(cn, proto.ReadyForQuery, "I")
+		for {
+			code, msg, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			switch code {
+			case proto.Query:
+				if string(msg) == ";\x00" { // Ping()
+					f.WriteMsg(cn, proto.EmptyQueryResponse, "")
+					f.WriteMsg(cn, proto.ReadyForQuery, "I")
+					continue
+				}
+				f.WriteMsg(cn, proto.CopyInResponse, "\x00\x00\x01\x00\x00")
+			case proto.CopyFail:
+				fails.Add(1)
+				f.WriteMsg(cn, proto.ErrorResponse, "SERROR\x00C57014\x00MCOPY from stdin failed: "+string(msg)+"\x00\x00")
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.Terminate:
+				cn.Close()
+				return
+			}
+		}
+	})
+	defer f.Close()
+	// The grace period makes the finish func wait for any CancelRequest.
+	db := pqtest.MustDB(t, f.DSN()+" sslmode=disable cancel_grace_period=5")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := copyFrom(ctx, t, db, `copy tbl from stdin`, cancelReader{cancel})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if c, f := cancels.Load(), fails.Load(); c != 0 || f != 1 {
+		t.Errorf("%d CancelRequests and %d CopyFails", c, f)
+	}
+}
+
+func TestCopyLineErr(t *testing.T) {
+	tests := []struct {
+		where, want string
+	}{
+		{``, `pq: oops (22P02)`},
+		{`COPY tbl, line 2, column a: "x"`, `pq: line 2: oops (22P02)`},
+		{`COPY tbl, line 13: "x"`, `pq: line 13: oops (22P02)`},
+		{`COPY tbl, line 5`, `pq: line 5: oops (22P02)`},
+		{`PL/pgSQL function f() line 5 at RAISE`, `pq: oops (22P02)`},
+	}
+	for _, tt := range tests {
+		err := copyLineErr(&Error{Code: "22P02", Message: "oops", Where: tt.where})
+		if err.Error() != tt.want {
+			t.Errorf("\nhave: %s\nwant: %s", err, tt.want)
+		}
+		if As(err, "22P02") == nil {
+			t.Error("As() returned nil")
+		}
+	}
+}
+
 func BenchmarkCopyIn(b *testing.B) {
 	db := pqtest.MustDB(b)
 	tx := pqtest.Begin(b, db)
@@ -0,0 +1,279 @@
+package pq
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/lib/pq/internal/pqutil"
+)
+
+// crlChecker checks certificates against the certificate revocation lists from
+// the "sslcrl" and "sslcrldir" settings.
+//
+// Like libpq, every certificate in the chain except the root must have a CRL
+// from its issuer.
+type crlChecker struct {
+	crls []*x509.RevocationList // Loaded from sslcrl.
+	dir  string                 // sslcrldir; read on every check.
+	now  func() time.Time
+}
+
+// sslCRL loads the CRLs specified in the "sslcrl" and "sslcrldir" settings, or
+// ~/.postgresql/root.crl if neither is set. The returned checker is nil if
+// there are no CRLs to check.
+func sslCRL(cfg Config, home string) (*crlChecker, error) {
+	if cfg.SSLCRL == "" && cfg.SSLCRLDir == "" && home != "" {
+		f := filepath.Join(home, "root.crl")
+		if _, err := os.Stat(f); err == nil {
+			cfg.SSLCRL = f
+		}
+	}
+	if cfg.SSLCRL == "" && cfg.SSLCRLDir == "" {
+		return nil, nil
+	}
+
+	c := &crlChecker{dir: cfg.SSLCRLDir, now: time.Now}
+	if cfg.SSLCRL != "" {
+		var err error
+		c.crls, err = readCRLFile(cfg.SSLCRL)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// readCRLFile reads all CRLs from a PEM file, or a single CRL from a DER file.
+func readCRLFile(path string) ([]*x509.RevocationList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if pqutil.ErrNotExists(err) {
+			return nil, fmt.Errorf("pq: could not load SSL certificate revocation list %q: %w", path, err)
+		}
+		return nil, err
+	}
+
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		crl, err := x509.ParseRevocationList(data)
+		if err != nil {
+			return nil, fmt.Errorf("pq: could not parse SSL certificate revocation list %q: %w", path, err)
+		}
+		return []*x509.RevocationList{crl}, nil
+	}
+
+	var crls []*x509.RevocationList
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "X509 CRL" {
+			continue
+		}
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("pq: could not parse SSL certificate revocation list %q: %w", path, err)
+		}
+		crls = append(crls, crl)
+	}
+	if len(crls) == 0 {
+		return nil, fmt.Errorf("pq: no certificate revocation list in %q", path)
+	}
+	return crls, nil
+}
+
+// check checks the verified chains, and returns an error if no chain passes.
+func (c *crlChecker) check(chains [][]*x509.Certificate) error {
+	if len(chains) == 0 {
+		return errors.New("pq: no verified certificate chain to check against certificate revocation list")
+	}
+	var err error
+	for _, chain := range chains {
+		if err = c.checkChain(chain); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (c *crlChecker) checkChain(chain []*x509.Certificate) error {
+	for i, cert := range chain {
+		if i == len(chain)-1 {
+			break // Root.
+		}
+		crls, err := c.lookup(cert.RawIssuer)
+		if err != nil {
+			return err
+		}
+		issuer, found := chain[i+1], false
+		for _, crl := range crls {
+			if !bytes.Equal(crl.RawIssuer, cert.RawIssuer) || crl.CheckSignatureFrom(issuer) != nil {
+				continue
+			}
+			if !crl.NextUpdate.IsZero() && c.now().After(crl.NextUpdate) {
+				return fmt.Errorf("pq: SSL certificate revocation list from %q has expired", issuer.Subject)
+			}
+			found = true
+			for _, r := range crl.RevokedCertificateEntries {
+				if r.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+					return fmt.Errorf("pq: SSL certificate %q is revoked", cert.Subject)
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("pq: no SSL certificate revocation list found for %q", cert.Subject)
+		}
+	}
+	return nil
+}
+
+// lookup gets the CRLs for the issuer from sslcrl and sslcrldir.
+//
+// Like OpenSSL's hashed directory lookup, files in sslcrldir must be named
+// <hash>.r<n>, where hash is the hash of the issuer name and n is a sequence
+// number starting at 0. These can be created with "openssl rehash".
+func (c *crlChecker) lookup(rawIssuer []byte) ([]*x509.RevocationList, error) {
+	if c.dir == "" {
+		return c.crls, nil
+	}
+	h, err := x509NameHash(rawIssuer)
+	if err != nil {
+		return nil, err
+	}
+	crls := slices.Clone(c.crls)
+	for n := 0; ; n++ {
+		f := filepath.Join(c.dir, fmt.Sprintf("%08x.r%d", h, n))
+		if _, err := os.Stat(f); err != nil {
+			break
+		}
+		l, err := readCRLFile(f)
+		if err != nil {
+			return nil, err
+		}
+		crls = append(crls, l...)
+	}
+	return crls, nil
+}
+
+// x509NameHash calculates the hash OpenSSL uses for the file names in hashed
+// directories (X509_NAME_hash_ex()): the first four bytes of the SHA-1 of the
+// canonical encoding of the name, as a little-endian integer.
+//
+// The canonical encoding is the DER encoding of the RDNs without the outer
+// SEQUENCE, with all string values converted to lower-case UTF8String with
+// leading, trailing, and repeated whitespace removed.
+func x509NameHash(rawName []byte) (uint32, error) {
+	errName := errors.New("pq: invalid X.509 name")
+
+	var name asn1.RawValue
+	if rest, err := asn1.Unmarshal(rawName, &name); err != nil || len(rest) > 0 {
+		return 0, errName
+	}
+	var canon []byte
+	for rdns := name.Bytes; len(rdns) > 0; {
+		var (
+			rdn asn1.RawValue
+			err error
+		)
+		rdns, err = asn1.Unmarshal(rdns, &rdn)
+		if err != nil {
+			return 0, errName
+		}
+
+		var atvs [][]byte
+		for b := rdn.Bytes; len(b) > 0; {
+			var atv asn1.RawValue
+			b, err = asn1.Unmarshal(b, &atv)
+			if err != nil {
+				return 0, errName
+			}
+			var typ, val asn1.RawValue
+			rest, err := asn1.Unmarshal(atv.Bytes, &typ)
+			if err != nil {
+				return 0, errName
+			}
+			if _, err := asn1.Unmarshal(rest, &val); err != nil {
+				return 0, errName
+			}
+			if s, ok := asn1StringUTF8(val); ok {
+				val = asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: canonString(s)}
+				val.FullBytes, _ = asn1.Marshal(val)
+			}
+			enc, _ := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true,
+				Bytes: append(slices.Clip(typ.FullBytes), val.FullBytes...)})
+			atvs = append(atvs, enc)
+		}
+		slices.SortFunc(atvs, bytes.Compare)
+		enc, _ := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(atvs, nil)})
+		canon = append(canon, enc...)
+	}
+
+	sum := sha1.Sum(canon)
+	return binary.LittleEndian.Uint32(sum[:4]), nil
+}
+
+// asn1StringUTF8 converts the string types that are canonicalized by OpenSSL to
+// UTF-8.
+func asn1StringUTF8(v asn1.RawValue) ([]byte, bool) {
+	if v.Class != asn1.ClassUniversal {
+		return nil, false
+	}
+	switch v.Tag {
+	case asn1.TagUTF8String, asn1.TagPrintableString, asn1.TagIA5String, 26 /* VisibleString */ :
+		return v.Bytes, true
+	case asn1.TagT61String: // Treated as Latin-1, like OpenSSL.
+		s := make([]byte, 0, len(v.Bytes))
+		for _, c := range v.Bytes {
+			s = utf8.AppendRune(s, rune(c))
+		}
+		return s, true
+	case asn1.TagBMPString:
+		u := make([]uint16, len(v.Bytes)/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(v.Bytes[i*2:])
+		}
+		return []byte(string(utf16.Decode(u))), true
+	case 28: // UniversalString
+		s := make([]byte, 0, len(v.Bytes)/4)
+		for i := 0; i+4 <= len(v.Bytes); i += 4 {
+			s = utf8.AppendRune(s, rune(binary.BigEndian.Uint32(v.Bytes[i:])))
+		}
+		return s, true
+	}
+	return nil, false
+}
+
+// canonString lower-cases ASCII characters, removes leading and trailing
+// whitespace, and replaces repeated whitespace with a single space.
+func canonString(s []byte) []byte {
+	isSpace := func(c byte) bool { return c == ' ' || (c >= '\t' && c <= '\r') }
+	s = bytes.TrimFunc(s, func(r rune) bool { return r < utf8.RuneSelf && isSpace(byte(r)) })
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case isSpace(c):
+			out = append(out, ' ')
+			for i+1 < len(s) && isSpace(s[i+1]) {
+				i++
+			}
+		case c >= 'A' && c <= 'Z':
+			out = append(out, c+'a'-'A')
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
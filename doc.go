@@ -41,6 +41,25 @@ placeholder can be used more than once:
 		`select * from users where name = $1 or age between $2 and $2 + 3`,
 		"Duck", 64)
 
+Queries with named arguments from [sql.Named] can use @name or :name
+placeholders, which are rewritten to $1, $2, etc. before the query is sent. The
+same name can be used more than once:
+
+	rows, err := db.Query(
+		`select * from users where name = @name or age between @age and @age + 3`,
+		sql.Named("name", "Duck"), sql.Named("age", 64))
+
+Placeholders in string literals, quoted identifiers, dollar-quoted strings, and
+comments are left alone, as are queries that already use $1 placeholders. A @
+directly after an operator character is part of the operator (e.g. <@), so use
+a space: "tags <@ @tags", not "tags <@@tags".
+
+Statements prepared with Prepare are only rewritten with the named_placeholders
+connection parameter, as there is no way to know if @x is meant as a
+placeholder or the @ operator before the statement is executed. They can then
+also be executed with arguments without names, in the order the names first
+appear.
+
 pq does not support [sql.Result.LastInsertId]. Use the RETURNING clause with a
 Query or QueryRow call instead to return the identifier:
 
@@ -67,6 +86,12 @@ This package returns the following types for values from the PostgreSQL backend:
 
 All other types are returned directly from the backend as []byte values in text format.
 
+Results of prepared statements are received in the binary format for most
+built-in types, and converted to the same values as the text format. The
+exception is real and double precision, which are always converted as the
+shortest text that round-trips; the text format only does that on PostgreSQL 12
+and newer with extra_float_digits > 0, and is rounded otherwise.
+
 # Errors
 
 pq may return errors of type [*pq.Error] which contain error details:
@@ -79,18 +104,92 @@ pq may return errors of type [*pq.Error] which contain error details:
 # Bulk imports
 
 You can perform bulk imports by preparing a "COPY [..] FROM STDIN" statement in
-a transaction ([sql.Tx]). The returned [sql.Stmt] handle can then be repeatedly
-"executed" to copy data into the target table. After all data has been processed
-you should call Exec() once with no arguments to flush all buffered data. Any
-call to Exec() might return an error which should be handled appropriately, but
-because of the internal buffering an error returned by Exec() might not be
-related to the data passed in the call that failed.
-
-It is not possible to COPY outside of an explicit transaction in pq.
+a transaction ([sql.Tx]) or on a connection ([sql.Conn]). The returned
+[sql.Stmt] handle can then be repeatedly "executed" to copy data into the target
+table. After all data has been processed you should call Exec() once with no
+arguments to flush all buffered data. Any call to Exec() might return an error
+which should be handled appropriately, but because of the internal buffering an
+error returned by Exec() might not be related to the data passed in the call
+that failed.
+
+The connection can't be used for anything else until the COPY is finished.
+Outside of a transaction the data is committed once the COPY is finished.
+
+COPY statements can't be prepared on a [sql.DB], as the connection is returned
+to the pool after every Exec(). A COPY that isn't finished when its connection
+is returned to the pool is aborted without committing any data, and Exec() on
+the statement returns an error if the connection is reused. Depending on which
+connections the pool hands out this may be a later Exec(), and if the pool
+closes the connection instead no error is returned at all.
+
+To load data that is already in the COPY format (for example a CSV file) use
+[CopyFrom], which streams the data from an [io.Reader]. This needs a connection
+from [sql.Conn.Raw].
 
 Use nil for NULL, or explicitly add WITH NULL 'SOME STRING' (the default of \N
 doesn't work).
 
+With "FORMAT BINARY" the values are encoded in the binary format, based on the
+column types of the table. This supports the integer, float, bool, bytea, text,
+timestamp, date, uuid, and numeric types and arrays of those; a []byte is sent
+as-is for other types. Every Exec() must have a value for every column.
+
+# Bulk exports
+
+"COPY [..] TO STDOUT" can't be used with Query or Prepare; use [CopyTo] to
+stream the data to an [io.Writer]. This needs a connection from [sql.Conn.Raw].
+
+# Pipelining
+
+A [Pipeline] sends many queries without waiting for the result of every query
+before sending the next one, which saves a round trip for every query. This
+needs a connection from [sql.Conn.Raw].
+
+A [Batch] is a simpler way to send a list of queries at once, and read the
+results with a single round trip.
+
+# Large Objects
+
+[LargeObjects] creates, opens, and removes large objects in a transaction. An
+opened [LargeObject] implements [io.Reader], [io.Writer], [io.Seeker], and
+[io.Closer]. This needs a connection from [sql.Conn.Raw]:
+
+	c, err := db.Conn(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	tx, err := c.BeginTx(ctx, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	err = c.Raw(func(driverConn any) error {
+		lo, err := pq.NewLargeObjects(driverConn.(driver.Conn))
+		if err != nil {
+			return err
+		}
+		id, err := lo.Create(ctx, 0)
+		if err != nil {
+			return err
+		}
+		obj, err := lo.Open(ctx, id, pq.LargeObjectModeWrite)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(obj, fp)
+		if err != nil {
+			return err
+		}
+		return obj.Close()
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = tx.Commit()
+
 # Notifications
 
 PostgreSQL supports a simple publish/subscribe model using PostgreSQL's [NOTIFY] mechanism.
@@ -117,6 +216,54 @@ The channel name in both Listen and Unlisten is case sensitive, and can contain
 any characters legal in an [identifier]. Note that the channel name will be
 truncated to 63 bytes by the PostgreSQL server.
 
+# Replication
+
+[NewReplicationConn] opens a connection for the [streaming replication
+protocol], which can be used to create replication slots and stream changes with
+logical decoding:
+
+	rc, err := pq.NewReplicationConn(ctx, connector)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	err = rc.StartReplication(ctx, "slot", 0, map[string]string{
+		"proto_version":     "1",
+		"publication_names": "pub",
+	})
+	for {
+		msg, err := rc.Receive(ctx)
+		[..]
+	}
+
+The server needs to be configured with wal_level=logical, and the user needs
+the REPLICATION attribute. The status of the client must be reported
+periodically with [ReplicationConn.SendStandbyStatus], or the server will close
+the connection.
+
+The messages of the built-in pgoutput plugin can be decoded with a
+[PgoutputDecoder]; column values are decoded the same way as query results.
+
+A connection with replication=true can be used for physical replication with
+[ReplicationConn.StartPhysicalReplication], and to take a base backup with
+[ReplicationConn.BaseBackup]. The backup is streamed as one tar archive per
+tablespace:
+
+	b, err := rc.BaseBackup(ctx, &pq.BaseBackupOptions{Fast: true})
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	for {
+		a, err := b.Next()
+		if err == io.EOF {
+			break
+		}
+		[..]
+		_, err = io.Copy(fp, a)
+	}
+
 # Kerberos Support
 
 If you need support for Kerberos authentication, add the following to your main
@@ -131,7 +278,30 @@ package:
 This package is in a separate module so that users who don't need Kerberos don't
 have to add unnecessary dependencies.
 
+GSSAPI transport encryption (gssencmode) needs a provider that implements
+[GSSEncrypter]; it's used instead of SSL if the server supports it, or
+required with gssencmode=require. The provider from auth/kerberos doesn't
+implement this, so a third-party provider is required for GSSAPI encryption.
+
+# OAuth
+
+For servers using OAUTHBEARER authentication (PostgreSQL ≥18) set oauth_issuer
+in the connection string and a [TokenProvider] on the [Connector] to get the
+tokens from the identity provider:
+
+	c, err := pq.NewConnector("host=db oauth_issuer=https://idp.example.com")
+	if err != nil {
+		log.Fatal(err)
+	}
+	c.TokenProvider(func(ctx context.Context, issuer, scope string) (string, error) {
+		return getToken(ctx, issuer, scope)
+	})
+	db := sql.OpenDB(c)
+
+An [*OAuthError] is returned if the server rejects the token.
+
 [identifier]: http://www.postgresql.org/docs/current/static/sql-syntax-lexical.html#SQL-SYNTAX-IDENTIFIERS
+[streaming replication protocol]: https://www.postgresql.org/docs/current/protocol-replication.html
 [NOTIFY]: http://www.postgresql.org/docs/current/static/sql-notify.html
 */
 package pq
@@ -6,11 +6,13 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/lib/pq/internal/pqtime"
+	"github.com/lib/pq/internal/pqutil"
 	"github.com/lib/pq/oid"
 )
 
@@ -54,7 +56,7 @@ func encode(x any, pgtypOid oid.Oid) ([]byte, error) {
 func decode(ps *parameterStatus, s []byte, typ oid.Oid, f format) (any, error) {
 	switch f {
 	case formatBinary:
-		return binaryDecode(s, typ)
+		return binaryDecode(ps, s, typ)
 	case formatText:
 		return textDecode(ps, s, typ)
 	default:
@@ -62,7 +64,7 @@ func decode(ps *parameterStatus, s []byte, typ oid.Oid, f format) (any, error) {
 	}
 }
 
-func binaryDecode(s []byte, typ oid.Oid) (any, error) {
+func binaryDecode(ps *parameterStatus, s []byte, typ oid.Oid) (any, error) {
 	switch typ {
 	case oid.T_bytea:
 		return s, nil
@@ -74,10 +76,38 @@ func binaryDecode(s []byte, typ oid.Oid) (any, error) {
 		return int64(int16(binary.BigEndian.Uint16(s))), nil
 	case oid.T_uuid:
 		return decodeUUIDBinary(s)
+	case oid.T_pg_lsn:
+		return decodeLSNBinary(s)
+	case oid.T_bool:
+		if len(s) != 1 {
+			return nil, binaryLenErr(typ, s)
+		}
+		return s[0] != 0, nil
+	case oid.T_float4:
+		return binaryFloat4(s)
+	case oid.T_float8:
+		if len(s) != 8 {
+			return nil, binaryLenErr(typ, s)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(s)), nil
+	case oid.T_char, oid.T_bpchar, oid.T_varchar, oid.T_text:
+		return string(s), nil
+	case oid.T_timestamp, oid.T_timestamptz:
+		return binaryTimestamp(ps, s, typ)
+	case oid.T_date:
+		return binaryDate(s)
+	case oid.T_time:
+		return binaryTimeOfDay(s)
+	case oid.T_timetz:
+		b, err := appendBinaryText(nil, ps, s, typ)
+		if err != nil {
+			return nil, err
+		}
+		return parseTime(typ, b)
 	default:
-		return nil, fmt.Errorf("pq: don't know how to decode binary parameter of type %d", uint32(typ))
+		// Types which are returned as []byte in the text format.
+		return appendBinaryText(nil, ps, s, typ)
 	}
-
 }
 
 // decodeUUIDBinary interprets the binary format of a uuid, returning it in text format.
@@ -195,6 +225,449 @@ func appendEscapedText(buf []byte, text string) []byte {
 	return result
 }
 
+// arrayElem maps array types to their element type, for the types we can
+// encode or decode in the binary format.
+var arrayElem = map[oid.Oid]oid.Oid{
+	oid.T__bool:        oid.T_bool,
+	oid.T__bytea:       oid.T_bytea,
+	oid.T__char:        oid.T_char,
+	oid.T__name:        oid.T_name,
+	oid.T__int2:        oid.T_int2,
+	oid.T__int4:        oid.T_int4,
+	oid.T__int8:        oid.T_int8,
+	oid.T__text:        oid.T_text,
+	oid.T__oid:         oid.T_oid,
+	oid.T__json:        oid.T_json,
+	oid.T__jsonb:       oid.T_jsonb,
+	oid.T__bpchar:      oid.T_bpchar,
+	oid.T__varchar:     oid.T_varchar,
+	oid.T__float4:      oid.T_float4,
+	oid.T__float8:      oid.T_float8,
+	oid.T__date:        oid.T_date,
+	oid.T__timestamp:   oid.T_timestamp,
+	oid.T__timestamptz: oid.T_timestamptz,
+	oid.T__numeric:     oid.T_numeric,
+	oid.T__uuid:        oid.T_uuid,
+}
+
+// Microseconds and days in the binary format are relative to 2000-01-01.
+const (
+	pgEpochUnix    = 946684800
+	secondsPerDay  = 86400
+	microsInSecond = 1_000_000
+)
+
+// pgTime converts microseconds since 2000-01-01 to a time.Time.
+func pgTime(us int64) time.Time {
+	return time.Unix(pgEpochUnix+us/microsInSecond, (us%microsInSecond)*1000)
+}
+
+// toPGTime converts t to microseconds since 2000-01-01.
+func toPGTime(t time.Time) int64 {
+	return (t.Unix()-pgEpochUnix)*microsInSecond + int64(t.Nanosecond()/1000)
+}
+
+// appendBinary encodes x in the binary format for the type typ and appends it
+// to buf. This is used for binary COPY, where all columns must be sent in the
+// binary format.
+//
+// []byte values for types we don't know are assumed to be in the binary format
+// already and are appended as-is.
+func appendBinary(buf []byte, x any, typ oid.Oid) ([]byte, error) {
+	switch typ {
+	case oid.T_int2, oid.T_int4, oid.T_int8, oid.T_oid:
+		n, err := binaryInt(x, typ)
+		if err != nil {
+			return buf, err
+		}
+		switch typ {
+		case oid.T_int2:
+			if n < math.MinInt16 || n > math.MaxInt16 {
+				return buf, fmt.Errorf("pq: value %d out of range for smallint", n)
+			}
+			return binary.BigEndian.AppendUint16(buf, uint16(n)), nil
+		case oid.T_int4:
+			if n < math.MinInt32 || n > math.MaxInt32 {
+				return buf, fmt.Errorf("pq: value %d out of range for integer", n)
+			}
+			return binary.BigEndian.AppendUint32(buf, uint32(n)), nil
+		case oid.T_oid:
+			if n < 0 || n > math.MaxUint32 {
+				return buf, fmt.Errorf("pq: value %d out of range for oid", n)
+			}
+			return binary.BigEndian.AppendUint32(buf, uint32(n)), nil
+		default:
+			return binary.BigEndian.AppendUint64(buf, uint64(n)), nil
+		}
+	case oid.T_float4, oid.T_float8:
+		f, err := binaryFloat(x, typ)
+		if err != nil {
+			return buf, err
+		}
+		if typ == oid.T_float4 {
+			return binary.BigEndian.AppendUint32(buf, math.Float32bits(float32(f))), nil
+		}
+		return binary.BigEndian.AppendUint64(buf, math.Float64bits(f)), nil
+	case oid.T_bool:
+		var b bool
+		switch v := x.(type) {
+		case bool:
+			b = v
+		case string:
+			var err error
+			if b, err = pqutil.ParseBool(v); err != nil {
+				return buf, fmt.Errorf("pq: %w", err)
+			}
+		default:
+			return buf, binaryTypeErr(x, typ)
+		}
+		if b {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case oid.T_bytea:
+		switch v := x.(type) {
+		case []byte:
+			return append(buf, v...), nil
+		case string:
+			return append(buf, v...), nil
+		default:
+			return buf, binaryTypeErr(x, typ)
+		}
+	case oid.T_text, oid.T_varchar, oid.T_bpchar, oid.T_name, oid.T_char, oid.T_json, oid.T_xml, oid.T_jsonb:
+		// The binary format for these is identical to the text format, except
+		// for jsonb which has a version number.
+		if typ == oid.T_jsonb {
+			buf = append(buf, 1)
+		}
+		if t, ok := x.(time.Time); ok {
+			return append(buf, formatTS(t)...), nil
+		}
+		b, err := encode(x, typ)
+		if err != nil {
+			return buf, err
+		}
+		return append(buf, b...), nil
+	case oid.T_timestamp, oid.T_timestamptz:
+		t, inf, err := binaryTime(x, typ)
+		if err != nil {
+			return buf, err
+		}
+		switch inf {
+		case -1:
+			return binary.BigEndian.AppendUint64(buf, 1<<63), nil
+		case 1:
+			return binary.BigEndian.AppendUint64(buf, math.MaxInt64), nil
+		}
+		if typ == oid.T_timestamp { // Use the wall clock time, like the text format.
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+		}
+		return binary.BigEndian.AppendUint64(buf, uint64(toPGTime(t))), nil
+	case oid.T_date:
+		t, inf, err := binaryTime(x, typ)
+		if err != nil {
+			return buf, err
+		}
+		switch inf {
+		case -1:
+			return binary.BigEndian.AppendUint32(buf, 1<<31), nil
+		case 1:
+			return binary.BigEndian.AppendUint32(buf, math.MaxInt32), nil
+		}
+		d := (time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() - pgEpochUnix) / secondsPerDay
+		return binary.BigEndian.AppendUint32(buf, uint32(d)), nil
+	case oid.T_uuid:
+		var s string
+		switch v := x.(type) {
+		case []byte:
+			if len(v) == 16 {
+				return append(buf, v...), nil
+			}
+			s = string(v)
+		case string:
+			s = v
+		default:
+			return buf, binaryTypeErr(x, typ)
+		}
+		s = strings.ReplaceAll(strings.Trim(s, "{}"), "-", "")
+		if len(s) != 32 {
+			return buf, fmt.Errorf("pq: invalid uuid %q", x)
+		}
+		u, err := hex.DecodeString(s)
+		if err != nil {
+			return buf, fmt.Errorf("pq: invalid uuid %q: %w", x, err)
+		}
+		return append(buf, u...), nil
+	case oid.T_pg_lsn:
+		var s string
+		switch v := x.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		case int64:
+			if v < 0 {
+				return buf, fmt.Errorf("pq: invalid LSN %d", v)
+			}
+			return binary.BigEndian.AppendUint64(buf, uint64(v)), nil
+		default:
+			return buf, binaryTypeErr(x, typ)
+		}
+		lsn, err := ParseLSN(s)
+		if err != nil {
+			return buf, err
+		}
+		return binary.BigEndian.AppendUint64(buf, uint64(lsn)), nil
+	case oid.T_numeric:
+		var s string
+		switch v := x.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		case int64:
+			s = strconv.FormatInt(v, 10)
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return buf, binaryTypeErr(x, typ)
+		}
+		return appendBinaryNumeric(buf, s)
+	}
+
+	if elem, ok := arrayElem[typ]; ok {
+		return appendBinaryArray(buf, x, elem)
+	}
+	if v, ok := x.([]byte); ok {
+		return append(buf, v...), nil
+	}
+	return buf, fmt.Errorf("pq: don't know how to encode %T in the binary format for type %d; use []byte to send it as-is", x, uint32(typ))
+}
+
+func binaryTypeErr(x any, typ oid.Oid) error {
+	return fmt.Errorf("pq: cannot encode %T in the binary format for type %s", x, oid.TypeName[typ])
+}
+
+func binaryInt(x any, typ oid.Oid) (int64, error) {
+	switch v := x.(type) {
+	case int64:
+		return v, nil
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, errors.New("pq: " + err.Error())
+		}
+		return n, nil
+	case []byte:
+		return binaryInt(string(v), typ)
+	}
+	return 0, binaryTypeErr(x, typ)
+}
+
+func binaryFloat(x any, typ oid.Oid) (float64, error) {
+	switch v := x.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, errors.New("pq: " + err.Error())
+		}
+		return f, nil
+	case []byte:
+		return binaryFloat(string(v), typ)
+	}
+	return 0, binaryTypeErr(x, typ)
+}
+
+// binaryTime gets a time from x; inf is -1 or 1 for -infinity and infinity.
+func binaryTime(x any, typ oid.Oid) (t time.Time, inf int, err error) {
+	switch v := x.(type) {
+	case time.Time:
+		t = v
+	case []byte:
+		return binaryTime(string(v), typ)
+	case string:
+		switch v {
+		case "-infinity":
+			return t, -1, nil
+		case "infinity":
+			return t, 1, nil
+		}
+		t, err = ParseTimestamp(nil, v)
+		if err != nil {
+			return t, 0, errors.New("pq: " + err.Error())
+		}
+	default:
+		return t, 0, binaryTypeErr(x, typ)
+	}
+	if infinityTSEnabled {
+		if !t.After(infinityTSNegative) {
+			return t, -1, nil
+		}
+		if !t.Before(infinityTSPositive) {
+			return t, 1, nil
+		}
+	}
+	return t, 0, nil
+}
+
+// appendBinaryNumeric appends the decimal number s in the binary numeric
+// format: a header followed by base-10000 digits.
+func appendBinaryNumeric(buf []byte, s string) ([]byte, error) {
+	const (
+		numericPos  = 0x0000
+		numericNeg  = 0x4000
+		numericNaN  = 0xc000
+		numericPInf = 0xd000
+		numericNInf = 0xf000
+	)
+	header := func(buf []byte, ndigits, weight, sign, dscale int) []byte {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(ndigits))
+		buf = binary.BigEndian.AppendUint16(buf, uint16(int16(weight)))
+		buf = binary.BigEndian.AppendUint16(buf, uint16(sign))
+		return binary.BigEndian.AppendUint16(buf, uint16(dscale))
+	}
+
+	switch strings.ToLower(s) {
+	case "nan":
+		return header(buf, 0, 0, numericNaN, 0), nil
+	case "infinity", "+infinity", "inf", "+inf":
+		return header(buf, 0, 0, numericPInf, 0), nil
+	case "-infinity", "-inf":
+		return header(buf, 0, 0, numericNInf, 0), nil
+	}
+
+	invalid := fmt.Errorf("pq: invalid input syntax for type numeric: %q", s)
+	sign := numericPos
+	if len(s) > 0 && (s[0] == '-' || s[0] == '+') {
+		if s[0] == '-' {
+			sign = numericNeg
+		}
+		s = s[1:]
+	}
+	var exp int
+	if i := strings.IndexAny(s, "eE"); i > -1 {
+		var err error
+		exp, err = strconv.Atoi(s[i+1:])
+		if err != nil {
+			return buf, invalid
+		}
+		s = s[:i]
+	}
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	digits := intPart + fracPart
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return buf, invalid
+	}
+	// The exponent is checked before padding with zeros, as anything outside
+	// this can't fit in dscale or weight.
+	if exp < -0x3fff || exp > 4*(math.MaxInt16+1)+len(digits) {
+		return buf, invalid
+	}
+
+	// Move the decimal point by the exponent, padding with zeros as needed.
+	dscale := max(0, len(fracPart)-exp)
+	point := len(intPart) + exp
+	if point < 0 {
+		digits, point = strings.Repeat("0", -point)+digits, 0
+	}
+	if point > len(digits) {
+		digits += strings.Repeat("0", point-len(digits))
+	}
+	if dscale > 0x3fff {
+		return buf, invalid
+	}
+
+	// Align to groups of 4 digits on both sides of the decimal point.
+	var (
+		ip     = strings.Repeat("0", (4-point%4)%4) + digits[:point]
+		fp     = digits[point:]
+		groups = make([]int, 0, (len(ip)+len(fp))/4+1)
+	)
+	fp += strings.Repeat("0", (4-len(fp)%4)%4)
+	for d := ip + fp; len(d) > 0; d = d[4:] {
+		n, _ := strconv.Atoi(d[:4])
+		groups = append(groups, n)
+	}
+	weight := len(ip)/4 - 1
+	for len(groups) > 0 && groups[0] == 0 {
+		groups, weight = groups[1:], weight-1
+	}
+	for len(groups) > 0 && groups[len(groups)-1] == 0 {
+		groups = groups[:len(groups)-1]
+	}
+	if len(groups) == 0 {
+		weight, sign = 0, numericPos
+	}
+	if weight > math.MaxInt16 || weight < math.MinInt16 {
+		return buf, invalid
+	}
+
+	buf = header(buf, len(groups), weight, sign, dscale)
+	for _, g := range groups {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(g))
+	}
+	return buf, nil
+}
+
+// appendBinaryArray appends the array x in the binary array format. x must be
+// in the text format, as returned by [Array].
+func appendBinaryArray(buf []byte, x any, elem oid.Oid) ([]byte, error) {
+	var src []byte
+	switch v := x.(type) {
+	case string:
+		src = []byte(v)
+	case []byte:
+		src = v
+	default:
+		return buf, binaryTypeErr(x, elem)
+	}
+	dims, elems, err := parseArray(src, []byte{','})
+	if err != nil {
+		return buf, fmt.Errorf("pq: %w", err)
+	}
+	if len(elems) == 0 {
+		dims = nil
+	}
+
+	hasNull := 0
+	for _, e := range elems {
+		if e == nil {
+			hasNull = 1
+			break
+		}
+	}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(dims)))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(hasNull))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(elem))
+	for _, d := range dims {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(d))
+		buf = binary.BigEndian.AppendUint32(buf, 1) // Lower bound
+	}
+	for _, e := range elems {
+		if e == nil {
+			buf = binary.BigEndian.AppendUint32(buf, math.MaxUint32) // -1
+			continue
+		}
+		var v any = string(e)
+		if elem == oid.T_bytea {
+			if v, err = parseBytea(e); err != nil {
+				return buf, fmt.Errorf("pq: %w", err)
+			}
+		}
+		l := len(buf)
+		buf = append(buf, 0, 0, 0, 0)
+		if buf, err = appendBinary(buf, v, elem); err != nil {
+			return buf, err
+		}
+		binary.BigEndian.PutUint32(buf[l:], uint32(len(buf)-l-4))
+	}
+	return buf, nil
+}
+
 func parseTime(typ oid.Oid, s []byte) (time.Time, error) {
 	str := string(s)
 
@@ -303,6 +303,9 @@ func TestDecode(t *testing.T) {
 		{oid.T_text, formatText, []byte("hello world"), "hello world", ``},
 
 		{oid.T_uuid, formatBinary, []byte{0x12, 0x34}, ([]byte)(nil), `pq: unable to decode uuid; bad length: 2`},
+		{oid.T_pg_lsn, formatText, []byte("16/B374D848"), []byte("16/B374D848"), ``},
+		{oid.T_pg_lsn, formatBinary, []byte{0, 0, 0, 0x16, 0xb3, 0x74, 0xd8, 0x48}, []byte("16/B374D848"), ``},
+		{oid.T_pg_lsn, formatBinary, []byte{0x12, 0x34}, ([]byte)(nil), `pq: unable to decode pg_lsn; bad length: 2`},
 	}
 
 	for _, tt := range tests {
@@ -396,6 +399,66 @@ func TestAppendEscapedText(t *testing.T) {
 	}
 }
 
+func TestAppendBinary(t *testing.T) {
+	tests := []struct {
+		in      any
+		typ     oid.Oid
+		want    string
+		wantErr string
+	}{
+		{int64(-2), oid.T_int2, "fffe", ""},
+		{int64(1 << 20), oid.T_int2, "", "out of range for smallint"},
+		{"42", oid.T_int4, "0000002a", ""},
+		{int64(-1), oid.T_int8, "ffffffffffffffff", ""},
+		{1.5, oid.T_float4, "3fc00000", ""},
+		{1.5, oid.T_float8, "3ff8000000000000", ""},
+		{true, oid.T_bool, "01", ""},
+		{"f", oid.T_bool, "00", ""},
+		{int64(1), oid.T_bool, "", "cannot encode int64"},
+		{[]byte{0, 255}, oid.T_bytea, "00ff", ""},
+		{"hé", oid.T_text, "68c3a9", ""},
+		{`{}`, oid.T_jsonb, "017b7d", ""},
+		{time.Date(2000, 1, 1, 0, 0, 1, 0, time.UTC), oid.T_timestamptz, "00000000000f4240", ""},
+		{time.Date(2000, 1, 1, 1, 0, 0, 0, time.FixedZone("", 3600)), oid.T_timestamptz, "0000000000000000", ""},
+		{time.Date(2000, 1, 1, 1, 0, 0, 0, time.FixedZone("", 3600)), oid.T_timestamp, "00000000d693a400", ""},
+		{"1999-12-31", oid.T_date, "ffffffff", ""},
+		{"infinity", oid.T_date, "7fffffff", ""},
+		{"-infinity", oid.T_timestamp, "8000000000000000", ""},
+		{"03a3522f-8928-4987-84d6-937b36ec276f", oid.T_uuid, "03a3522f8928498784d6937b36ec276f", ""},
+		{"03a3522f", oid.T_uuid, "", "invalid uuid"},
+		{"16/B374D848", oid.T_pg_lsn, "00000016b374d848", ""},
+		{"16", oid.T_pg_lsn, "", "invalid LSN"},
+		{"0", oid.T_numeric, "0000000000000000", ""},
+		{"NaN", oid.T_numeric, "00000000c0000000", ""},
+		{"-12345.678", oid.T_numeric, "0003000140000003000109291a7c", ""},
+		{"0.0001", oid.T_numeric, "0001ffff000000040001", ""},
+		{"1e5", oid.T_numeric, "0001000100000000000a", ""},
+		{"1x", oid.T_numeric, "", "invalid input syntax for type numeric"},
+		{"1e9999999999", oid.T_numeric, "", "invalid input syntax for type numeric"},
+		{"1e9223372036854775807", oid.T_numeric, "", "invalid input syntax for type numeric"},
+		{"1e-9223372036854775808", oid.T_numeric, "", "invalid input syntax for type numeric"},
+		{"1e131072", oid.T_numeric, "", "invalid input syntax for type numeric"},
+		{"1e-16384", oid.T_numeric, "", "invalid input syntax for type numeric"},
+		{"{1,NULL}", oid.T__int4, "000000010000000100000017000000020000000100000004" + "00000001" + "ffffffff", ""},
+		{"{}", oid.T__text, "000000000000000000000019", ""},
+		{`{"\\x00ff"}`, oid.T__bytea, "000000010000000000000011000000010000000100000002" + "00ff", ""},
+		{[]byte{1}, oid.T_point, "01", ""},
+		{"x", oid.T_point, "", "don't know how to encode string"},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			have, err := appendBinary(nil, tt.in, tt.typ)
+			if !pqtest.ErrorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error:\nhave: %s\nwant: %s", err, tt.wantErr)
+			}
+			if tt.wantErr == "" && hex.EncodeToString(have) != tt.want {
+				t.Errorf("\nhave: %x\nwant: %s", have, tt.want)
+			}
+		})
+	}
+}
+
 func BenchmarkDecode(b *testing.B) {
 	b.Run("int64", func(b *testing.B) {
 		x := []byte("1234")
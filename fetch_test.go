@@ -0,0 +1,292 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lib/pq/internal/pqtest"
+	"github.com/lib/pq/internal/proto"
+	"github.com/lib/pq/oid"
+)
+
+func TestFetchSize(t *testing.T) {
+	t.Parallel()
+	db := pqtest.MustDB(t, "fetch_size=7")
+
+	count := func(ctx context.Context, q string, args ...any) int {
+		t.Helper()
+		rows, err := db.QueryContext(ctx, q, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var n, i int
+		for rows.Next() {
+			if err := rows.Scan(&i); err != nil {
+				t.Fatal(err)
+			}
+			n++
+			if i != n {
+				t.Fatalf("row %d has value %d", n, i)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	ctx := context.Background()
+	if n := count(ctx, `select generate_series(1, 100)`); n != 100 {
+		t.Errorf("wrong count: %d", n)
+	}
+	if n := count(ctx, `select generate_series(1, $1::int)`, 21); n != 21 {
+		t.Errorf("wrong count: %d", n)
+	}
+	if n := count(WithFetchSize(ctx, 1), `select generate_series(1, 3)`); n != 3 {
+		t.Errorf("wrong count: %d", n)
+	}
+	if n := count(WithFetchSize(ctx, 0), `select generate_series(1, 3)`); n != 3 {
+		t.Errorf("wrong count: %d", n)
+	}
+
+	// Close before reading all rows, in and outside a transaction.
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []interface {
+		Query(string, ...any) (*sql.Rows, error)
+	}{db, tx} {
+		rows, err := q.Query(`select generate_series(1, 100)`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.Next()
+		if err := rows.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Error after the first batch.
+	rows, err := db.Query(`select 1 / (10 - i) from generate_series(1, 20) i`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	if err := rows.Err(); !pqtest.ErrorContains(err, "division by zero") {
+		t.Errorf("wrong error: %v", err)
+	}
+	rows.Close()
+	if n := count(ctx, `select generate_series(1, 10)`); n != 10 {
+		t.Errorf("wrong count: %d", n)
+	}
+}
+
+func TestFetchSizeFake(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu  sync.Mutex
+		log []string
+	)
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		f.Startup(cn, nil)
+		var (
+			total, sent int
+			skip        bool
+		)
+		for {
+			code, msg, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			if skip && code != proto.Sync {
+				continue
+			}
+			mu.Lock()
+			switch code {
+			case proto.Query:
+				f.WriteMsg(cn, proto.EmptyQueryResponse, "")
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.Parse:
+				q := strings.Split(string(msg), "\x00")[1]
+				total, _ = strconv.Atoi(strings.TrimPrefix(q, "rows "))
+				f.WriteMsg(cn, proto.ParseComplete, "")
+			case proto.Describe:
+				f.WriteMsg(cn, proto.ParameterDescription, "\x00\x00")
+				b := binary.BigEndian.AppendUint16(nil, 1)
+				b = append(b, "i\x00"...)
+				b = append(b, 0, 0, 0, 0, 0, 0)
+				b = binary.BigEndian.AppendUint32(b, uint32(oid.T_text))
+				b = append(b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0)
+				f.WriteMsg(cn, proto.RowDescription, string(b))
+			case proto.Bind:
+				sent = 0
+				f.WriteMsg(cn, proto.BindComplete, "")
+			case proto.Execute:
+				max := int(binary.BigEndian.Uint32(msg[1:]))
+				log = append(log, "execute "+strconv.Itoa(max))
+				for n := 0; sent < total && (max == 0 || n < max); n++ {
+					sent++
+					if sent == 3 && total == 4 {
+						f.WriteMsg(cn, proto.ErrorResponse, "SERROR\x00C22012\x00Mdivision by zero\x00\x00")
+						skip = true
+						break
+					}
+					v := strconv.Itoa(sent)
+					f.WriteMsg(cn, proto.DataRow, "\x00\x01"+string(binary.BigEndian.AppendUint32(nil, uint32(len(v))))+v)
+				}
+				if skip {
+					break
+				}
+				if sent < total {
+					f.WriteMsg(cn, proto.PortalSuspended, "")
+				} else {
+					f.WriteMsg(cn, proto.CommandComplete, "SELECT "+strconv.Itoa(sent)+"\x00")
+				}
+			case proto.Sync:
+				if !skip {
+					log = append(log, "sync")
+				}
+				skip = false
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.Terminate:
+				cn.Close()
+				mu.Unlock()
+				return
+			}
+			mu.Unlock()
+		}
+	})
+	defer f.Close()
+
+	db := pqtest.MustDB(t, f.DSN()+" fetch_size=2")
+	db.SetMaxOpenConns(1)
+	query := func(ctx context.Context, q string, max int) ([]string, error) {
+		t.Helper()
+		rows, err := db.QueryContext(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var have []string
+		for rows.Next() && (max == 0 || len(have) < max) {
+			var s string
+			if err := rows.Scan(&s); err != nil {
+				t.Fatal(err)
+			}
+			have = append(have, s)
+		}
+		if err := rows.Close(); err != nil {
+			return have, err
+		}
+		return have, rows.Err()
+	}
+	check := func(wantLog []string) {
+		t.Helper()
+		mu.Lock()
+		defer mu.Unlock()
+		// Ignore the Sync for the Parse.
+		var l []string
+		for i, s := range log {
+			if s != "sync" || (i > 0 && log[i-1] != "sync") {
+				l = append(l, s)
+			}
+		}
+		if !reflect.DeepEqual(l, wantLog) {
+			t.Errorf("\nhave: %q\nwant: %q", l, wantLog)
+		}
+		log = nil
+	}
+
+	ctx := context.Background()
+	have, err := query(ctx, "rows 5", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1", "2", "3", "4", "5"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %q\nwant: %q", have, want)
+	}
+	check([]string{"execute 2", "execute 2", "execute 2", "sync"})
+
+	// A fetch size of 0 uses the simple query protocol.
+	if _, err := query(WithFetchSize(ctx, 0), "rows 5", 0); err != nil {
+		t.Fatal(err)
+	}
+	check(nil)
+
+	// Closing early doesn't fetch more rows.
+	have, err = query(WithFetchSize(ctx, 3), "rows 10", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %q\nwant: %q", have, want)
+	}
+	check([]string{"execute 3", "sync"})
+
+	// Error in the second batch.
+	have, err = query(ctx, "rows 4", 0)
+	if !pqtest.ErrorContains(err, "division by zero") {
+		t.Errorf("wrong error: %v", err)
+	}
+	if want := []string{"1", "2"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %q\nwant: %q", have, want)
+	}
+	check([]string{"execute 2", "execute 2"})
+
+	if _, err := query(ctx, "rows 1", 0); err != nil {
+		t.Fatal(err)
+	}
+	check([]string{"execute 2", "sync"})
+}
+
+// Rows for an empty query have no result, but closing them must still work.
+func TestFetchSizeEmptyQuery(t *testing.T) {
+	t.Parallel()
+
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		f.Startup(cn, nil)
+		for {
+			code, _, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			switch code {
+			case proto.Terminate:
+				cn.Close()
+				return
+			case proto.Query:
+				f.WriteMsg(cn, proto.EmptyQueryResponse, "")
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			}
+		}
+	})
+	defer f.Close()
+	db := pqtest.MustDB(t, f.DSN())
+
+	for _, q := range []string{"", "-- x", "/* x */"} {
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatalf("%q: %s", q, err)
+		}
+		if rows.Next() {
+			t.Errorf("%q: returned a row", q)
+		}
+		if err := rows.Close(); err != nil {
+			t.Errorf("%q: %s", q, err)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package pq
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/lib/pq/internal/proto"
+)
+
+// Maximum size of a GSSAPI-encrypted packet, including the length; from
+// PQ_GSS_MAX_PACKET_SIZE in libpq.
+const gssMaxPacket = 16384
+
+// Maximum amount of data to wrap in a single packet. There isn't a way to ask
+// the provider how large a wrapped token will be (gss_wrap_size_limit()), so
+// leave plenty of room for the overhead.
+const gssMaxWrap = gssMaxPacket - 4 - 1024
+
+var errGSSEncNotSupported = errors.New("pq: GSSAPI encryption is not supported by the server")
+
+// gssEncrypter gets the GSS provider to use for GSSAPI encryption, or nil if
+// GSSAPI encryption shouldn't be tried.
+func gssEncrypter(cfg Config, mode GSSEncMode) (GSSEncrypter, error) {
+	// Not necessary or supported over UNIX domain sockets, same as SSL.
+	if nw, _ := cfg.network(); mode == GSSEncModeDisable || nw == "unix" {
+		return nil, nil
+	}
+	var (
+		cli GSS
+		err error
+	)
+	if newGss != nil {
+		cli, err = newGss()
+		if err != nil {
+			if mode == GSSEncModeRequire {
+				return nil, fmt.Errorf("pq: kerberos error: %w", err)
+			}
+			return nil, nil
+		}
+	}
+	enc, ok := cli.(GSSEncrypter)
+	if !ok {
+		if mode == GSSEncModeRequire {
+			return nil, errors.New("pq: gssencmode=require: no GSSAPI provider with encryption support registered (auth/kerberos doesn't support encryption)")
+		}
+		return nil, nil
+	}
+	return enc, nil
+}
+
+// gssInitToken gets the initial token for the GSSAPI security context.
+func gssInitToken(cli GSS, cfg Config) ([]byte, error) {
+	// Use the supplied SPN if provided.
+	if cfg.KrbSpn != "" {
+		return cli.GetInitTokenFromSpn(cfg.KrbSpn)
+	}
+	// Allow the kerberos service name to be overridden.
+	service := "postgres"
+	if cfg.KrbSrvname != "" {
+		service = cfg.KrbSrvname
+	}
+	return cli.GetInitToken(cfg.Host, service)
+}
+
+// gssenc sends a GSSENCRequest, establishes the GSSAPI security context, and
+// replaces cn.c with a connection that encrypts all data with it.
+//
+// errGSSEncNotSupported is returned if the server rejected the request, in
+// which case the connection can still be used without GSSAPI encryption.
+func (cn *conn) gssenc(cfg Config, cli GSSEncrypter) error {
+	w := cn.writeBuf(0)
+	w.int32(proto.NegotiateGSSCode)
+	if err := cn.sendStartupPacket(w); err != nil {
+		return err
+	}
+
+	b := cn.scratch[:1]
+	_, err := io.ReadFull(cn.c, b)
+	if err != nil {
+		return err
+	}
+	cn.protoTrace.response("GSSENCResponse", b[0])
+	switch b[0] {
+	case 'G':
+	case 'N':
+		return errGSSEncNotSupported
+	default:
+		// Servers too old to know about GSSENCRequest respond with an error;
+		// the connection can't be used after that.
+		return fmt.Errorf("pq: unexpected response to GSSENCRequest: %q", b[0])
+	}
+
+	token, err := gssInitToken(cli, cfg)
+	if err != nil {
+		return fmt.Errorf("pq: failed to get Kerberos ticket: %w", err)
+	}
+	for {
+		if len(token) > 0 {
+			if err := writeGSSPacket(cn.c, token); err != nil {
+				return err
+			}
+		}
+
+		in, err := readGSSPacket(cn.c)
+		if err != nil {
+			return err
+		}
+		var done bool
+		done, token, err = cli.Continue(in)
+		if err != nil {
+			return fmt.Errorf("pq: kerberos error: %w", err)
+		}
+		if done {
+			if len(token) > 0 {
+				if err := writeGSSPacket(cn.c, token); err != nil {
+					return err
+				}
+			}
+			break
+		}
+	}
+
+	cn.c = &gssConn{Conn: cn.c, gss: cli}
+	return nil
+}
+
+// writeGSSPacket writes a packet with the length and data.
+func writeGSSPacket(c net.Conn, data []byte) error {
+	if len(data)+4 > gssMaxPacket {
+		return fmt.Errorf("pq: GSSAPI packet too large: %d bytes", len(data))
+	}
+	b := binary.BigEndian.AppendUint32(make([]byte, 0, len(data)+4), uint32(len(data)))
+	_, err := c.Write(append(b, data...))
+	return err
+}
+
+// readGSSPacket reads a packet written with writeGSSPacket by the server.
+func readGSSPacket(c net.Conn) ([]byte, error) {
+	l := make([]byte, 4)
+	_, err := io.ReadFull(c, l)
+	if err != nil {
+		return nil, err
+	}
+	// The server sends a plain ErrorResponse if it can't set up the security
+	// context; the message text follows a string of fields after the length.
+	if l[0] == byte(proto.ErrorResponse) {
+		b := make([]byte, 512)
+		n, _ := io.ReadAtLeast(c, b, 1)
+		msg := string(b[:n])
+		if i := strings.Index(msg, "\x00M"); i > -1 {
+			msg, _, _ = strings.Cut(msg[i+2:], "\x00")
+		}
+		return nil, fmt.Errorf("pq: GSSAPI encryption failed: %s", msg)
+	}
+	n := binary.BigEndian.Uint32(l)
+	if n > gssMaxPacket-4 {
+		return nil, fmt.Errorf("pq: GSSAPI packet too large: %d bytes", n)
+	}
+	data := make([]byte, n)
+	_, err = io.ReadFull(c, data)
+	return data, err
+}
+
+// gssConn encrypts all data written to the connection with GSSAPI and decrypts
+// all data read from it.
+type gssConn struct {
+	net.Conn
+	gss  GSSEncrypter
+	rbuf []byte // Decrypted data that hasn't been read yet.
+
+	// Packet that has been partially read, including the length. Read can fail
+	// halfway through a packet with a read deadline (e.g. from
+	// ReplicationConn.Receive), and continues with the rest on the next call.
+	in []byte
+}
+
+func (c *gssConn) Read(p []byte) (int, error) {
+	for len(c.rbuf) == 0 {
+		data, err := c.readPacket()
+		if err != nil {
+			return 0, err
+		}
+		c.rbuf, err = c.gss.Unwrap(data)
+		if err != nil {
+			return 0, fmt.Errorf("pq: GSSAPI unwrap error: %w", err)
+		}
+	}
+	n := copy(p, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+// readPacket reads the next packet from the server, and returns the data
+// without the length.
+func (c *gssConn) readPacket() ([]byte, error) {
+	if c.in == nil {
+		c.in = make([]byte, 0, 4)
+	}
+	for {
+		want := 4
+		if len(c.in) >= 4 {
+			n := binary.BigEndian.Uint32(c.in)
+			if n > gssMaxPacket-4 {
+				return nil, fmt.Errorf("pq: GSSAPI packet too large: %d bytes", n)
+			}
+			want += int(n)
+		}
+		if len(c.in) >= 4 && len(c.in) == want {
+			data := c.in[4:]
+			c.in = nil
+			return data, nil
+		}
+		if cap(c.in) < want {
+			c.in = append(make([]byte, 0, want), c.in...)
+		}
+		n, err := c.Conn.Read(c.in[len(c.in):want])
+		c.in = c.in[:len(c.in)+n]
+		if err != nil && len(c.in) < want {
+			return nil, err
+		}
+	}
+}
+
+func (c *gssConn) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		chunk := p[:min(len(p), gssMaxWrap)]
+		data, err := c.gss.Wrap(chunk)
+		if err != nil {
+			return n, fmt.Errorf("pq: GSSAPI wrap error: %w", err)
+		}
+		if err := writeGSSPacket(c.Conn, data); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
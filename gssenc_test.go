@@ -0,0 +1,224 @@
+package pq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lib/pq/internal/pqtest"
+	"github.com/lib/pq/internal/proto"
+)
+
+// fakeGSS is a GSS provider which "encrypts" data by inverting all bits; since
+// this is symmetrical it can also be used on the server side.
+type fakeGSS struct{ host, service string }
+
+func (g *fakeGSS) GetInitToken(host, service string) ([]byte, error) {
+	g.host, g.service = host, service
+	return []byte("init"), nil
+}
+func (g *fakeGSS) GetInitTokenFromSpn(spn string) ([]byte, error) { return []byte("init"), nil }
+func (g *fakeGSS) Continue(in []byte) (bool, []byte, error) {
+	if string(in) != "ok" {
+		return false, nil, errors.New("bad token")
+	}
+	return true, nil, nil
+}
+func (g *fakeGSS) Wrap(data []byte) ([]byte, error) {
+	out := make([]byte, len(data))
+	for i := range data {
+		out[i] = ^data[i]
+	}
+	return out, nil
+}
+func (g *fakeGSS) Unwrap(data []byte) ([]byte, error) { return g.Wrap(data) }
+
+func TestGSSEnc(t *testing.T) {
+	// Not parallel as it sets the global GSS provider.
+	t.Cleanup(func() { newGss = nil })
+
+	// readGSSENCRequest reads the GSSENCRequest and responds with resp.
+	readGSSENCRequest := func(t *testing.T, cn net.Conn, resp byte) bool {
+		b := make([]byte, 8)
+		if _, err := io.ReadFull(cn, b); err != nil {
+			return false
+		}
+		if binary.BigEndian.Uint32(b[4:]) != proto.NegotiateGSSCode {
+			t.Errorf("not a GSSENCRequest: %x", b)
+			return false
+		}
+		_, err := cn.Write([]byte{resp})
+		return err == nil
+	}
+	serve := func(f pqtest.Fake, cn net.Conn) {
+		f.Startup(cn, nil)
+		for {
+			code, _, ok := f.ReadMsg(cn)
+			if !ok || code == proto.Terminate {
+				cn.Close()
+				return
+			}
+			f.SimpleQuery(cn, "SELECT 1", "x", "hello")
+			f.WriteMsg(cn, proto.ReadyForQuery, "I")
+		}
+	}
+
+	query := func(t *testing.T, dsn string) error {
+		t.Helper()
+		db, err := pqtest.DB(t, dsn)
+		if err != nil {
+			return err
+		}
+		var s string
+		if err := db.QueryRow(`select 'hello'`).Scan(&s); err != nil {
+			return err
+		}
+		if s != "hello" {
+			t.Errorf("wrong value: %q", s)
+		}
+		return nil
+	}
+
+	t.Run("encrypted", func(t *testing.T) {
+		var (
+			gss   = new(fakeGSS)
+			token []byte
+		)
+		newGss = func() (GSS, error) { return gss, nil }
+		f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+			if !readGSSENCRequest(t, cn, 'G') {
+				return
+			}
+			var err error
+			token, err = readGSSPacket(cn)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err := writeGSSPacket(cn, []byte("ok")); err != nil {
+				t.Error(err)
+				return
+			}
+			serve(f, &gssConn{Conn: cn, gss: new(fakeGSS)})
+		})
+		defer f.Close()
+
+		for _, mode := range []string{"", "gssencmode=prefer", "gssencmode=require"} {
+			if err := query(t, f.DSN()+" sslmode=require krbsrvname=srv "+mode); err != nil {
+				t.Fatal(mode, err)
+			}
+			if string(token) != "init" || gss.host != f.Host() || gss.service != "srv" {
+				t.Errorf("token=%q; host=%q; service=%q", token, gss.host, gss.service)
+			}
+		}
+	})
+
+	t.Run("large", func(t *testing.T) {
+		newGss = func() (GSS, error) { return new(fakeGSS), nil }
+		f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+			if !readGSSENCRequest(t, cn, 'G') {
+				return
+			}
+			readGSSPacket(cn)
+			writeGSSPacket(cn, []byte("ok"))
+			gc := &gssConn{Conn: cn, gss: new(fakeGSS)}
+			f.Startup(gc, nil)
+			for {
+				code, msg, ok := f.ReadMsg(gc)
+				if !ok || code == proto.Terminate {
+					cn.Close()
+					return
+				}
+				f.SimpleQuery(gc, "SELECT 1", "x", string(msg[:len(msg)-1]))
+				f.WriteMsg(gc, proto.ReadyForQuery, "I")
+			}
+		})
+		defer f.Close()
+
+		db := pqtest.MustDB(t, f.DSN()+" gssencmode=require")
+		q := string(bytes.Repeat([]byte("0123456789"), gssMaxPacket/2))
+		var s string
+		if err := db.QueryRow(q).Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		if s != q {
+			t.Errorf("wrong value: len=%d", len(s))
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		newGss = func() (GSS, error) { return new(fakeGSS), nil }
+		f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+			if !readGSSENCRequest(t, cn, 'N') {
+				return
+			}
+			serve(f, cn)
+		})
+		defer f.Close()
+
+		if err := query(t, f.DSN()+" sslmode=disable"); err != nil {
+			t.Fatal(err)
+		}
+		err := query(t, f.DSN()+" sslmode=disable gssencmode=require")
+		if !errors.Is(err, errGSSEncNotSupported) {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+
+	t.Run("no encryption support", func(t *testing.T) {
+		f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) { serve(f, cn) })
+		defer f.Close()
+
+		for _, gss := range []NewGSSFunc{nil, func() (GSS, error) { return struct{ GSS }{}, nil }} {
+			newGss = gss
+			if err := query(t, f.DSN()+" sslmode=disable"); err != nil {
+				t.Fatal(err)
+			}
+			if err := query(t, f.DSN()+" sslmode=disable gssencmode=disable"); err != nil {
+				t.Fatal(err)
+			}
+			err := query(t, f.DSN()+" sslmode=disable gssencmode=require")
+			if !pqtest.ErrorContains(err, "no GSSAPI provider with encryption support") {
+				t.Errorf("wrong error: %v", err)
+			}
+		}
+	})
+}
+
+func TestGSSConnReadTimeout(t *testing.T) {
+	t.Parallel()
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	var (
+		c    = &gssConn{Conn: client, gss: new(fakeGSS)}
+		data = []byte{0, 0, 0, 5, ^byte('h'), ^byte('e'), ^byte('l'), ^byte('l'), ^byte('o')}
+		buf  = make([]byte, 16)
+	)
+	// Time out after the length and again after part of the data; the next
+	// Read continues with the same packet.
+	for _, part := range [][]byte{data[:2], data[2:6]} {
+		go server.Write(part)
+		time.Sleep(10 * time.Millisecond)
+		c.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+		_, err := c.Read(buf)
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("wrong error: %v", err)
+		}
+	}
+	c.SetReadDeadline(time.Time{})
+	go server.Write(data[6:])
+	n, err := c.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "hello" {
+		t.Errorf("wrong data: %q", buf[:n])
+	}
+}
@@ -0,0 +1,312 @@
+// Package pkcs decrypts password-protected private keys and reads PKCS #12
+// files, with only the standard library.
+//
+// Supported are PBES2 (PBKDF2 with AES-CBC or 3DES-CBC), and the PKCS #12
+// pbeWithSHAAnd3-KeyTripleDES-CBC scheme. The latter is also used by older
+// versions of OpenSSL and Windows for PKCS #12 files. The RC2-based schemes
+// aren't supported.
+package pkcs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrPassword is returned if the data can't be decrypted with the password.
+var ErrPassword = errors.New("incorrect password")
+
+var (
+	oidPBES2             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidPBEWithSHA3DESCBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+// DecryptPKCS8 decrypts the DER-encoded EncryptedPrivateKeyInfo ("ENCRYPTED
+// PRIVATE KEY" PEM block), and returns the DER-encoded PKCS #8 private key.
+func DecryptPKCS8(der []byte, password string) ([]byte, error) {
+	var info struct {
+		Algo pkix.AlgorithmIdentifier
+		Data []byte
+	}
+	if rest, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("invalid encrypted private key: %w", err)
+	} else if len(rest) > 0 {
+		return nil, errors.New("invalid encrypted private key: trailing data")
+	}
+	return decrypt(info.Algo, password, info.Data)
+}
+
+// DecryptPEMBlock decrypts a PEM block encrypted with the legacy OpenSSL
+// encryption ("Proc-Type: 4,ENCRYPTED" header), and returns the DER-encoded
+// data.
+func DecryptPEMBlock(b *pem.Block, password string) ([]byte, error) {
+	cipherName, ivHex, ok := strings.Cut(b.Headers["DEK-Info"], ",")
+	if !ok {
+		return nil, errors.New("invalid DEK-Info header")
+	}
+	iv, err := hex.DecodeString(ivHex)
+	if err != nil || len(iv) < 8 {
+		return nil, errors.New("invalid DEK-Info header")
+	}
+
+	var (
+		newCipher func([]byte) (cipher.Block, error)
+		keyLen    int
+	)
+	switch cipherName {
+	case "AES-128-CBC", "AES-192-CBC", "AES-256-CBC":
+		newCipher = aes.NewCipher
+		keyLen = map[string]int{"AES-128-CBC": 16, "AES-192-CBC": 24, "AES-256-CBC": 32}[cipherName]
+	case "DES-EDE3-CBC":
+		newCipher, keyLen = des.NewTripleDESCipher, 24
+	case "DES-CBC":
+		newCipher, keyLen = des.NewCipher, 8
+	default:
+		return nil, fmt.Errorf("unsupported PEM encryption %q", cipherName)
+	}
+
+	// EVP_BytesToKey() with MD5, one iteration, and the first 8 bytes of the
+	// IV as the salt.
+	var key, d []byte
+	for len(key) < keyLen {
+		h := md5.New()
+		h.Write(d)
+		h.Write([]byte(password))
+		h.Write(iv[:8])
+		d = h.Sum(nil)
+		key = append(key, d...)
+	}
+	block, err := newCipher(key[:keyLen])
+	if err != nil {
+		return nil, err
+	}
+	return decryptCBC(block, iv, b.Bytes)
+}
+
+// decrypt decrypts data with the password-based encryption scheme algo.
+func decrypt(algo pkix.AlgorithmIdentifier, password string, data []byte) ([]byte, error) {
+	switch {
+	case algo.Algorithm.Equal(oidPBES2):
+		return decryptPBES2(algo.Parameters.FullBytes, []byte(password), data)
+	case algo.Algorithm.Equal(oidPBEWithSHA3DESCBC):
+		var params struct {
+			Salt []byte
+			Iter int
+		}
+		if _, err := asn1.Unmarshal(algo.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("invalid PBE parameters: %w", err)
+		}
+		pw := bmpString(password)
+		key := pkcs12KDF(sha1.New, 64, pw, params.Salt, 1, params.Iter, 24)
+		iv := pkcs12KDF(sha1.New, 64, pw, params.Salt, 2, params.Iter, 8)
+		block, err := des.NewTripleDESCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return decryptCBC(block, iv, data)
+	default:
+		return nil, fmt.Errorf("unsupported encryption algorithm %s", algo.Algorithm)
+	}
+}
+
+func decryptPBES2(params, password, data []byte) ([]byte, error) {
+	var pbes2 struct {
+		KDF pkix.AlgorithmIdentifier
+		Enc pkix.AlgorithmIdentifier
+	}
+	if _, err := asn1.Unmarshal(params, &pbes2); err != nil {
+		return nil, fmt.Errorf("invalid PBES2 parameters: %w", err)
+	}
+	if !pbes2.KDF.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s", pbes2.KDF.Algorithm)
+	}
+	var kdf struct {
+		Salt   []byte
+		Iter   int
+		KeyLen int                      `asn1:"optional"`
+		PRF    pkix.AlgorithmIdentifier `asn1:"optional"`
+	}
+	if _, err := asn1.Unmarshal(pbes2.KDF.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("invalid PBKDF2 parameters: %w", err)
+	}
+
+	prf := sha1.New
+	switch {
+	case len(kdf.PRF.Algorithm) == 0 || kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA224):
+		prf = sha256.New224
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA384):
+		prf = sha512.New384
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 function %s", kdf.PRF.Algorithm)
+	}
+
+	var (
+		newCipher func([]byte) (cipher.Block, error)
+		keyLen    int
+	)
+	switch {
+	case pbes2.Enc.Algorithm.Equal(oidAES128CBC):
+		newCipher, keyLen = aes.NewCipher, 16
+	case pbes2.Enc.Algorithm.Equal(oidAES192CBC):
+		newCipher, keyLen = aes.NewCipher, 24
+	case pbes2.Enc.Algorithm.Equal(oidAES256CBC):
+		newCipher, keyLen = aes.NewCipher, 32
+	case pbes2.Enc.Algorithm.Equal(oidDESEDE3CBC):
+		newCipher, keyLen = des.NewTripleDESCipher, 24
+	default:
+		return nil, fmt.Errorf("unsupported encryption algorithm %s", pbes2.Enc.Algorithm)
+	}
+	if kdf.KeyLen != 0 && kdf.KeyLen != keyLen {
+		return nil, fmt.Errorf("invalid PBKDF2 key length %d", kdf.KeyLen)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(pbes2.Enc.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("invalid IV: %w", err)
+	}
+
+	block, err := newCipher(pbkdf2(prf, password, kdf.Salt, kdf.Iter, keyLen))
+	if err != nil {
+		return nil, err
+	}
+	return decryptCBC(block, iv, data)
+}
+
+// decryptCBC decrypts data in CBC mode and removes the PKCS #7 padding.
+func decryptCBC(block cipher.Block, iv, data []byte) ([]byte, error) {
+	bs := block.BlockSize()
+	if len(iv) != bs {
+		return nil, fmt.Errorf("invalid IV length %d", len(iv))
+	}
+	if len(data) == 0 || len(data)%bs != 0 {
+		return nil, errors.New("invalid length of encrypted data")
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	// Invalid padding is the only indication of a wrong password we get.
+	n := int(out[len(out)-1])
+	if n == 0 || n > bs || !bytes.Equal(out[len(out)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, ErrPassword
+	}
+	return out[:len(out)-n], nil
+}
+
+// pbkdf2 derives a key as described in RFC 8018 section 5.2.
+func pbkdf2(prf func() hash.Hash, password, salt []byte, iter, keyLen int) []byte {
+	var (
+		mac = hmac.New(prf, password)
+		key = make([]byte, 0, keyLen)
+		u   []byte
+	)
+	for block := uint32(1); len(key) < keyLen; block++ {
+		mac.Reset()
+		mac.Write(salt)
+		mac.Write(binary.BigEndian.AppendUint32(nil, block))
+		u = mac.Sum(u[:0])
+		t := bytes.Clone(u)
+		for i := 1; i < iter; i++ {
+			mac.Reset()
+			mac.Write(u)
+			u = mac.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// pkcs12KDF derives a key as described in RFC 7292 appendix B.2; v is the
+// block size of the hash function and id is the purpose of the key (1 for
+// keys, 2 for IVs, and 3 for MAC keys).
+func pkcs12KDF(h func() hash.Hash, v int, password, salt []byte, id byte, iter, n int) []byte {
+	fill := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(b)+v-1)/v))
+		for i := range out {
+			out[i] = b[i%len(b)]
+		}
+		return out
+	}
+
+	var (
+		d   = bytes.Repeat([]byte{id}, v)
+		i   = append(fill(salt), fill(password)...)
+		out = make([]byte, 0, n)
+	)
+	for {
+		hh := h()
+		hh.Write(d)
+		hh.Write(i)
+		a := hh.Sum(nil)
+		for j := 1; j < iter; j++ {
+			hh.Reset()
+			hh.Write(a)
+			a = hh.Sum(a[:0])
+		}
+		out = append(out, a...)
+		if len(out) >= n {
+			return out[:n]
+		}
+
+		// Set every v-byte block of i to (i + b + 1) mod 2^(v*8), where b is a
+		// repeated to v bytes.
+		b := make([]byte, v)
+		for j := range b {
+			b[j] = a[j%len(a)]
+		}
+		for j := 0; j < len(i); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				s := int(i[j+k]) + int(b[k]) + carry
+				i[j+k], carry = byte(s), s>>8
+			}
+		}
+	}
+}
+
+// bmpString encodes s as a NULL-terminated UTF-16BE string, which is used as
+// the password for the PKCS #12 key derivation function.
+func bmpString(s string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = binary.BigEndian.AppendUint16(b, c)
+	}
+	return append(b, 0, 0)
+}
@@ -0,0 +1,197 @@
+package pkcs
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+
+	oidKeyBag              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidPKCS8ShroudedKeyBag = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA224 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 4}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"` // Bytes is the encoded content.
+}
+
+type pfx struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  struct {
+		Mac struct {
+			Algo   pkix.AlgorithmIdentifier
+			Digest []byte
+		}
+		Salt []byte
+		Iter int `asn1:"optional,default:1"`
+	} `asn1:"optional"`
+}
+
+type encryptedData struct {
+	Version int
+	Info    struct {
+		ContentType asn1.ObjectIdentifier
+		Algo        pkix.AlgorithmIdentifier
+		Content     asn1.RawValue `asn1:"tag:0,optional"`
+	}
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue   `asn1:"tag:0,explicit"` // Bytes is the encoded value.
+	Attributes []asn1.RawValue `asn1:"set,optional"`
+}
+
+// DecodePKCS12 decodes a DER-encoded PKCS #12 file with a private key and the
+// certificate for it, and returns the key, certificate, and any other
+// certificates in the file.
+func DecodePKCS12(der []byte, password string) (crypto.PrivateKey, *x509.Certificate, []*x509.Certificate, error) {
+	var p pfx
+	if rest, err := asn1.Unmarshal(der, &p); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid PKCS #12 file: %w", err)
+	} else if len(rest) > 0 {
+		return nil, nil, nil, errors.New("invalid PKCS #12 file: trailing data")
+	}
+	if p.Version != 3 {
+		return nil, nil, nil, fmt.Errorf("unsupported PKCS #12 version %d", p.Version)
+	}
+	if !p.AuthSafe.ContentType.Equal(oidData) {
+		return nil, nil, nil, errors.New("unsupported PKCS #12 file: only password integrity mode is supported")
+	}
+	var authSafe []byte
+	if _, err := asn1.Unmarshal(p.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid PKCS #12 file: %w", err)
+	}
+
+	if len(p.MacData.Mac.Algo.Algorithm) > 0 {
+		var h func() hash.Hash
+		switch a := p.MacData.Mac.Algo.Algorithm; {
+		case a.Equal(oidSHA1):
+			h = sha1.New
+		case a.Equal(oidSHA224):
+			h = sha256.New224
+		case a.Equal(oidSHA256):
+			h = sha256.New
+		case a.Equal(oidSHA384):
+			h = sha512.New384
+		case a.Equal(oidSHA512):
+			h = sha512.New
+		default:
+			return nil, nil, nil, fmt.Errorf("unsupported PKCS #12 MAC algorithm %s", a)
+		}
+		key := pkcs12KDF(h, h().BlockSize(), bmpString(password), p.MacData.Salt, 3, p.MacData.Iter, h().Size())
+		mac := hmac.New(h, key)
+		mac.Write(authSafe)
+		if !hmac.Equal(mac.Sum(nil), p.MacData.Mac.Digest) {
+			return nil, nil, nil, ErrPassword
+		}
+	}
+
+	var contents []contentInfo
+	if _, err := asn1.Unmarshal(authSafe, &contents); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid PKCS #12 file: %w", err)
+	}
+	var (
+		keys  []crypto.PrivateKey
+		certs []*x509.Certificate
+	)
+	for _, ci := range contents {
+		var data []byte
+		switch {
+		case ci.ContentType.Equal(oidData):
+			if _, err := asn1.Unmarshal(ci.Content.Bytes, &data); err != nil {
+				return nil, nil, nil, fmt.Errorf("invalid PKCS #12 file: %w", err)
+			}
+		case ci.ContentType.Equal(oidEncryptedData):
+			var ed encryptedData
+			if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+				return nil, nil, nil, fmt.Errorf("invalid PKCS #12 file: %w", err)
+			}
+			var err error
+			data, err = decrypt(ed.Info.Algo, password, ed.Info.Content.Bytes)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+		default:
+			return nil, nil, nil, fmt.Errorf("unsupported PKCS #12 content type %s", ci.ContentType)
+		}
+
+		var bags []safeBag
+		if _, err := asn1.Unmarshal(data, &bags); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid PKCS #12 file: %w", err)
+		}
+		for _, bag := range bags {
+			switch {
+			case bag.ID.Equal(oidKeyBag), bag.ID.Equal(oidPKCS8ShroudedKeyBag):
+				k := bag.Value.Bytes
+				if bag.ID.Equal(oidPKCS8ShroudedKeyBag) {
+					var err error
+					k, err = DecryptPKCS8(k, password)
+					if err != nil {
+						return nil, nil, nil, err
+					}
+				}
+				key, err := x509.ParsePKCS8PrivateKey(k)
+				if err != nil {
+					return nil, nil, nil, fmt.Errorf("invalid private key in PKCS #12 file: %w", err)
+				}
+				keys = append(keys, key)
+			case bag.ID.Equal(oidCertBag):
+				var cb struct {
+					ID    asn1.ObjectIdentifier
+					Value []byte `asn1:"tag:0,explicit"`
+				}
+				if _, err := asn1.Unmarshal(bag.Value.Bytes, &cb); err != nil {
+					return nil, nil, nil, fmt.Errorf("invalid certificate in PKCS #12 file: %w", err)
+				}
+				if !cb.ID.Equal(oidX509Certificate) {
+					continue
+				}
+				cert, err := x509.ParseCertificate(cb.Value)
+				if err != nil {
+					return nil, nil, nil, fmt.Errorf("invalid certificate in PKCS #12 file: %w", err)
+				}
+				certs = append(certs, cert)
+			}
+		}
+	}
+
+	if len(keys) != 1 {
+		return nil, nil, nil, fmt.Errorf("PKCS #12 file must contain one private key, but it contains %d", len(keys))
+	}
+	key, ok := keys[0].(crypto.Signer)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unsupported private key type %T in PKCS #12 file", keys[0])
+	}
+	pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("unsupported private key type %T in PKCS #12 file", keys[0])
+	}
+	for i, c := range certs {
+		if pub.Equal(c.PublicKey) {
+			return key, c, append(certs[:i:i], certs[i+1:]...), nil
+		}
+	}
+	return nil, nil, nil, errors.New("PKCS #12 file doesn't contain a certificate for the private key")
+}
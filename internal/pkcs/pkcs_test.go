@@ -0,0 +1,119 @@
+package pkcs
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"testing"
+)
+
+func readPEM(t *testing.T, path string) *pem.Block {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := pem.Decode(data)
+	if b == nil {
+		t.Fatalf("no PEM data in %s", path)
+	}
+	return b
+}
+
+func TestDecrypt(t *testing.T) {
+	want, err := x509.ParsePKCS8PrivateKey(readPEM(t, "../../testdata/ssl/postgresql.key").Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file     string
+		password string
+		wantErr  error
+	}{
+		{"postgresql_pkcs8.key", "pqgo", nil},
+		{"postgresql_pkcs8_3des.key", "pqgo", nil},
+		{"postgresql_legacy.key", "pqgo", nil},
+		{"postgresql_pkcs8.key", "wrong", ErrPassword},
+		{"postgresql_pkcs8_3des.key", "wrong", ErrPassword},
+		{"postgresql_legacy.key", "wrong", ErrPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file+"/"+tt.password, func(t *testing.T) {
+			b := readPEM(t, "../../testdata/ssl/"+tt.file)
+			var (
+				der []byte
+				err error
+			)
+			if b.Type == "ENCRYPTED PRIVATE KEY" {
+				der, err = DecryptPKCS8(b.Bytes, tt.password)
+			} else {
+				der, err = DecryptPEMBlock(b, tt.password)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("wrong error\nhave: %v\nwant: %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			var key any
+			if b.Type == "ENCRYPTED PRIVATE KEY" {
+				key, err = x509.ParsePKCS8PrivateKey(der)
+			} else {
+				key, err = x509.ParsePKCS1PrivateKey(der)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !want.(*rsa.PrivateKey).Equal(key) {
+				t.Error("wrong key")
+			}
+		})
+	}
+}
+
+func TestDecodePKCS12(t *testing.T) {
+	var (
+		wantKey, _ = x509.ParsePKCS8PrivateKey(readPEM(t, "../../testdata/ssl/postgresql.key").Bytes)
+		wantCert   = readPEM(t, "../../testdata/ssl/postgresql.crt").Bytes
+		wantRoot   = readPEM(t, "../../testdata/ssl/root.crt").Bytes
+	)
+
+	tests := []struct {
+		file     string
+		password string
+		wantErr  error
+	}{
+		{"postgresql.p12", "pqgo", nil},
+		{"postgresql_legacy.p12", "pqgo", nil},
+		{"postgresql.p12", "wrong", ErrPassword},
+		{"postgresql_legacy.p12", "", ErrPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file+"/"+tt.password, func(t *testing.T) {
+			data, err := os.ReadFile("../../testdata/ssl/" + tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, cert, chain, err := DecodePKCS12(data, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("wrong error\nhave: %v\nwant: %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if !wantKey.(*rsa.PrivateKey).Equal(key) {
+				t.Error("wrong key")
+			}
+			if string(cert.Raw) != string(wantCert) {
+				t.Errorf("wrong certificate: %s", cert.Subject)
+			}
+			if len(chain) != 1 || string(chain[0].Raw) != string(wantRoot) {
+				t.Errorf("wrong chain: %v", chain)
+			}
+		})
+	}
+}
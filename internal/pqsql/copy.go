@@ -1,5 +1,7 @@
 package pqsql
 
+import "strings"
+
 // StartsWithCopy reports if the SQL strings start with "copy", ignoring
 // whitespace, comments, and casing.
 func StartsWithCopy(query string) bool {
@@ -35,3 +37,141 @@ func StartsWithCopy(query string) bool {
 	}
 	return false
 }
+
+// CopyFrom is a parsed "COPY [..] FROM STDIN" statement.
+type CopyFrom struct {
+	Table   string // Table name, as it appears in the query (may be quoted or schema-qualified).
+	Columns string // Column list without parenthesis, as it appears in the query; empty if omitted.
+	Binary  bool   // Binary format is used.
+}
+
+// ParseCopyFrom parses a "COPY [..] FROM STDIN" statement. It only parses as
+// much as is needed to get the table, columns, and whether the binary format
+// is used; it returns false if the statement doesn't look like a COPY FROM
+// STDIN.
+func ParseCopyFrom(query string) (CopyFrom, bool) {
+	var (
+		c    CopyFrom
+		toks = tokenize(query)
+		i    int
+		kw   = func(t token, w string) bool { return t.kind == tokIdent && strings.EqualFold(t.text, w) }
+	)
+	if len(toks) < 4 || !kw(toks[0], "copy") {
+		return c, false
+	}
+
+	// Table name: identifiers separated by dots.
+	i = 1
+	start := i
+	for i < len(toks) && (toks[i].kind == tokIdent || toks[i].kind == tokQuotedIdent || toks[i].text == ".") {
+		if kw(toks[i], "from") {
+			break
+		}
+		i++
+	}
+	if i == start || i >= len(toks) {
+		return c, false
+	}
+	c.Table = query[toks[start].pos : toks[i-1].pos+len(toks[i-1].text)]
+
+	// Optional column list.
+	if toks[i].text == "(" {
+		open := i
+		for i < len(toks) && toks[i].text != ")" {
+			i++
+		}
+		if i >= len(toks) {
+			return c, false
+		}
+		if i > open+1 {
+			c.Columns = query[toks[open+1].pos : toks[i-1].pos+len(toks[i-1].text)]
+		}
+		i++
+	}
+
+	if i+1 >= len(toks) || !kw(toks[i], "from") || !kw(toks[i+1], "stdin") {
+		return c, false
+	}
+
+	// Options; stop at WHERE as "binary" may appear as a value there.
+	for _, t := range toks[i+2:] {
+		if kw(t, "where") {
+			break
+		}
+		if kw(t, "binary") || (t.kind == tokString && strings.EqualFold(t.text, "'binary'")) {
+			c.Binary = true
+		}
+	}
+	return c, true
+}
+
+type tokenKind uint8
+
+const (
+	tokIdent tokenKind = iota
+	tokQuotedIdent
+	tokString
+	tokOther
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// tokenize splits the query in to tokens, skipping whitespace and comments.
+// This is not a full SQL lexer, but good enough to pick apart simple
+// statements.
+func tokenize(query string) []token {
+	var toks []token
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			i += 2
+			for i+1 < len(query) && !(query[i] == '*' && query[i+1] == '/') {
+				i++
+			}
+			i += 2
+		case c == '"' || c == '\'':
+			start := i
+			for i++; i < len(query); i++ {
+				if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c { // Escaped "" or ''
+						i++
+						continue
+					}
+					break
+				}
+			}
+			i++
+			kind := tokQuotedIdent
+			if c == '\'' {
+				kind = tokString
+			}
+			toks = append(toks, token{kind: kind, text: query[start:min(i, len(query))], pos: start})
+		case isIdent(c, true):
+			start := i
+			for i < len(query) && isIdent(query[i], false) {
+				i++
+			}
+			toks = append(toks, token{kind: tokIdent, text: query[start:i], pos: start})
+		default:
+			toks = append(toks, token{kind: tokOther, text: query[i : i+1], pos: i})
+			i++
+		}
+	}
+	return toks
+}
+
+func isIdent(c byte, first bool) bool {
+	return c == '_' || c >= 0x80 || (c|0x20 >= 'a' && c|0x20 <= 'z') ||
+		(!first && (c == '$' || (c >= '0' && c <= '9')))
+}
@@ -51,3 +51,47 @@ func BenchmarkStartsWithCopy(b *testing.B) {
 		_ = StartsWithCopy(sql)
 	}
 }
+
+func TestParseCopyFrom(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   CopyFrom
+		wantOK bool
+	}{
+		{`copy tbl from stdin`, CopyFrom{Table: "tbl"}, true},
+		{`COPY tbl FROM STDIN;`, CopyFrom{Table: "tbl"}, true},
+		{`copy tbl (a, b) from stdin`, CopyFrom{Table: "tbl", Columns: "a, b"}, true},
+		{`copy tbl(a,"B c") from stdin`, CopyFrom{Table: "tbl", Columns: `a,"B c"`}, true},
+		{`copy "My ""tbl""" from stdin`, CopyFrom{Table: `"My ""tbl"""`}, true},
+		{`copy sch.tbl from stdin`, CopyFrom{Table: "sch.tbl"}, true},
+		{`copy "sch" . "tbl" from stdin`, CopyFrom{Table: `"sch" . "tbl"`}, true},
+		{"-- comment\n/* c */ copy tbl () from stdin", CopyFrom{Table: "tbl"}, true},
+
+		{`copy tbl from stdin binary`, CopyFrom{Table: "tbl", Binary: true}, true},
+		{`copy tbl from stdin with binary`, CopyFrom{Table: "tbl", Binary: true}, true},
+		{`copy tbl from stdin (format binary)`, CopyFrom{Table: "tbl", Binary: true}, true},
+		{`copy tbl from stdin with (FORMAT 'binary')`, CopyFrom{Table: "tbl", Binary: true}, true},
+		{`copy tbl from stdin (format csv)`, CopyFrom{Table: "tbl"}, true},
+		{`copy tbl from stdin where t = 'binary'`, CopyFrom{Table: "tbl"}, true},
+		{`copy tbl from stdin where t = binary`, CopyFrom{Table: "tbl"}, true},
+
+		{`copy tbl to stdout`, CopyFrom{}, false},
+		{`copy tbl from '/file'`, CopyFrom{}, false},
+		{`copy (select 1) to stdout`, CopyFrom{}, false},
+		{`copy tbl (a, b from stdin`, CopyFrom{}, false},
+		{`select 1`, CopyFrom{}, false},
+		{`copy`, CopyFrom{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			have, ok := ParseCopyFrom(tt.input)
+			if ok != tt.wantOK {
+				t.Fatalf("ok: want %v; have %v", tt.wantOK, ok)
+			}
+			if ok && have != tt.want {
+				t.Errorf("\nwant: %#v\nhave: %#v", tt.want, have)
+			}
+		})
+	}
+}
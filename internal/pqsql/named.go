@@ -0,0 +1,152 @@
+package pqsql
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Named rewrites @name and :name placeholders in the query to $n, and returns
+// the rewritten query and the name for every $n. The same name is always
+// rewritten to the same $n.
+//
+// Placeholders in string literals, quoted identifiers, dollar-quoted strings,
+// and comments are ignored, as are type casts (::), array slices like [1:n],
+// and operators like @>, <@, or @@. A @ directly before a name is always a
+// placeholder, even if it was meant as the prefix @ operator.
+//
+// The query is returned unchanged with nil names if it doesn't have any named
+// placeholders or if it already uses $n placeholders.
+func Named(query string) (string, []string) {
+	var (
+		b     strings.Builder
+		names []string
+		last  int // Start of the query that isn't copied to b yet.
+	)
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			// Block comments can be nested.
+			depth := 0
+			for i+1 < len(query) {
+				if query[i] == '/' && query[i+1] == '*' {
+					depth++
+					i += 2
+				} else if query[i] == '*' && query[i+1] == '/' {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+			if depth > 0 {
+				i = len(query)
+			}
+		case c == '\'' || c == '"':
+			// E'..' strings can have backslash escapes.
+			escapes := c == '\'' && i > 0 && query[i-1]|0x20 == 'e' && (i == 1 || !isIdent(query[i-2], false))
+			for i++; i < len(query); i++ {
+				if escapes && query[i] == '\\' {
+					i++
+					continue
+				}
+				if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c { // Escaped "" or ''
+						i++
+						continue
+					}
+					break
+				}
+			}
+			i++
+		case isIdent(c, true):
+			for i < len(query) && isIdent(query[i], false) {
+				i++
+			}
+		case c == '$':
+			if i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9' {
+				return query, nil // Positional $n.
+			}
+			// Dollar-quoted string: $tag$ .. $tag$, where the tag is optional.
+			j := i + 1
+			for j < len(query) && query[j] != '$' && isIdent(query[j], j == i+1) {
+				j++
+			}
+			if j >= len(query) || query[j] != '$' {
+				i++
+				continue
+			}
+			tag := query[i : j+1]
+			if end := strings.Index(query[j+1:], tag); end >= 0 {
+				i = j + 1 + end + len(tag)
+			} else {
+				i = len(query)
+			}
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			i += 2
+		case isPlaceholder(query, i):
+			j := i + 1
+			for j < len(query) && isName(query[j], false) {
+				j++
+			}
+			name := query[i+1 : j]
+			n := 0
+			for k, nn := range names {
+				if nn == name {
+					n = k + 1
+					break
+				}
+			}
+			if n == 0 {
+				names = append(names, name)
+				n = len(names)
+			}
+			b.WriteString(query[last:i])
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			i, last = j, j
+		default:
+			i++
+		}
+	}
+	if names == nil {
+		return query, nil
+	}
+	b.WriteString(query[last:])
+	return b.String(), names
+}
+
+// isPlaceholder reports if there is a named placeholder at query[i]. A @ after
+// an operator character is part of the operator (e.g. <@), and a : after [, ),
+// or ] is an array slice (or a cast after :). Neither can follow an identifier
+// or number.
+func isPlaceholder(query string, i int) bool {
+	c := query[i]
+	if (c != ':' && c != '@') || i+1 >= len(query) || !isName(query[i+1], true) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	p := query[i-1]
+	if isIdent(p, false) {
+		return false
+	}
+	if c == '@' {
+		return !strings.ContainsRune("+-*/<>=~!@#%^&|`?", rune(p))
+	}
+	return p != ':' && p != '[' && p != ')' && p != ']'
+}
+
+// isName reports if c can be used in names for named placeholders, which
+// are the same as for sql.Named: letters, digits, and underscores.
+func isName(c byte, first bool) bool {
+	return c != '$' && c < 0x80 && isIdent(c, first)
+}
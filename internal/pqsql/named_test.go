@@ -0,0 +1,80 @@
+package pqsql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNamed(t *testing.T) {
+	tests := []struct {
+		input     string
+		want      string
+		wantNames []string
+	}{
+		{"select @id", "select $1", []string{"id"}},
+		{"select :id", "select $1", []string{"id"}},
+		{"select * from t where a = @a and b = :b_2", "select * from t where a = $1 and b = $2", []string{"a", "b_2"}},
+		{"select @a, @b, @a", "select $1, $2, $1", []string{"a", "b"}},
+		{"insert into t values (@a,@b)", "insert into t values ($1,$2)", []string{"a", "b"}},
+		{"select @a::int, :b::text", "select $1::int, $2::text", []string{"a", "b"}},
+		{"select * from t where id=:id", "select * from t where id=$1", []string{"id"}},
+		{"select * from t where tags <@ @tags", "select * from t where tags <@ $1", []string{"tags"}},
+		{"select arr[@i:@j], arr[:n]", "select arr[$1:$2], arr[:n]", []string{"i", "j"}},
+		// Can't be distinguished from the prefix @ operator; this is why
+		// rewriting prepared statements is opt-in.
+		{"select @x from t", "select $1 from t", []string{"x"}},
+
+		// Not placeholders.
+		{"select 1", "select 1", nil},
+		{"", "", nil},
+		{"@", "@", nil},
+		{":", ":", nil},
+		{"select x::int", "select x::int", nil},
+		{"select a @> b, t @@ q, x@@q, @ -1", "select a @> b, t @@ q, x@@q, @ -1", nil},
+		{"select arr[1:n], arr[i:n], a:b", "select arr[1:n], arr[i:n], a:b", nil},
+		{"select arr[:hi], arr[f(i):n], arr[1][:n]", "select arr[:hi], arr[f(i):n], arr[1][:n]", nil},
+		{"select * from t where tags <@array['a']", "select * from t where tags <@array['a']", nil},
+		{"select a<@b, a>@b, a=@b, a||@b, -@b, |/@b", "select a<@b, a>@b, a=@b, a||@b, -@b, |/@b", nil},
+		{"select '@a :b'", "select '@a :b'", nil},
+		{"select 'it''s @a'", "select 'it''s @a'", nil},
+		{`select E'\' @a'`, `select E'\' @a'`, nil},
+		{`select "@a"`, `select "@a"`, nil},
+		{`select "a"":b"`, `select "a"":b"`, nil},
+		{"select $$ @a $$", "select $$ @a $$", nil},
+		{"select $x$ @a $$ :b $x$", "select $x$ @a $$ :b $x$", nil},
+		{"select 1 -- @a", "select 1 -- @a", nil},
+		{"select /* @a /* :b */ @c */ 1", "select /* @a /* :b */ @c */ 1", nil},
+		{"select a$b", "select a$b", nil},
+		{"select @1", "select @1", nil},
+		{"select @é", "select @é", nil},
+
+		// Placeholders after quoted text.
+		{"select '@a', @b", "select '@a', $1", []string{"b"}},
+		{"select 'x'@b", "select 'x'$1", []string{"b"}},
+		{`select 'x\', @b`, `select 'x\', $1`, []string{"b"}},
+		{"select $$ @a $$, @b", "select $$ @a $$, $1", []string{"b"}},
+		{"select 1 -- @a\n, @b", "select 1 -- @a\n, $1", []string{"b"}},
+		{"select /* @a */ @b", "select /* @a */ $1", []string{"b"}},
+
+		// Unterminated.
+		{"select 'x @a", "select 'x @a", nil},
+		{"select $x$ @a", "select $x$ @a", nil},
+		{"select /* @a", "select /* @a", nil},
+
+		// Already uses $n.
+		{"select $1, @a", "select $1, @a", nil},
+		{"select @a, $1", "select @a, $1", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			have, haveNames := Named(tt.input)
+			if have != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+			if !reflect.DeepEqual(haveNames, tt.wantNames) {
+				t.Errorf("\nhave names: %q\nwant names: %q", haveNames, tt.wantNames)
+			}
+		})
+	}
+}
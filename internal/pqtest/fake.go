@@ -106,6 +106,9 @@ func (f Fake) Startup(cn net.Conn, params map[string]string) {
 // ReadStartup reads the startup message.
 func (f Fake) ReadStartup(cn net.Conn) (float32, map[string]string, bool) {
 	_, msg, ok := f.read(cn, true)
+	if !ok {
+		return 0, nil, false
+	}
 
 	if len(msg) == 4 && binary.BigEndian.Uint32(msg) == proto.NegotiateSSLCode {
 		f.WriteMsg(cn, proto.ErrorResponse, "SFATAL\x00VFATAL\x00C28000\x00"+
@@ -123,6 +126,17 @@ func (f Fake) ReadStartup(cn net.Conn) (float32, map[string]string, bool) {
 	return float32(msg[1]) + float32(msg[3])/10, params, ok
 }
 
+// ReadStartupPacket reads a startup packet (StartupMessage, CancelRequest,
+// SSLRequest, or GSSENCRequest), and returns the protocol version or request
+// code and the data after it.
+func (f Fake) ReadStartupPacket(cn net.Conn) (uint32, []byte, bool) {
+	_, msg, ok := f.read(cn, true)
+	if !ok || len(msg) < 4 {
+		return 0, nil, false
+	}
+	return binary.BigEndian.Uint32(msg), msg[4:], true
+}
+
 // WriteStartup writes startup parameters.
 func (f Fake) WriteStartup(cn net.Conn, params map[string]string) {
 	for k, v := range params {
@@ -142,7 +156,7 @@ func (f Fake) read(cn net.Conn, startup bool) (proto.RequestCode, []byte, bool)
 		sz = 4
 	}
 	typ := make([]byte, sz)
-	_, err := cn.Read(typ)
+	_, err := io.ReadFull(cn, typ)
 	if err != nil {
 		// No need to error if connection got closed, which is most likely
 		// intentional.
@@ -163,7 +177,7 @@ func (f Fake) read(cn net.Conn, startup bool) (proto.RequestCode, []byte, bool)
 	}
 
 	data := make([]byte, int(binary.BigEndian.Uint32(length))-4)
-	_, err = cn.Read(data)
+	_, err = io.ReadFull(cn, data)
 	if err != nil {
 		f.t.Errorf("reading: %s", err)
 		return 0, nil, false
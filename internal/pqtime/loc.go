@@ -35,3 +35,9 @@ func (c *locationCache) getLocation(offset int) *time.Location {
 	}
 	return l
 }
+
+// Location returns the cached fixed time zone for the offset in seconds east of
+// UTC; this is the same location that Parse uses.
+func Location(offset int) *time.Location {
+	return globalLocationCache.getLocation(offset)
+}
@@ -40,6 +40,8 @@ type Client struct {
 	serverNonce []byte
 	saltedPass  []byte
 	authMsg     bytes.Buffer
+	gs2Header   string
+	cbData      []byte
 }
 
 // NewClient returns a new SCRAM-* client with the provided hash algorithm.
@@ -48,12 +50,26 @@ type Client struct {
 //
 //	client := scram.NewClient(sha256.New, user, pass)
 func NewClient(newHash func() hash.Hash, user, pass string) *Client {
-	c := &Client{newHash: newHash, user: user, pass: pass}
+	c := &Client{newHash: newHash, user: user, pass: pass, gs2Header: "n,,"}
 	c.out.Grow(256)
 	c.authMsg.Grow(256)
 	return c
 }
 
+// ChannelBinding sets the channel binding type (e.g. "tls-server-end-point")
+// and data to bind to the authentication, per RFC5802 section 6. If typ is ""
+// it indicates that the client supports channel binding but the server doesn't
+// (the "y" flag).
+//
+// This must be called before the first Step.
+func (c *Client) ChannelBinding(typ string, data []byte) {
+	if typ == "" {
+		c.gs2Header, c.cbData = "y,,", nil
+		return
+	}
+	c.gs2Header, c.cbData = "p="+typ+",,", data
+}
+
 // Set client nonce for tests.
 func (c *Client) setNonce(nonce []byte) { c.clientNonce = nonce }
 
@@ -104,7 +120,7 @@ func (c *Client) stepClientFirst(in []byte) error {
 	c.authMsg.WriteString(",r=")
 	c.authMsg.Write(c.clientNonce)
 
-	c.out.WriteString("n,,")
+	c.out.WriteString(c.gs2Header)
 	c.out.Write(c.authMsg.Bytes())
 	return nil
 }
@@ -146,9 +162,10 @@ func (c *Client) stepServerFirst(in []byte) error {
 	c.saltPassword(salt, iterCount)
 
 	// Write client-final message.
-	c.authMsg.WriteString(",c=biws,r=")
+	cb := base64.StdEncoding.EncodeToString(append([]byte(c.gs2Header), c.cbData...))
+	c.authMsg.WriteString(",c=" + cb + ",r=")
 	c.authMsg.Write(c.serverNonce)
-	c.out.WriteString("c=biws,r=")
+	c.out.WriteString("c=" + cb + ",r=")
 	c.out.Write(c.serverNonce)
 	c.out.WriteString(",p=")
 	c.out.Write(c.clientProof())
@@ -2,6 +2,7 @@ package scram
 
 import (
 	"crypto/sha1"
+	"crypto/sha256"
 	"strings"
 	"testing"
 )
@@ -65,3 +66,34 @@ func TestExamples(t *testing.T) {
 		})
 	}
 }
+
+func TestChannelBinding(t *testing.T) {
+	tests := []struct {
+		typ             string
+		data            []byte
+		wantFirst, want string
+	}{
+		{"", nil, "y,,n=user,r=nonce", "c=eSws,r=nonceserver,p="},
+		{"tls-server-end-point", []byte{1, 2, 3}, "p=tls-server-end-point,,n=user,r=nonce",
+			"c=cD10bHMtc2VydmVyLWVuZC1wb2ludCwsAQID,r=nonceserver,p="},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			client := NewClient(sha256.New, "user", "pencil")
+			client.setNonce([]byte("nonce"))
+			client.ChannelBinding(tt.typ, tt.data)
+
+			client.Step(nil)
+			if have := string(client.Out()); have != tt.wantFirst {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.wantFirst)
+			}
+			client.Step([]byte("r=nonceserver,s=QSXCR+Q6sek8bf92,i=4096"))
+			if client.Err() != nil {
+				t.Fatal(client.Err())
+			}
+			if have := string(client.Out()); !strings.HasPrefix(have, tt.want) {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
+}
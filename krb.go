@@ -25,3 +25,19 @@ type GSS interface {
 	GetInitTokenFromSpn(spn string) ([]byte, error)
 	Continue(inToken []byte) (done bool, outToken []byte, err error)
 }
+
+// GSSEncrypter is implemented by GSS providers that support GSSAPI transport
+// encryption (gssencmode).
+//
+// The security context is established with the methods from [GSS], after which
+// all data is sent with Wrap and received with Unwrap.
+type GSSEncrypter interface {
+	GSS
+
+	// Wrap encrypts data with the established security context (gss_wrap()
+	// with confidentiality).
+	Wrap(data []byte) ([]byte, error)
+
+	// Unwrap decrypts data from the server (gss_unwrap()).
+	Unwrap(data []byte) ([]byte, error)
+}
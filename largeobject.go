@@ -0,0 +1,326 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lib/pq/internal/proto"
+	"github.com/lib/pq/oid"
+)
+
+// OIDs of the large object functions; these are fixed in pg_proc.dat.
+const (
+	fnLoCreate     oid.Oid = 715
+	fnLoOpen       oid.Oid = 952
+	fnLoClose      oid.Oid = 953
+	fnLoRead       oid.Oid = 954
+	fnLoWrite      oid.Oid = 955
+	fnLoUnlink     oid.Oid = 964
+	fnLoLseek64    oid.Oid = 3170
+	fnLoTell64     oid.Oid = 3171
+	fnLoTruncate64 oid.Oid = 3172
+)
+
+// Maximum number of bytes to read or write with a single function call.
+const largeObjectChunk = 1 << 20
+
+// LargeObjectMode is the mode to open a large object with.
+type LargeObjectMode int32
+
+// Modes for [LargeObjects.Open]; these can be combined to open a large object
+// for both reading and writing.
+const (
+	LargeObjectModeWrite LargeObjectMode = 0x20000 // INV_WRITE
+	LargeObjectModeRead  LargeObjectMode = 0x40000 // INV_READ
+)
+
+var (
+	errLargeObjectClosed = errors.New("pq: large object is closed")
+	errLargeObjectNoTx   = errors.New("pq: large objects can only be used in a transaction")
+)
+
+// LargeObjects creates, opens, and removes large objects.
+//
+// Large objects can only be used in a transaction. Descriptors of opened large
+// objects are closed when the transaction ends.
+//
+// The functions are called with the FunctionCall protocol message, rather than
+// with a query; these calls aren't traced.
+type LargeObjects struct {
+	cn *conn
+}
+
+// NewLargeObjects creates a new LargeObjects for the connection c, which must
+// be in a transaction. c must be a pq connection, which can be retrieved with
+// [sql.Conn.Raw]. The LargeObjects and opened large objects can only be used in
+// the Raw callback:
+//
+//	c, err := db.Conn(ctx)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer c.Close()
+//
+//	tx, err := c.BeginTx(ctx, nil)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer tx.Rollback()
+//
+//	err = c.Raw(func(driverConn any) error {
+//		lo, err := pq.NewLargeObjects(driverConn.(driver.Conn))
+//		if err != nil {
+//			return err
+//		}
+//		id, err := lo.Create(ctx, 0)
+//		[..]
+//	})
+func NewLargeObjects(c driver.Conn) (*LargeObjects, error) {
+	cn, err := asConn(c)
+	if err != nil {
+		return nil, err
+	}
+	if !cn.isInTransaction() {
+		return nil, errLargeObjectNoTx
+	}
+	return &LargeObjects{cn: cn}, nil
+}
+
+// Create creates a new large object with the OID id, or with a server-assigned
+// OID if id is 0. It returns the OID of the new large object.
+func (l *LargeObjects) Create(ctx context.Context, id oid.Oid) (oid.Oid, error) {
+	r, err := l.call(ctx, fnLoCreate, int32Arg(int32(id)))
+	if err != nil {
+		return 0, err
+	}
+	v, err := int32Result(r)
+	return oid.Oid(v), err
+}
+
+// Open opens the large object id with the mode.
+//
+// The returned LargeObject uses ctx for all operations.
+func (l *LargeObjects) Open(ctx context.Context, id oid.Oid, mode LargeObjectMode) (*LargeObject, error) {
+	r, err := l.call(ctx, fnLoOpen, int32Arg(int32(id)), int32Arg(int32(mode)))
+	if err != nil {
+		return nil, err
+	}
+	fd, err := int32Result(r)
+	if err != nil {
+		return nil, err
+	}
+	return &LargeObject{ctx: ctx, lo: l, fd: fd}, nil
+}
+
+// Unlink removes the large object id.
+func (l *LargeObjects) Unlink(ctx context.Context, id oid.Oid) error {
+	r, err := l.call(ctx, fnLoUnlink, int32Arg(int32(id)))
+	if err != nil {
+		return err
+	}
+	_, err = int32Result(r)
+	return err
+}
+
+// call calls the function fn with the binary-encoded arguments, and returns the
+// binary-encoded result.
+func (l *LargeObjects) call(ctx context.Context, fn oid.Oid, args ...[]byte) ([]byte, error) {
+	cn := l.cn
+	defer cn.watchCancel(ctx, false)()
+	if err := cn.err.get(); err != nil {
+		return nil, err
+	}
+	if err := cn.setStatementTimeout(ctx); err != nil {
+		return nil, cn.handleError(err)
+	}
+
+	r, err := cn.functionCall(fn, args)
+	if err != nil {
+		return nil, cn.handleError(err)
+	}
+	if r == nil {
+		return nil, fmt.Errorf("pq: function %d returned NULL", fn)
+	}
+	return r, nil
+}
+
+// LargeObject is an opened large object, which implements [io.Reader],
+// [io.Writer], [io.Seeker], and [io.Closer].
+//
+// A LargeObject is only valid for the duration of the transaction it was
+// opened in.
+type LargeObject struct {
+	ctx    context.Context
+	lo     *LargeObjects
+	fd     int32
+	closed bool
+}
+
+// Read reads up to len(p) bytes from the current position.
+func (o *LargeObject) Read(p []byte) (int, error) {
+	if o.closed {
+		return 0, errLargeObjectClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	r, err := o.lo.call(o.ctx, fnLoRead, int32Arg(o.fd), int32Arg(int32(min(len(p), largeObjectChunk))))
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, r)
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// Write writes p at the current position.
+func (o *LargeObject) Write(p []byte) (int, error) {
+	if o.closed {
+		return 0, errLargeObjectClosed
+	}
+	var n int
+	for len(p) > 0 {
+		c := p[:min(len(p), largeObjectChunk)]
+		r, err := o.lo.call(o.ctx, fnLoWrite, int32Arg(o.fd), c)
+		if err != nil {
+			return n, err
+		}
+		w, err := int32Result(r)
+		if err != nil {
+			return n, err
+		}
+		n += int(w)
+		if int(w) != len(c) {
+			return n, io.ErrShortWrite
+		}
+		p = p[len(c):]
+	}
+	return n, nil
+}
+
+// Seek sets the position for the next Read or Write. The values for whence are
+// identical to those of PostgreSQL, so [io.SeekStart], [io.SeekCurrent], and
+// [io.SeekEnd] can be used.
+func (o *LargeObject) Seek(offset int64, whence int) (int64, error) {
+	if o.closed {
+		return 0, errLargeObjectClosed
+	}
+	r, err := o.lo.call(o.ctx, fnLoLseek64, int32Arg(o.fd), int64Arg(offset), int32Arg(int32(whence)))
+	if err != nil {
+		return 0, err
+	}
+	return int64Result(r)
+}
+
+// Tell returns the current position.
+func (o *LargeObject) Tell() (int64, error) {
+	if o.closed {
+		return 0, errLargeObjectClosed
+	}
+	r, err := o.lo.call(o.ctx, fnLoTell64, int32Arg(o.fd))
+	if err != nil {
+		return 0, err
+	}
+	return int64Result(r)
+}
+
+// Truncate truncates the large object to size bytes, or extends it with zero
+// bytes if it's smaller. The position isn't changed.
+func (o *LargeObject) Truncate(size int64) error {
+	if o.closed {
+		return errLargeObjectClosed
+	}
+	r, err := o.lo.call(o.ctx, fnLoTruncate64, int32Arg(o.fd), int64Arg(size))
+	if err != nil {
+		return err
+	}
+	_, err = int32Result(r)
+	return err
+}
+
+// Close closes the large object descriptor.
+func (o *LargeObject) Close() error {
+	if o.closed {
+		return errLargeObjectClosed
+	}
+	o.closed = true
+	r, err := o.lo.call(o.ctx, fnLoClose, int32Arg(o.fd))
+	if err != nil {
+		return err
+	}
+	_, err = int32Result(r)
+	return err
+}
+
+func int32Arg(n int32) []byte { return binary.BigEndian.AppendUint32(nil, uint32(n)) }
+func int64Arg(n int64) []byte { return binary.BigEndian.AppendUint64(nil, uint64(n)) }
+
+func int32Result(r []byte) (int32, error) {
+	if len(r) != 4 {
+		return 0, fmt.Errorf("pq: unexpected length for function result: %d", len(r))
+	}
+	return int32(binary.BigEndian.Uint32(r)), nil
+}
+
+func int64Result(r []byte) (int64, error) {
+	if len(r) != 8 {
+		return 0, fmt.Errorf("pq: unexpected length for function result: %d", len(r))
+	}
+	return int64(binary.BigEndian.Uint64(r)), nil
+}
+
+// functionCall calls the function fn with the FunctionCall message. The
+// arguments and result are in the binary format; the result is nil for NULL.
+func (cn *conn) functionCall(fn oid.Oid, args [][]byte) ([]byte, error) {
+	if debugProto {
+		fmt.Fprintln(os.Stderr, "         START conn.functionCall")
+		defer fmt.Fprintln(os.Stderr, "         END conn.functionCall")
+	}
+
+	b := cn.writeBuf(proto.FunctionCall)
+	b.int32(int(fn))
+	b.int16(1)
+	b.int16(int(formatBinary))
+	b.int16(len(args))
+	for _, a := range args {
+		b.int32(len(a))
+		b.bytes(a)
+	}
+	b.int16(int(formatBinary))
+	err := cn.send(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		res    []byte
+		resErr error
+	)
+	for {
+		t, r, err := cn.recv1()
+		if err != nil {
+			return nil, err
+		}
+		switch t {
+		case proto.FunctionCallResponse:
+			if n := r.int32(); n >= 0 {
+				res = append([]byte{}, r.next(n)...)
+			}
+		case proto.ErrorResponse:
+			resErr = parseError(r, "")
+		case proto.ReadyForQuery:
+			cn.processReadyForQuery(r)
+			return res, resErr
+		default:
+			cn.err.set(driver.ErrBadConn)
+			return nil, fmt.Errorf("pq: unknown response for function call: %q", t)
+		}
+	}
+}
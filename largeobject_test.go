@@ -0,0 +1,253 @@
+package pq
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/lib/pq/internal/pqtest"
+	"github.com/lib/pq/internal/proto"
+	"github.com/lib/pq/oid"
+)
+
+func testLargeObjects(t *testing.T, ctx context.Context, lo *LargeObjects) {
+	t.Helper()
+
+	id, err := lo.Create(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := lo.Open(ctx, id, LargeObjectModeRead|LargeObjectModeWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("0123456789"), largeObjectChunk/5)
+	if n, err := o.Write(data); err != nil || n != len(data) {
+		t.Fatalf("n=%d; err=%v", n, err)
+	}
+	if pos, err := o.Tell(); err != nil || pos != int64(len(data)) {
+		t.Fatalf("pos=%d; err=%v", pos, err)
+	}
+
+	if pos, err := o.Seek(-5, io.SeekEnd); err != nil || pos != int64(len(data))-5 {
+		t.Fatalf("pos=%d; err=%v", pos, err)
+	}
+	have, err := io.ReadAll(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(have) != "56789" {
+		t.Errorf("%q", have)
+	}
+
+	if _, err := o.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	have, err = io.ReadAll(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, data) {
+		t.Errorf("wrong data: len=%d", len(have))
+	}
+
+	if err := o.Truncate(3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Seek(1, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if pos, err := o.Seek(1, io.SeekCurrent); err != nil || pos != 2 {
+		t.Fatalf("pos=%d; err=%v", pos, err)
+	}
+	have, err = io.ReadAll(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(have) != "2" {
+		t.Errorf("%q", have)
+	}
+
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Read(make([]byte, 1)); err != errLargeObjectClosed {
+		t.Errorf("wrong error: %v", err)
+	}
+
+	if err := lo.Unlink(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	_, err = lo.Open(ctx, id, LargeObjectModeRead)
+	if !pqtest.ErrorContains(err, "does not exist") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+// withLargeObjects calls f with a LargeObjects in a transaction on a connection
+// from db.
+func withLargeObjects(t *testing.T, db *sql.DB, f func(*LargeObjects)) {
+	t.Helper()
+
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = c.Raw(func(driverConn any) error {
+		_, err := NewLargeObjects(driverConn.(driver.Conn))
+		if err != errLargeObjectNoTx {
+			t.Errorf("wrong error outside transaction: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := c.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	err = c.Raw(func(driverConn any) error {
+		lo, err := NewLargeObjects(driverConn.(driver.Conn))
+		if err != nil {
+			return err
+		}
+		f(lo)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLargeObjects(t *testing.T) {
+	pqtest.SkipCockroach(t) // Large objects aren't supported.
+	t.Parallel()
+
+	db := pqtest.MustDB(t)
+	withLargeObjects(t, db, func(lo *LargeObjects) {
+		testLargeObjects(t, context.Background(), lo)
+	})
+}
+
+func TestLargeObjectsFake(t *testing.T) {
+	t.Parallel()
+
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		f.Startup(cn, nil)
+		var (
+			objs = make(map[uint32][]byte)
+			pos  int64
+			id   uint32
+			fail bool
+		)
+		for {
+			code, msg, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			switch code {
+			case proto.Query:
+				if string(msg) == ";\x00" { // Ping()
+					f.WriteMsg(cn, proto.EmptyQueryResponse, "")
+					f.WriteMsg(cn, proto.ReadyForQuery, "I")
+					continue
+				}
+				if string(msg) == "ROLLBACK\x00" {
+					f.WriteMsg(cn, proto.CommandComplete, "ROLLBACK\x00")
+					f.WriteMsg(cn, proto.ReadyForQuery, "I")
+					continue
+				}
+				f.WriteMsg(cn, proto.CommandComplete, "BEGIN\x00")
+				f.WriteMsg(cn, proto.ReadyForQuery, "T")
+			case proto.FunctionCall:
+				fn := oid.Oid(binary.BigEndian.Uint32(msg))
+				if binary.BigEndian.Uint16(msg[4:]) != 1 || binary.BigEndian.Uint16(msg[6:]) != 1 {
+					t.Errorf("wrong argument format: %q", msg)
+				}
+				var args [][]byte
+				r := msg[10:]
+				for range binary.BigEndian.Uint16(msg[8:]) {
+					n := binary.BigEndian.Uint32(r)
+					args, r = append(args, r[4:4+n]), r[4+n:]
+				}
+				if !bytes.Equal(r, []byte{0, 1}) {
+					t.Errorf("wrong result format: %q", r)
+				}
+				u32 := func(i int) uint32 { return binary.BigEndian.Uint32(args[i]) }
+
+				var res []byte
+				switch fn {
+				case fnLoCreate:
+					id++
+					objs[id] = nil
+					res = binary.BigEndian.AppendUint32(nil, id)
+				case fnLoOpen:
+					_, ok := objs[u32(0)]
+					fail = !ok
+					pos = 0
+					res = binary.BigEndian.AppendUint32(nil, 0)
+				case fnLoUnlink:
+					delete(objs, u32(0))
+					res = binary.BigEndian.AppendUint32(nil, 1)
+				case fnLoClose:
+					res = binary.BigEndian.AppendUint32(nil, 0)
+				case fnLoWrite:
+					d := objs[id][:pos]
+					d = append(d, args[1]...)
+					objs[id] = d
+					pos += int64(len(args[1]))
+					res = binary.BigEndian.AppendUint32(nil, uint32(len(args[1])))
+				case fnLoRead:
+					d := objs[id][min(pos, int64(len(objs[id]))):]
+					res = d[:min(len(d), int(u32(1)))]
+					pos += int64(len(res))
+					res = append([]byte{}, res...)
+				case fnLoLseek64:
+					off := int64(binary.BigEndian.Uint64(args[1]))
+					switch u32(2) {
+					case 0:
+						pos = off
+					case 1:
+						pos += off
+					case 2:
+						pos = int64(len(objs[id])) + off
+					}
+					res = binary.BigEndian.AppendUint64(nil, uint64(pos))
+				case fnLoTell64:
+					res = binary.BigEndian.AppendUint64(nil, uint64(pos))
+				case fnLoTruncate64:
+					objs[id] = objs[id][:binary.BigEndian.Uint64(args[1])]
+					res = binary.BigEndian.AppendUint32(nil, 0)
+				}
+				if fail {
+					f.WriteMsg(cn, proto.ErrorResponse, "SERROR\x00C42704\x00Mlarge object does not exist\x00\x00")
+					f.WriteMsg(cn, proto.ReadyForQuery, "E")
+					continue
+				}
+				f.WriteMsg(cn, proto.FunctionCallResponse,
+					string(binary.BigEndian.AppendUint32(nil, uint32(len(res))))+string(res))
+				f.WriteMsg(cn, proto.ReadyForQuery, "T")
+			case proto.Terminate:
+				cn.Close()
+				return
+			}
+		}
+	})
+	defer f.Close()
+
+	db := pqtest.MustDB(t, f.DSN())
+	withLargeObjects(t, db, func(lo *LargeObjects) {
+		testLargeObjects(t, context.Background(), lo)
+	})
+}
@@ -0,0 +1,98 @@
+package pq
+
+import (
+	"cmp"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LSN is a PostgreSQL Log Sequence Number: a position in the write-ahead log.
+//
+// It can be scanned from and used as a parameter for the pg_lsn type, for
+// example:
+//
+//	var lsn pq.LSN
+//	err := db.QueryRow(`select pg_current_wal_lsn()`).Scan(&lsn)
+type LSN uint64
+
+// String formats the LSN in the same format as PostgreSQL, e.g. "16/B374D848".
+func (l LSN) String() string {
+	return fmt.Sprintf("%X/%X", uint32(l>>32), uint32(l))
+}
+
+// ParseLSN parses an LSN in the format used by PostgreSQL, e.g. "16/B374D848".
+func ParseLSN(s string) (LSN, error) {
+	hi, lo, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, fmt.Errorf("pq: invalid LSN %q", s)
+	}
+	h, err := strconv.ParseUint(hi, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("pq: invalid LSN %q", s)
+	}
+	l, err := strconv.ParseUint(lo, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("pq: invalid LSN %q", s)
+	}
+	return LSN(h<<32 | l), nil
+}
+
+// Compare returns -1 if l is before o, 0 if they're equal, and +1 if l is after
+// o.
+func (l LSN) Compare(o LSN) int {
+	return cmp.Compare(l, o)
+}
+
+// Sub returns the number of bytes between o and l; this is negative if l is
+// before o. This is the same as pg_wal_lsn_diff(l, o).
+func (l LSN) Sub(o LSN) int64 {
+	return int64(l - o)
+}
+
+// Add returns the LSN n bytes after l, or before l if n is negative.
+func (l LSN) Add(n int64) LSN {
+	return l + LSN(n)
+}
+
+// Scan implements the sql.Scanner interface.
+func (l *LSN) Scan(src any) error {
+	var (
+		lsn LSN
+		err error
+	)
+	switch src := src.(type) {
+	case []byte:
+		lsn, err = ParseLSN(string(src))
+	case string:
+		lsn, err = ParseLSN(src)
+	case int64:
+		if src < 0 {
+			return fmt.Errorf("pq: invalid LSN %d", src)
+		}
+		lsn = LSN(src)
+	default:
+		return fmt.Errorf("pq: cannot convert %T to LSN", src)
+	}
+	if err != nil {
+		return err
+	}
+	*l = lsn
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (l LSN) Value() (driver.Value, error) {
+	return l.String(), nil
+}
+
+// decodeLSNBinary interprets the binary format of a pg_lsn, returning it in
+// text format.
+func decodeLSNBinary(src []byte) ([]byte, error) {
+	if len(src) != 8 {
+		return nil, fmt.Errorf("pq: unable to decode pg_lsn; bad length: %d", len(src))
+	}
+	return []byte(LSN(binary.BigEndian.Uint64(src)).String()), nil
+}
@@ -0,0 +1,118 @@
+package pq
+
+import (
+	"testing"
+
+	"github.com/lib/pq/internal/pqtest"
+)
+
+func TestLSN(t *testing.T) {
+	tests := []struct {
+		in   string
+		want LSN
+	}{
+		{"0/0", 0},
+		{"16/B374D848", 0x16_B374D848},
+		{"FFFFFFFF/FFFFFFFF", 1<<64 - 1},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			have, err := ParseLSN(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have != tt.want {
+				t.Errorf("\nhave: %d\nwant: %d", have, tt.want)
+			}
+			if have.String() != tt.in {
+				t.Errorf("\nhave: %s\nwant: %s", have, tt.in)
+			}
+		})
+	}
+
+	for _, in := range []string{"", "0", "0/", "/0", "1/G", "100000000/0", "0/-1"} {
+		if _, err := ParseLSN(in); !pqtest.ErrorContains(err, "pq: invalid LSN") {
+			t.Errorf("%q: wrong error: %v", in, err)
+		}
+	}
+}
+
+func TestLSNCompare(t *testing.T) {
+	a, b := LSN(0x16_B374D848), LSN(0x17_00000000)
+	if a.Compare(b) != -1 || b.Compare(a) != 1 || a.Compare(a) != 0 {
+		t.Error("wrong Compare")
+	}
+	if d := b.Sub(a); d != 0x4C8B27B8 {
+		t.Errorf("wrong Sub: %d", d)
+	}
+	if d := a.Sub(b); d != -0x4C8B27B8 {
+		t.Errorf("wrong Sub: %d", d)
+	}
+	if l := a.Add(b.Sub(a)); l != b {
+		t.Errorf("wrong Add: %s", l)
+	}
+	if l := b.Add(-0x4C8B27B8); l != a {
+		t.Errorf("wrong Add: %s", l)
+	}
+}
+
+func TestLSNScan(t *testing.T) {
+	tests := []struct {
+		in      any
+		want    LSN
+		wantErr string
+	}{
+		{[]byte("16/B374D848"), 0x16_B374D848, ""},
+		{"0/1", 1, ""},
+		{int64(42), 42, ""},
+		{int64(-1), 0, "pq: invalid LSN -1"},
+		{"x", 0, "pq: invalid LSN"},
+		{nil, 0, "pq: cannot convert <nil> to LSN"},
+		{1.5, 0, "pq: cannot convert float64 to LSN"},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			var have LSN
+			err := have.Scan(tt.in)
+			if !pqtest.ErrorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error:\nhave: %s\nwant: %s", err, tt.wantErr)
+			}
+			if have != tt.want {
+				t.Errorf("\nhave: %s\nwant: %s", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestLSNQuery(t *testing.T) {
+	pqtest.SkipCockroach(t)
+	t.Parallel()
+	db := pqtest.MustDB(t)
+
+	var cur LSN
+	if err := db.QueryRow(`select pg_current_wal_lsn()`).Scan(&cur); err != nil {
+		t.Fatal(err)
+	}
+	if cur == 0 {
+		t.Error("LSN is 0")
+	}
+
+	// Parameter, and both the binary (prepared) and text (simple query)
+	// result formats.
+	want := LSN(0x16_B374D848)
+	for _, tt := range []struct {
+		q    string
+		args []any
+	}{
+		{`select $1::pg_lsn`, []any{want}},
+		{`select '16/B374D848'::pg_lsn`, nil},
+	} {
+		var have LSN
+		if err := db.QueryRow(tt.q, tt.args...).Scan(&have); err != nil {
+			t.Fatal(err)
+		}
+		if have != want {
+			t.Errorf("%s\nhave: %s\nwant: %s", tt.q, have, want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package pq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq/internal/proto"
+)
+
+// TokenProvider gets an OAuth bearer token for the OAUTHBEARER authentication
+// method (PostgreSQL ≥18).
+//
+// issuer is the oauth_issuer connection parameter, and scope is the
+// oauth_scope connection parameter, or the scope the server asked for if
+// oauth_scope isn't set.
+type TokenProvider func(ctx context.Context, issuer, scope string) (string, error)
+
+// OAuthError is returned if the server rejected the OAuth bearer token, with
+// the details from the server's error response.
+type OAuthError struct {
+	Status              string // Error status, e.g. "invalid_token".
+	Scope               string // Scope required by the server, if any.
+	OpenIDConfiguration string // URL of the issuer's discovery document.
+	Err                 error  // Error from the server.
+}
+
+func (e *OAuthError) Error() string {
+	return fmt.Sprintf("pq: OAuth bearer token rejected with status %q (scope %q, openid-configuration %q): %s",
+		e.Status, e.Scope, e.OpenIDConfiguration, strings.TrimPrefix(e.Err.Error(), "pq: "))
+}
+
+func (e *OAuthError) Unwrap() error { return e.Err }
+
+// oauthDiscoveryURI gets the URI of the discovery document for the oauth_issuer
+// setting, which can be either the issuer identifier or the discovery URI.
+func oauthDiscoveryURI(issuer string) string {
+	if strings.Contains(issuer, "/.well-known/") {
+		return issuer
+	}
+	return strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+}
+
+// oauthIssuer gets the issuer identifier from the oauth_issuer setting.
+func oauthIssuer(issuer string) string {
+	if i := strings.Index(issuer, "/.well-known/"); i > -1 {
+		return issuer[:i]
+	}
+	return issuer
+}
+
+// validBearerToken reports if tok is a valid b64token from RFC 6750.
+func validBearerToken(tok string) bool {
+	t := strings.TrimRight(tok, "=")
+	if t == "" {
+		return false
+	}
+	for _, c := range t {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' || c == '+' || c == '/') {
+			return false
+		}
+	}
+	return true
+}
+
+// oauth authenticates with the OAUTHBEARER SASL mechanism (RFC 7628).
+//
+// If oauth_scope isn't set the server is first asked for the scope with an
+// empty token, after which the server closes the connection; this sets
+// cn.oauthDiscovery so the connection can be retried with the scope from the
+// returned *OAuthError.
+func (cn *conn) oauth(ctx context.Context, cfg Config) error {
+	if cn.tokenProvider == nil {
+		return errors.New("pq: server requested OAuth authentication, but no TokenProvider is set on the Connector")
+	}
+	if cfg.OAuthIssuer == "" {
+		return errors.New("pq: server requested OAuth authentication, but oauth_issuer is not set")
+	}
+
+	scope, token := cfg.OAuthScope, ""
+	if cn.oauthScope != nil {
+		scope = *cn.oauthScope
+	}
+	cn.oauthDiscovery = scope == "" && cn.oauthScope == nil
+	if !cn.oauthDiscovery {
+		tok, err := cn.tokenProvider(ctx, oauthIssuer(cfg.OAuthIssuer), scope)
+		if err != nil {
+			return fmt.Errorf("pq: getting OAuth token: %w", err)
+		}
+		if !validBearerToken(tok) {
+			return errors.New("pq: OAuth token from TokenProvider is not a valid bearer token")
+		}
+		token = "Bearer " + tok
+	}
+
+	resp := "n,,\x01auth=" + token + "\x01\x01"
+	w := cn.writeBuf(proto.SASLInitialResponse)
+	w.string("OAUTHBEARER")
+	w.int32(len(resp))
+	w.bytes([]byte(resp))
+	if err := cn.send(w); err != nil {
+		return err
+	}
+
+	t, r, err := cn.recvError()
+	if err != nil {
+		return err
+	}
+	if t != proto.AuthenticationRequest {
+		return fmt.Errorf("pq: unexpected OAuth response: %q", t)
+	}
+	switch code := proto.AuthCode(r.int32()); code {
+	case proto.AuthReqOk:
+		if cn.oauthDiscovery {
+			return errors.New("pq: server accepted an empty OAuth token")
+		}
+		return nil
+	case proto.AuthReqSASLCont:
+	default:
+		return fmt.Errorf("pq: unexpected authentication response: %s", code)
+	}
+
+	// The server rejected the token and sent the error details, which must be
+	// acknowledged with a single separator after which the server sends the
+	// error.
+	var oerr OAuthError
+	err = json.Unmarshal(*r, &struct {
+		Status *string `json:"status"`
+		Scope  *string `json:"scope"`
+		OpenID *string `json:"openid-configuration"`
+	}{&oerr.Status, &oerr.Scope, &oerr.OpenIDConfiguration})
+	if err != nil {
+		return fmt.Errorf("pq: invalid OAuth error response from server: %w", err)
+	}
+	if oerr.OpenIDConfiguration != oauthDiscoveryURI(cfg.OAuthIssuer) {
+		return fmt.Errorf("pq: server's OAuth discovery URI %q doesn't match oauth_issuer %q",
+			oerr.OpenIDConfiguration, cfg.OAuthIssuer)
+	}
+	w = cn.writeBuf(proto.SASLResponse)
+	w.bytes([]byte{0x01})
+	if err := cn.send(w); err != nil {
+		return err
+	}
+	_, _, oerr.Err = cn.recvError()
+	if oerr.Err == nil {
+		return errors.New("pq: server didn't send an error after rejecting the OAuth token")
+	}
+	return &oerr
+}
@@ -0,0 +1,156 @@
+package pq
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/lib/pq/internal/pqtest"
+	"github.com/lib/pq/internal/proto"
+)
+
+func TestOAuth(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu     sync.Mutex
+		tokens []string
+	)
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		defer cn.Close()
+		if _, _, ok := f.ReadStartup(cn); !ok {
+			return
+		}
+		f.WriteMsg(cn, proto.AuthenticationRequest, "\x00\x00\x00\x0aOAUTHBEARER\x00\x00")
+		code, msg, ok := f.ReadMsg(cn)
+		if !ok {
+			return
+		}
+		if code != proto.SASLInitialResponse || !bytes.HasPrefix(msg, []byte("OAUTHBEARER\x00")) {
+			t.Errorf("wrong message: %q %q", code, msg)
+			return
+		}
+		resp := string(msg[len("OAUTHBEARER\x00")+4:])
+		mu.Lock()
+		tokens = append(tokens, resp)
+		mu.Unlock()
+
+		if resp != "n,,\x01auth=Bearer good.token\x01\x01" {
+			f.WriteMsg(cn, proto.AuthenticationRequest, "\x00\x00\x00\x0b"+
+				`{"status":"invalid_token","scope":"openid db","openid-configuration":"https://idp.example.com/.well-known/openid-configuration"}`)
+			code, msg, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			if code != proto.SASLResponse || string(msg) != "\x01" {
+				t.Errorf("wrong message: %q %q", code, msg)
+			}
+			f.WriteMsg(cn, proto.ErrorResponse, "SFATAL\x00C28000\x00MOAuth bearer authentication failed for user \"u\"\x00\x00")
+			return
+		}
+
+		f.WriteMsg(cn, proto.AuthenticationRequest, "\x00\x00\x00\x00")
+		f.WriteMsg(cn, proto.ReadyForQuery, "I")
+		for {
+			code, _, ok := f.ReadMsg(cn)
+			if !ok || code == proto.Terminate {
+				return
+			}
+			f.WriteMsg(cn, proto.EmptyQueryResponse, "")
+			f.WriteMsg(cn, proto.ReadyForQuery, "I")
+		}
+	})
+	defer f.Close()
+
+	type call struct{ issuer, scope string }
+	connect := func(t *testing.T, dsn string, tok string) ([]call, []string, error) {
+		t.Helper()
+		mu.Lock()
+		tokens = nil
+		mu.Unlock()
+
+		c, err := NewConnector(f.DSN() + " " + dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var calls []call
+		if tok != "" {
+			c.TokenProvider(func(ctx context.Context, issuer, scope string) (string, error) {
+				calls = append(calls, call{issuer, scope})
+				return tok, nil
+			})
+		}
+		db := sql.OpenDB(c)
+		defer db.Close()
+		err = db.Ping()
+
+		mu.Lock()
+		defer mu.Unlock()
+		return calls, tokens, err
+	}
+
+	const issuer = "oauth_issuer=https://idp.example.com"
+	t.Run("discovery", func(t *testing.T) {
+		calls, tokens, err := connect(t, issuer, "good.token")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []call{{"https://idp.example.com", "openid db"}}; !reflect.DeepEqual(calls, want) {
+			t.Errorf("\nhave: %v\nwant: %v", calls, want)
+		}
+		if want := []string{"n,,\x01auth=\x01\x01", "n,,\x01auth=Bearer good.token\x01\x01"}; !reflect.DeepEqual(tokens, want) {
+			t.Errorf("\nhave: %q\nwant: %q", tokens, want)
+		}
+	})
+	t.Run("scope", func(t *testing.T) {
+		calls, tokens, err := connect(t,
+			"oauth_issuer=https://idp.example.com/.well-known/openid-configuration oauth_scope=x", "good.token")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []call{{"https://idp.example.com", "x"}}; !reflect.DeepEqual(calls, want) {
+			t.Errorf("\nhave: %v\nwant: %v", calls, want)
+		}
+		if len(tokens) != 1 {
+			t.Errorf("%q", tokens)
+		}
+	})
+	t.Run("rejected", func(t *testing.T) {
+		_, _, err := connect(t, issuer+" oauth_scope=x", "bad")
+		var (
+			oerr *OAuthError
+			pqe  *Error
+		)
+		if !errors.As(err, &oerr) || !errors.As(err, &pqe) {
+			t.Fatalf("wrong error: %#v", err)
+		}
+		if oerr.Status != "invalid_token" || oerr.Scope != "openid db" || pqe.Code != "28000" {
+			t.Errorf("wrong error: %#v", oerr)
+		}
+	})
+
+	tests := []struct {
+		dsn, tok, wantErr string
+	}{
+		{issuer, "", "no TokenProvider is set"},
+		{"", "good.token", "oauth_issuer is not set"},
+		{issuer, "not a token", "not a valid bearer token"},
+		{"oauth_issuer=https://evil.example.com", "good.token", `"https://idp.example.com/.well-known/openid-configuration" doesn't match oauth_issuer`},
+		{issuer + " require_auth=scram-sha-256", "good.token", `failed: server requested "oauth"`},
+		{issuer + " require_auth=!oauth", "good.token", `failed: server requested "oauth"`},
+		{issuer + " require_auth=oauth", "good.token", ``},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			_, _, err := connect(t, tt.dsn, tt.tok)
+			if !pqtest.ErrorContains(err, tt.wantErr) {
+				t.Errorf("wrong error:\nhave: %s\nwant: %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,530 @@
+package pq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq/oid"
+)
+
+// PgoutputDecoder decodes the messages sent by the built-in pgoutput logical
+// decoding plugin, as received in [XLogData.Data]. Protocol versions 1 to 4
+// are supported, including the messages for the streaming and two_phase
+// options.
+//
+// The decoder keeps track of the relations it has seen, so the same decoder
+// must be used for all messages of a replication stream. The zero value is
+// ready to use.
+type PgoutputDecoder struct {
+	// Time zone for timestamptz values; this should be the time zone of the
+	// replication connection from [ReplicationConn.Location]. If nil, a fixed
+	// zone with the UTC offset sent by the server is used.
+	Location *time.Location
+
+	relations map[uint32]*PgoutputRelation
+	types     map[oid.Oid]*PgoutputType
+	streaming bool // Between Stream Start and Stream Stop.
+}
+
+// PgoutputMessage is a message returned by [PgoutputDecoder.Decode]. This is
+// one of:
+//
+//	*PgoutputBegin          *PgoutputCommit
+//	*PgoutputOrigin         *PgoutputLogicalMessage
+//	*PgoutputRelation       *PgoutputType
+//	*PgoutputInsert         *PgoutputUpdate
+//	*PgoutputDelete         *PgoutputTruncate
+//	*PgoutputStreamStart    *PgoutputStreamStop
+//	*PgoutputStreamCommit   *PgoutputStreamAbort
+//	*PgoutputBeginPrepare   *PgoutputPrepare
+//	*PgoutputCommitPrepared *PgoutputRollbackPrepared
+//	*PgoutputStreamPrepare
+type PgoutputMessage interface {
+	pgoutputMessage()
+}
+
+type (
+	// PgoutputBegin is the start of a transaction.
+	PgoutputBegin struct {
+		FinalLSN   LSN       // Final LSN of the transaction.
+		CommitTime time.Time // Commit timestamp of the transaction.
+		Xid        uint32    // Transaction ID.
+	}
+
+	// PgoutputCommit is the end of a transaction.
+	PgoutputCommit struct {
+		Flags      uint8     // Currently unused.
+		CommitLSN  LSN       // LSN of the commit.
+		EndLSN     LSN       // End LSN of the transaction.
+		CommitTime time.Time // Commit timestamp of the transaction.
+	}
+
+	// PgoutputOrigin is the replication origin of the transaction, sent after
+	// Begin for transactions that were replicated from another server.
+	PgoutputOrigin struct {
+		CommitLSN LSN    // LSN of the commit on the origin server.
+		Name      string // Name of the origin.
+	}
+
+	// PgoutputLogicalMessage is a message written with
+	// pg_logical_emit_message().
+	PgoutputLogicalMessage struct {
+		Xid           uint32 // Transaction ID, for streamed transactions only.
+		Transactional bool
+		LSN           LSN
+		Prefix        string
+		Content       []byte
+	}
+
+	// PgoutputRelation describes a table. This is sent before the first
+	// change to a table, and again when the table definition changes.
+	PgoutputRelation struct {
+		Xid             uint32 // Transaction ID, for streamed transactions only.
+		ID              uint32 // OID of the relation.
+		Namespace       string // Schema; "pg_catalog" is sent as an empty string.
+		Name            string
+		ReplicaIdentity byte // 'd' (default), 'n' (nothing), 'f' (full), or 'i' (index).
+		Columns         []PgoutputColumn
+	}
+
+	// PgoutputColumn is a column of a [PgoutputRelation].
+	PgoutputColumn struct {
+		Key          bool // Part of the replica identity key.
+		Name         string
+		Type         oid.Oid
+		TypeModifier int32
+	}
+
+	// PgoutputType describes a data type that's not built in. This is sent
+	// before the first [PgoutputRelation] that uses it.
+	PgoutputType struct {
+		Xid       uint32 // Transaction ID, for streamed transactions only.
+		ID        oid.Oid
+		Namespace string // Schema; "pg_catalog" is sent as an empty string.
+		Name      string
+	}
+
+	// PgoutputInsert is an inserted row.
+	PgoutputInsert struct {
+		Xid      uint32 // Transaction ID, for streamed transactions only.
+		Relation *PgoutputRelation
+		New      PgoutputTuple
+	}
+
+	// PgoutputUpdate is an updated row.
+	//
+	// The old row is only sent if the replica identity changed (OldKind 'K')
+	// or the table has REPLICA IDENTITY FULL (OldKind 'O'); OldKind is 0
+	// otherwise.
+	PgoutputUpdate struct {
+		Xid      uint32 // Transaction ID, for streamed transactions only.
+		Relation *PgoutputRelation
+		OldKind  byte
+		Old      PgoutputTuple
+		New      PgoutputTuple
+	}
+
+	// PgoutputDelete is a deleted row. Old has the columns of the replica
+	// identity if OldKind is 'K', or all columns with REPLICA IDENTITY FULL if
+	// OldKind is 'O'.
+	PgoutputDelete struct {
+		Xid      uint32 // Transaction ID, for streamed transactions only.
+		Relation *PgoutputRelation
+		OldKind  byte
+		Old      PgoutputTuple
+	}
+
+	// PgoutputTruncate is a TRUNCATE of one or more tables.
+	PgoutputTruncate struct {
+		Xid             uint32 // Transaction ID, for streamed transactions only.
+		Cascade         bool
+		RestartIdentity bool
+		Relations       []*PgoutputRelation
+	}
+
+	// PgoutputStreamStart is the start of a block of changes from an
+	// in-progress transaction (protocol version 2 and newer).
+	PgoutputStreamStart struct {
+		Xid          uint32
+		FirstSegment bool // First block for this transaction.
+	}
+
+	// PgoutputStreamStop is the end of a block of changes from an in-progress
+	// transaction (protocol version 2 and newer).
+	PgoutputStreamStop struct{}
+
+	// PgoutputStreamCommit is the commit of a streamed transaction (protocol
+	// version 2 and newer).
+	PgoutputStreamCommit struct {
+		Xid        uint32
+		Flags      uint8 // Currently unused.
+		CommitLSN  LSN
+		EndLSN     LSN
+		CommitTime time.Time
+	}
+
+	// PgoutputStreamAbort is the abort of a streamed (sub)transaction
+	// (protocol version 2 and newer). AbortLSN and AbortTime are only set for
+	// protocol version 4 with streaming=parallel.
+	PgoutputStreamAbort struct {
+		Xid       uint32
+		SubXid    uint32
+		AbortLSN  LSN
+		AbortTime time.Time
+	}
+
+	// PgoutputBeginPrepare is the start of a prepared transaction (protocol
+	// version 3 and newer with two_phase).
+	PgoutputBeginPrepare struct {
+		PrepareLSN  LSN       // LSN of the prepare.
+		EndLSN      LSN       // End LSN of the prepared transaction.
+		PrepareTime time.Time // Prepare timestamp of the transaction.
+		Xid         uint32    // Transaction ID.
+		GID         string    // Global transaction ID from PREPARE TRANSACTION.
+	}
+
+	// PgoutputPrepare is the end of a prepared transaction, sent for PREPARE
+	// TRANSACTION (protocol version 3 and newer with two_phase).
+	PgoutputPrepare struct {
+		Flags       uint8 // Currently unused.
+		PrepareLSN  LSN
+		EndLSN      LSN
+		PrepareTime time.Time
+		Xid         uint32
+		GID         string
+	}
+
+	// PgoutputCommitPrepared is a COMMIT PREPARED (protocol version 3 and
+	// newer with two_phase).
+	PgoutputCommitPrepared struct {
+		Flags      uint8 // Currently unused.
+		CommitLSN  LSN
+		EndLSN     LSN
+		CommitTime time.Time
+		Xid        uint32
+		GID        string
+	}
+
+	// PgoutputRollbackPrepared is a ROLLBACK PREPARED (protocol version 3 and
+	// newer with two_phase).
+	PgoutputRollbackPrepared struct {
+		Flags          uint8 // Currently unused.
+		PrepareEndLSN  LSN   // End LSN of the prepared transaction.
+		RollbackEndLSN LSN   // End LSN of the rollback.
+		PrepareTime    time.Time
+		RollbackTime   time.Time
+		Xid            uint32
+		GID            string
+	}
+
+	// PgoutputStreamPrepare is the prepare of a streamed transaction (protocol
+	// version 3 and newer with two_phase and streaming).
+	PgoutputStreamPrepare struct {
+		Flags       uint8 // Currently unused.
+		PrepareLSN  LSN
+		EndLSN      LSN
+		PrepareTime time.Time
+		Xid         uint32
+		GID         string
+	}
+)
+
+// PgoutputTuple is a row in a [PgoutputInsert], [PgoutputUpdate], or
+// [PgoutputDelete], with one value for every column of the relation.
+type PgoutputTuple []PgoutputValue
+
+// PgoutputValue is a column value in a [PgoutputTuple].
+type PgoutputValue struct {
+	// 'n' for NULL, 'u' for an unchanged TOASTed value (which isn't sent), 't'
+	// for the text format, or 'b' for the binary format.
+	Kind byte
+
+	// Value as sent by the server.
+	Data []byte
+
+	// Value decoded the same way as it would be in query results, e.g.
+	// time.Time for a timestamptz. nil for NULL and unchanged values.
+	Value any
+}
+
+func (*PgoutputBegin) pgoutputMessage()            {}
+func (*PgoutputCommit) pgoutputMessage()           {}
+func (*PgoutputOrigin) pgoutputMessage()           {}
+func (*PgoutputLogicalMessage) pgoutputMessage()   {}
+func (*PgoutputRelation) pgoutputMessage()         {}
+func (*PgoutputType) pgoutputMessage()             {}
+func (*PgoutputInsert) pgoutputMessage()           {}
+func (*PgoutputUpdate) pgoutputMessage()           {}
+func (*PgoutputDelete) pgoutputMessage()           {}
+func (*PgoutputTruncate) pgoutputMessage()         {}
+func (*PgoutputStreamStart) pgoutputMessage()      {}
+func (*PgoutputStreamStop) pgoutputMessage()       {}
+func (*PgoutputStreamCommit) pgoutputMessage()     {}
+func (*PgoutputStreamAbort) pgoutputMessage()      {}
+func (*PgoutputBeginPrepare) pgoutputMessage()     {}
+func (*PgoutputPrepare) pgoutputMessage()          {}
+func (*PgoutputCommitPrepared) pgoutputMessage()   {}
+func (*PgoutputRollbackPrepared) pgoutputMessage() {}
+func (*PgoutputStreamPrepare) pgoutputMessage()    {}
+
+// Relation returns the relation with the given OID, or nil if it's not known.
+func (d *PgoutputDecoder) Relation(id uint32) *PgoutputRelation {
+	return d.relations[id]
+}
+
+// Type returns the type with the given OID, or nil if it's not known. Only
+// types that aren't built in are sent by the server.
+func (d *PgoutputDecoder) Type(id oid.Oid) *PgoutputType {
+	return d.types[id]
+}
+
+var errPgoutputShort = errors.New("pq: pgoutput message too short")
+
+// Decode a pgoutput message.
+func (d *PgoutputDecoder) Decode(data []byte) (PgoutputMessage, error) {
+	if len(data) == 0 {
+		return nil, errPgoutputShort
+	}
+	var (
+		r   = pgoutputReader{b: data[1:]}
+		msg PgoutputMessage
+		err error
+	)
+	switch t := data[0]; t {
+	case 'B':
+		msg = &PgoutputBegin{FinalLSN: LSN(r.int64()), CommitTime: pgTime(r.int64()), Xid: r.uint32()}
+	case 'C':
+		msg = &PgoutputCommit{Flags: r.byte(), CommitLSN: LSN(r.int64()), EndLSN: LSN(r.int64()), CommitTime: pgTime(r.int64())}
+	case 'O':
+		msg = &PgoutputOrigin{CommitLSN: LSN(r.int64()), Name: r.string()}
+	case 'M':
+		m := &PgoutputLogicalMessage{Xid: d.xid(&r), Transactional: r.byte()&1 == 1, LSN: LSN(r.int64()), Prefix: r.string()}
+		m.Content = r.next(int(r.uint32()))
+		msg = m
+	case 'R':
+		rel := &PgoutputRelation{Xid: d.xid(&r), ID: r.uint32(), Namespace: r.string(), Name: r.string(), ReplicaIdentity: r.byte()}
+		n := int(r.uint16())
+		for i := 0; i < n && r.err == nil; i++ {
+			rel.Columns = append(rel.Columns, PgoutputColumn{
+				Key:          r.byte()&1 == 1,
+				Name:         r.string(),
+				Type:         oid.Oid(r.uint32()),
+				TypeModifier: int32(r.uint32()),
+			})
+		}
+		if r.err == nil {
+			if d.relations == nil {
+				d.relations = make(map[uint32]*PgoutputRelation)
+			}
+			d.relations[rel.ID] = rel
+		}
+		msg = rel
+	case 'Y':
+		typ := &PgoutputType{Xid: d.xid(&r), ID: oid.Oid(r.uint32()), Namespace: r.string(), Name: r.string()}
+		if r.err == nil {
+			if d.types == nil {
+				d.types = make(map[oid.Oid]*PgoutputType)
+			}
+			d.types[typ.ID] = typ
+		}
+		msg = typ
+	case 'I':
+		m := &PgoutputInsert{Xid: d.xid(&r)}
+		m.Relation, err = d.relation(r.uint32())
+		if err == nil {
+			if k := r.byte(); k != 'N' && r.err == nil {
+				return nil, fmt.Errorf("pq: unexpected tuple type %q in pgoutput Insert message", k)
+			}
+			m.New, err = d.tuple(&r, m.Relation)
+		}
+		msg = m
+	case 'U':
+		m := &PgoutputUpdate{Xid: d.xid(&r)}
+		m.Relation, err = d.relation(r.uint32())
+		if err == nil {
+			k := r.byte()
+			if k == 'K' || k == 'O' {
+				m.OldKind = k
+				m.Old, err = d.tuple(&r, m.Relation)
+				k = r.byte()
+			}
+			if k != 'N' && r.err == nil && err == nil {
+				return nil, fmt.Errorf("pq: unexpected tuple type %q in pgoutput Update message", k)
+			}
+			if err == nil {
+				m.New, err = d.tuple(&r, m.Relation)
+			}
+		}
+		msg = m
+	case 'D':
+		m := &PgoutputDelete{Xid: d.xid(&r)}
+		m.Relation, err = d.relation(r.uint32())
+		if err == nil {
+			m.OldKind = r.byte()
+			if m.OldKind != 'K' && m.OldKind != 'O' && r.err == nil {
+				return nil, fmt.Errorf("pq: unexpected tuple type %q in pgoutput Delete message", m.OldKind)
+			}
+			m.Old, err = d.tuple(&r, m.Relation)
+		}
+		msg = m
+	case 'T':
+		m := &PgoutputTruncate{Xid: d.xid(&r)}
+		n := int(r.uint32())
+		opt := r.byte()
+		m.Cascade, m.RestartIdentity = opt&1 == 1, opt&2 == 2
+		for i := 0; i < n && r.err == nil && err == nil; i++ {
+			var rel *PgoutputRelation
+			rel, err = d.relation(r.uint32())
+			m.Relations = append(m.Relations, rel)
+		}
+		msg = m
+	case 'S':
+		msg = &PgoutputStreamStart{Xid: r.uint32(), FirstSegment: r.byte() == 1}
+		d.streaming = r.err == nil
+	case 'E':
+		msg = &PgoutputStreamStop{}
+		d.streaming = false
+	case 'c':
+		msg = &PgoutputStreamCommit{Xid: r.uint32(), Flags: r.byte(), CommitLSN: LSN(r.int64()), EndLSN: LSN(r.int64()), CommitTime: pgTime(r.int64())}
+	case 'A':
+		m := &PgoutputStreamAbort{Xid: r.uint32(), SubXid: r.uint32()}
+		if len(r.b) > 0 { // Protocol version 4 with streaming=parallel.
+			m.AbortLSN, m.AbortTime = LSN(r.int64()), pgTime(r.int64())
+		}
+		msg = m
+	case 'b':
+		msg = &PgoutputBeginPrepare{PrepareLSN: LSN(r.int64()), EndLSN: LSN(r.int64()), PrepareTime: pgTime(r.int64()), Xid: r.uint32(), GID: r.string()}
+	case 'P':
+		msg = &PgoutputPrepare{Flags: r.byte(), PrepareLSN: LSN(r.int64()), EndLSN: LSN(r.int64()), PrepareTime: pgTime(r.int64()), Xid: r.uint32(), GID: r.string()}
+	case 'K':
+		msg = &PgoutputCommitPrepared{Flags: r.byte(), CommitLSN: LSN(r.int64()), EndLSN: LSN(r.int64()), CommitTime: pgTime(r.int64()), Xid: r.uint32(), GID: r.string()}
+	case 'r':
+		msg = &PgoutputRollbackPrepared{Flags: r.byte(), PrepareEndLSN: LSN(r.int64()), RollbackEndLSN: LSN(r.int64()), PrepareTime: pgTime(r.int64()), RollbackTime: pgTime(r.int64()), Xid: r.uint32(), GID: r.string()}
+	case 'p':
+		msg = &PgoutputStreamPrepare{Flags: r.byte(), PrepareLSN: LSN(r.int64()), EndLSN: LSN(r.int64()), PrepareTime: pgTime(r.int64()), Xid: r.uint32(), GID: r.string()}
+	default:
+		return nil, fmt.Errorf("pq: unknown pgoutput message type %q", t)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// xid reads the transaction ID that's sent for streamed transactions.
+func (d *PgoutputDecoder) xid(r *pgoutputReader) uint32 {
+	if !d.streaming {
+		return 0
+	}
+	return r.uint32()
+}
+
+func (d *PgoutputDecoder) relation(id uint32) (*PgoutputRelation, error) {
+	rel, ok := d.relations[id]
+	if !ok {
+		return nil, fmt.Errorf("pq: pgoutput message for unknown relation %d", id)
+	}
+	return rel, nil
+}
+
+func (d *PgoutputDecoder) tuple(r *pgoutputReader, rel *PgoutputRelation) (PgoutputTuple, error) {
+	n := int(r.uint16())
+	if r.err != nil {
+		return nil, nil
+	}
+	if n != len(rel.Columns) {
+		return nil, fmt.Errorf("pq: pgoutput tuple for %q has %d columns, but the relation has %d",
+			rel.Name, n, len(rel.Columns))
+	}
+
+	ps := parameterStatus{currentLocation: d.Location}
+	tup := make(PgoutputTuple, n)
+	for i := range tup {
+		tup[i].Kind = r.byte()
+		switch tup[i].Kind {
+		case 'n', 'u':
+		case 't', 'b':
+			tup[i].Data = r.next(int(r.uint32()))
+			if r.err != nil {
+				return nil, nil
+			}
+			f := formatText
+			if tup[i].Kind == 'b' {
+				f = formatBinary
+			}
+			v, err := decode(&ps, tup[i].Data, rel.Columns[i].Type, f)
+			if err != nil {
+				return nil, fmt.Errorf("pq: decoding column %q of %q: %w", rel.Columns[i].Name, rel.Name, err)
+			}
+			tup[i].Value = v
+		default:
+			if r.err != nil {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("pq: unknown pgoutput column type %q", tup[i].Kind)
+		}
+	}
+	return tup, nil
+}
+
+// pgoutputReader is like readBuf, but records an error instead of panicking if
+// the message is too short.
+type pgoutputReader struct {
+	b   []byte
+	err error
+}
+
+func (r *pgoutputReader) next(n int) []byte {
+	if r.err != nil || n < 0 || len(r.b) < n {
+		r.err = errPgoutputShort
+		return nil
+	}
+	v := r.b[:n:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *pgoutputReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *pgoutputReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *pgoutputReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *pgoutputReader) int64() int64 {
+	if b := r.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (r *pgoutputReader) string() string {
+	i := bytes.IndexByte(r.b, 0)
+	if r.err != nil || i < 0 {
+		r.err = errPgoutputShort
+		return ""
+	}
+	s := string(r.b[:i])
+	r.b = r.b[i+1:]
+	return s
+}
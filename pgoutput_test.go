@@ -0,0 +1,231 @@
+package pq
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq/internal/pqtest"
+	"github.com/lib/pq/oid"
+)
+
+func TestPgoutputDecoder(t *testing.T) {
+	var (
+		d      PgoutputDecoder
+		ts     = pgTime(757479845123456)
+		tbl    = &PgoutputRelation{ID: 16385, Namespace: "public", Name: "tbl", ReplicaIdentity: 'd', Columns: []PgoutputColumn{{true, "id", oid.T_int4, -1}, {false, "ts", oid.T_timestamptz, -1}, {false, "name", oid.T_text, -1}, {false, "data", oid.T_bytea, -1}}}
+		t2     = &PgoutputRelation{Xid: 741, ID: 16386, Name: "t2", ReplicaIdentity: 'f', Columns: []PgoutputColumn{{false, "i", oid.T_int8, -1}}}
+		null   = PgoutputValue{Kind: 'n'}
+		toast  = PgoutputValue{Kind: 'u'}
+		tsv, _ = ParseTimestamp(nil, "2024-01-02 04:04:05.123456+01")
+		text   = func(s string, v any) PgoutputValue { return PgoutputValue{Kind: 't', Data: []byte(s), Value: v} }
+	)
+	tests := []struct {
+		name string
+		in   string
+		want PgoutputMessage
+	}{
+		{"begin", "B\x00\x00\x00\x00\x01k7H\x00\x02\xb0\xec\x85\x17\xd5\x80\x00\x00\x02\xe4",
+			&PgoutputBegin{FinalLSN: 0x16B3748, CommitTime: ts, Xid: 740}},
+		{"origin", "O\x00\x00\x00\x00\x01k0\x00origin1\x00",
+			&PgoutputOrigin{CommitLSN: 0x16B3000, Name: "origin1"}},
+		{"type", "Y\x00\x00@\x06public\x00mood\x00",
+			&PgoutputType{ID: 16390, Namespace: "public", Name: "mood"}},
+		{"relation", "R\x00\x00@\x01public\x00tbl\x00d\x00\x04\x01id\x00\x00\x00\x00\x17\xff\xff\xff\xff\x00ts\x00\x00\x00\x04\xa0\xff\xff\xff\xff\x00name\x00\x00\x00\x00\x19\xff\xff\xff\xff\x00data\x00\x00\x00\x00\x11\xff\xff\xff\xff",
+			tbl},
+		{"insert", "I\x00\x00@\x01N\x00\x04t\x00\x00\x00\x011t\x00\x00\x00\x1d2024-01-02 04:04:05.123456+01t\x00\x00\x00\x05hellot\x00\x00\x00\x06\\x0102",
+			&PgoutputInsert{Relation: tbl, New: PgoutputTuple{text("1", int64(1)), text("2024-01-02 04:04:05.123456+01", tsv), text("hello", "hello"), text(`\x0102`, []byte{1, 2})}}},
+		{"update", "U\x00\x00@\x01O\x00\x04t\x00\x00\x00\x011nunN\x00\x04t\x00\x00\x00\x012nun",
+			&PgoutputUpdate{Relation: tbl, OldKind: 'O', Old: PgoutputTuple{text("1", int64(1)), null, toast, null}, New: PgoutputTuple{text("2", int64(2)), null, toast, null}}},
+		{"update without old", "U\x00\x00@\x01N\x00\x04t\x00\x00\x00\x013nnn",
+			&PgoutputUpdate{Relation: tbl, New: PgoutputTuple{text("3", int64(3)), null, null, null}}},
+		{"delete", "D\x00\x00@\x01K\x00\x04t\x00\x00\x00\x012nnn",
+			&PgoutputDelete{Relation: tbl, OldKind: 'K', Old: PgoutputTuple{text("2", int64(2)), null, null, null}}},
+		{"truncate", "T\x00\x00\x00\x01\x03\x00\x00@\x01",
+			&PgoutputTruncate{Cascade: true, RestartIdentity: true, Relations: []*PgoutputRelation{tbl}}},
+		{"message", "M\x01\x00\x00\x00\x00\x01k7Ppfx\x00\x00\x00\x00\x03abc",
+			&PgoutputLogicalMessage{Transactional: true, LSN: 0x16B3750, Prefix: "pfx", Content: []byte("abc")}},
+		{"commit", "C\x00\x00\x00\x00\x00\x01k7H\x00\x00\x00\x00\x01k7\x80\x00\x02\xb0\xec\x85\x17\xd5\x80",
+			&PgoutputCommit{CommitLSN: 0x16B3748, EndLSN: 0x16B3780, CommitTime: ts}},
+
+		// Streamed transaction; messages in the stream have an xid.
+		{"stream start", "S\x00\x00\x02\xe5\x01",
+			&PgoutputStreamStart{Xid: 741, FirstSegment: true}},
+		{"stream relation", "R\x00\x00\x02\xe5\x00\x00@\x02\x00t2\x00f\x00\x01\x00i\x00\x00\x00\x00\x14\xff\xff\xff\xff",
+			t2},
+		{"stream insert", "I\x00\x00\x02\xe5\x00\x00@\x02N\x00\x01t\x00\x00\x00\x0299",
+			&PgoutputInsert{Xid: 741, Relation: t2, New: PgoutputTuple{text("99", int64(99))}}},
+		{"stream message", "M\x00\x00\x02\xe5\x01\x00\x00\x00\x00\x01k9\x00p\x00\x00\x00\x00\x00",
+			&PgoutputLogicalMessage{Xid: 741, Transactional: true, LSN: 0x16B3900, Prefix: "p", Content: []byte{}}},
+		{"stream stop", "E",
+			&PgoutputStreamStop{}},
+		{"stream commit", "c\x00\x00\x02\xe5\x00\x00\x00\x00\x00\x01k:\x00\x00\x00\x00\x00\x01k:\x80\x00\x02\xb0\xec\x85\x17\xd5\x80",
+			&PgoutputStreamCommit{Xid: 741, CommitLSN: 0x16B3A00, EndLSN: 0x16B3A80, CommitTime: ts}},
+		{"stream abort", "A\x00\x00\x02\xe5\x00\x00\x02\xe6",
+			&PgoutputStreamAbort{Xid: 741, SubXid: 742}},
+		{"stream abort v4", "A\x00\x00\x02\xe5\x00\x00\x02\xe6\x00\x00\x00\x00\x01k;\x00\x00\x02\xb0\xec\x85\x17\xd5\x80",
+			&PgoutputStreamAbort{Xid: 741, SubXid: 742, AbortLSN: 0x16B3B00, AbortTime: ts}},
+
+		// Not streaming any more: no xid.
+		{"insert after stream", "I\x00\x00@\x02N\x00\x01t\x00\x00\x00\x0299",
+			&PgoutputInsert{Relation: t2, New: PgoutputTuple{text("99", int64(99))}}},
+
+		// Two-phase commit.
+		{"begin prepare", "b\x00\x00\x00\x00\x01k<\x00\x00\x00\x00\x00\x01k<\x80\x00\x02\xb0\xec\x85\x17\xd5\x80\x00\x00\x02\xe7tx1\x00",
+			&PgoutputBeginPrepare{PrepareLSN: 0x16B3C00, EndLSN: 0x16B3C80, PrepareTime: ts, Xid: 743, GID: "tx1"}},
+		{"prepare", "P\x00\x00\x00\x00\x00\x01k<\x00\x00\x00\x00\x00\x01k<\x80\x00\x02\xb0\xec\x85\x17\xd5\x80\x00\x00\x02\xe7tx1\x00",
+			&PgoutputPrepare{PrepareLSN: 0x16B3C00, EndLSN: 0x16B3C80, PrepareTime: ts, Xid: 743, GID: "tx1"}},
+		{"commit prepared", "K\x00\x00\x00\x00\x00\x01k=\x00\x00\x00\x00\x00\x01k=\x80\x00\x02\xb0\xec\x85\x17\xd5\x80\x00\x00\x02\xe7tx1\x00",
+			&PgoutputCommitPrepared{CommitLSN: 0x16B3D00, EndLSN: 0x16B3D80, CommitTime: ts, Xid: 743, GID: "tx1"}},
+		{"rollback prepared", "r\x00\x00\x00\x00\x00\x01k<\x80\x00\x00\x00\x00\x01k>\x00\x00\x02\xb0\xec\x85\x17\xd5\x80\x00\x02\xb0\xec\x85\x17\xd5\x80\x00\x00\x02\xe8tx2\x00",
+			&PgoutputRollbackPrepared{PrepareEndLSN: 0x16B3C80, RollbackEndLSN: 0x16B3E00, PrepareTime: ts, RollbackTime: ts, Xid: 744, GID: "tx2"}},
+		{"stream prepare", "p\x00\x00\x00\x00\x00\x01k?\x00\x00\x00\x00\x00\x01k?\x80\x00\x02\xb0\xec\x85\x17\xd5\x80\x00\x00\x02\xe5tx3\x00",
+			&PgoutputStreamPrepare{PrepareLSN: 0x16B3F00, EndLSN: 0x16B3F80, PrepareTime: ts, Xid: 741, GID: "tx3"}},
+	}
+	// Run sequentially, as the decoder keeps state.
+	for _, tt := range tests {
+		have, err := d.Decode([]byte(tt.in))
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("%s\nhave: %#v\nwant: %#v", tt.name, have, tt.want)
+		}
+	}
+
+	if !ts.Equal(time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC)) {
+		t.Errorf("wrong time: %s", ts)
+	}
+	if !tsv.Equal(ts) {
+		t.Errorf("wrong time: %s", tsv)
+	}
+	if !reflect.DeepEqual(d.Relation(16385), tbl) {
+		t.Errorf("Relation: %#v", d.Relation(16385))
+	}
+	if typ := d.Type(16390); typ == nil || typ.Name != "mood" {
+		t.Errorf("Type: %#v", typ)
+	}
+}
+
+func TestPgoutputDecoderLocation(t *testing.T) {
+	var (
+		loc = time.FixedZone("CET", 3600)
+		d   = PgoutputDecoder{Location: loc}
+	)
+	for _, in := range []string{
+		"R\x00\x00@\x01\x00t\x00d\x00\x01\x00ts\x00\x00\x00\x04\xa0\xff\xff\xff\xff",
+		"I\x00\x00@\x01N\x00\x01t\x00\x00\x00\x1d2024-01-02 04:04:05.123456+01",
+	} {
+		msg, err := d.Decode([]byte(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ins, ok := msg.(*PgoutputInsert); ok {
+			if have := ins.New[0].Value.(time.Time); have.Location() != loc {
+				t.Errorf("wrong location: %s", have.Location())
+			}
+		}
+	}
+}
+
+func TestPgoutputDecoderError(t *testing.T) {
+	tests := []struct {
+		in      string
+		wantErr string
+	}{
+		{"", "pq: pgoutput message too short"},
+		{"B\x00\x00\x00\x00\x01k7H", "pq: pgoutput message too short"},
+		{"R\x00\x00@\x01public\x00tbl", "pq: pgoutput message too short"},
+		{"R\x00\x00@\x01public\x00tbl\x00d\x00\x01", "pq: pgoutput message too short"},
+		{"X", `pq: unknown pgoutput message type 'X'`},
+		{"P\x00\x00\x00\x00\x00\x01k<\x00\x00\x00\x00\x00\x01k<\x80\x00\x02\xb0\xec\x85\x17\xd5\x80\x00\x00\x02\xe7tx1", "pq: pgoutput message too short"},
+		{"I\x00\x00\x00\x63N\x00\x00", "pq: pgoutput message for unknown relation 99"},
+		{"I\x00\x00@\x01N\x00\x02t\x00\x00\x00\x011n", "pq: pgoutput tuple for \"t\" has 2 columns, but the relation has 1"},
+		{"I\x00\x00@\x01N\x00\x01t\x00\x00\x00\x05x", "pq: pgoutput message too short"},
+		{"I\x00\x00@\x01N\x00\x01z", `pq: unknown pgoutput column type 'z'`},
+		{"I\x00\x00@\x01X\x00\x01n", `pq: unexpected tuple type 'X' in pgoutput Insert message`},
+		{"D\x00\x00@\x01N\x00\x01n", `pq: unexpected tuple type 'N' in pgoutput Delete message`},
+		{"I\x00\x00@\x01N\x00\x01t\x00\x00\x00\x01x", `pq: decoding column "i" of "t": pq: strconv.ParseInt: parsing "x": invalid syntax`},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			var d PgoutputDecoder
+			_, err := d.Decode([]byte("R\x00\x00@\x01\x00t\x00d\x00\x01\x00i\x00\x00\x00\x00\x17\xff\xff\xff\xff"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = d.Decode([]byte(tt.in))
+			if !pqtest.ErrorContains(err, tt.wantErr) {
+				t.Errorf("wrong error for %q\nhave: %v\nwant: %s", tt.in, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPgoutputReplication(t *testing.T) {
+	pqtest.SkipPgbouncer(t)
+	pqtest.SkipPgpool(t)
+	pqtest.SkipCockroach(t)
+	t.Parallel()
+
+	var (
+		ctx  = context.Background()
+		db   = pqtest.MustDB(t)
+		rc   = replicationConn(t, "")
+		name = fmt.Sprintf("pqgo_%d", time.Now().UnixNano())
+	)
+	pqtest.Exec(t, db, `create table `+name+` (id int primary key, ts timestamptz, t text)`)
+	pqtest.Exec(t, db, `create publication `+name+` for table `+name)
+	t.Cleanup(func() {
+		pqtest.Exec(t, db, `drop publication `+name)
+		pqtest.Exec(t, db, `drop table `+name)
+	})
+
+	s, err := rc.CreateReplicationSlot(ctx, name, "pgoutput", &ReplicationSlotOptions{Temporary: true, Snapshot: "nothing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rc.StartReplication(ctx, name, s.ConsistentPoint, map[string]string{
+		"proto_version":     "1",
+		"publication_names": name,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pqtest.Exec(t, db, `insert into `+name+` values (1, '2024-01-02 03:04:05.123456+00', 'x')`)
+
+	d := PgoutputDecoder{Location: rc.Location()}
+	for {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		msg, err := rc.Receive(ctx)
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, ok := msg.(*XLogData)
+		if !ok {
+			continue
+		}
+		m, err := d.Decode(x.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ins, ok := m.(*PgoutputInsert); ok {
+			if ins.Relation.Name != name || len(ins.New) != 3 {
+				t.Fatalf("%#v", ins)
+			}
+			if ins.New[0].Value != int64(1) || ins.New[2].Value != "x" {
+				t.Errorf("%#v", ins.New)
+			}
+			ts, ok := ins.New[1].Value.(time.Time)
+			if !ok || !ts.Equal(time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC)) {
+				t.Errorf("%#v", ins.New[1].Value)
+			}
+		}
+		if _, ok := m.(*PgoutputCommit); ok {
+			break
+		}
+	}
+}
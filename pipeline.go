@@ -0,0 +1,364 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/lib/pq/internal/proto"
+)
+
+var (
+	// ErrPipelineAborted is returned for queries in a pipeline that were not
+	// run because an earlier query in the same pipeline segment failed.
+	ErrPipelineAborted = errors.New("pq: pipeline aborted because an earlier query failed")
+
+	errPipelineActive   = errors.New("pq: pipeline in progress; call Close() to finish it")
+	errPipelineClosed   = errors.New("pq: pipeline has already been closed")
+	errPipelineNoResult = errors.New("pq: no queued queries left in pipeline")
+)
+
+// Pipeline sends queries to the server without waiting for the results of
+// earlier queries, similar to libpq's pipeline mode. This can save a lot of
+// round trips on high-latency connections.
+//
+// Queries are queued with [Pipeline.Queue] and sent with [Pipeline.Sync], which
+// ends a "pipeline segment". The results are read in the same order as the
+// queries were queued with [Pipeline.Exec] or [Pipeline.Query]. If a query
+// fails then all following queries in the same segment are skipped and return
+// [ErrPipelineAborted]; queries after the next Sync are run as normal.
+//
+// Every segment runs in an implicit transaction unless an explicit transaction
+// is started with BEGIN; this is committed on Sync (or rolled back if a query
+// failed).
+//
+// The connection can't be used for anything else until the pipeline is closed
+// with [Pipeline.Close]. Queued messages are kept in memory until Sync or Flush
+// is called; call these regularly for very large pipelines.
+//
+// A pipeline is created on a pq connection, which can be retrieved with
+// [sql.Conn.Raw]:
+//
+//	err = c.Raw(func(driverConn any) error {
+//		p, err := pq.NewPipeline(ctx, driverConn.(driver.Conn))
+//		if err != nil {
+//			return err
+//		}
+//		defer p.Close()
+//
+//		p.Queue(`insert into t values ($1)`, 1)
+//		p.Queue(`select * from t`)
+//		if err := p.Sync(); err != nil {
+//			return err
+//		}
+//
+//		_, err = p.Exec()
+//		if err != nil {
+//			return err
+//		}
+//		rows, err := p.Query()
+//		[..]
+//	})
+type Pipeline struct {
+	cn      *conn
+	finish  func()
+	buf     *writeBuf       // Queued messages that haven't been sent yet.
+	pending []pipelineQuery // Queries and syncs we still need to read the results for.
+	flushed bool            // All results of sent queries will be sent by the server.
+	synced  bool            // No queries were queued since the last sync.
+	aborted bool            // A query failed; skip everything until the next sync.
+	rows    *rows           // Last result from Query().
+	closed  bool
+}
+
+type pipelineQuery struct {
+	query string
+	sync  bool
+}
+
+// NewPipeline puts the connection c in pipeline mode.
+//
+// The query is cancelled if ctx is cancelled before the pipeline is closed,
+// after which the connection can't be used any more.
+func NewPipeline(ctx context.Context, c driver.Conn) (*Pipeline, error) {
+	cn, err := asConn(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := cn.err.get(); err != nil {
+		return nil, err
+	}
+	if cn.busy != nil {
+		return nil, cn.busy
+	}
+	if err := cn.setStatementTimeout(ctx); err != nil {
+		return nil, cn.handleError(err)
+	}
+	cn.busy = errPipelineActive
+	return &Pipeline{cn: cn, finish: cn.watchCancel(ctx, false), flushed: true, synced: true}, nil
+}
+
+// next starts a new message in the pipeline's buffer.
+func (p *Pipeline) next(c proto.RequestCode) {
+	if p.buf == nil {
+		p.buf = &writeBuf{buf: []byte{byte(c), 0, 0, 0, 0}, pos: 1}
+		return
+	}
+	p.buf.next(c)
+}
+
+// Queue a query in the pipeline. It's not sent to the server until Sync or
+// Flush is called.
+//
+// The parameters are always sent in the text format, or binary format for
+// []byte, like with binary_parameters=yes.
+func (p *Pipeline) Queue(query string, args ...any) error {
+	if p.closed {
+		return errPipelineClosed
+	}
+	nv, err := p.cn.driverArgs(args)
+	if err != nil {
+		return err
+	}
+
+	var l, pos int
+	if p.buf != nil {
+		l, pos = len(p.buf.buf), p.buf.pos
+	}
+	p.next(proto.Parse)
+	err = p.cn.writeBinaryModeQuery(p.buf, query, nv, 0)
+	if err != nil {
+		if l == 0 {
+			p.buf = nil
+		} else {
+			p.buf.buf, p.buf.pos = p.buf.buf[:l], pos
+		}
+		return err
+	}
+	p.pending = append(p.pending, pipelineQuery{query: query})
+	p.flushed, p.synced = false, false
+	return nil
+}
+
+// Sync ends the pipeline segment and sends all queued queries to the server.
+func (p *Pipeline) Sync() error {
+	if p.closed {
+		return errPipelineClosed
+	}
+	p.next(proto.Sync)
+	p.pending = append(p.pending, pipelineQuery{sync: true})
+	p.flushed, p.synced = true, true
+	return p.send()
+}
+
+// Flush sends all queued queries to the server, and asks the server to send
+// the results it has so far, without ending the pipeline segment.
+//
+// This is done automatically when reading a result for a query that wasn't
+// sent yet.
+func (p *Pipeline) Flush() error {
+	if p.closed {
+		return errPipelineClosed
+	}
+	p.next(proto.Flush)
+	p.flushed = true
+	return p.send()
+}
+
+func (p *Pipeline) send() error {
+	if err := p.cn.err.get(); err != nil {
+		return err
+	}
+	if p.buf == nil {
+		return nil
+	}
+	b := p.buf
+	p.buf = nil
+	return p.cn.handleError(p.cn.write(b))
+}
+
+// Exec reads the result of the next query in the pipeline, discarding any rows
+// it returned.
+func (p *Pipeline) Exec() (driver.Result, error) {
+	q, err := p.nextResult()
+	if err != nil {
+		return nil, err
+	}
+
+	var r readBuf
+	for {
+		t, err := p.cn.recv1Buf(&r)
+		if err != nil {
+			return nil, p.cn.handleError(err)
+		}
+		switch t {
+		case proto.ParseComplete, proto.BindComplete, proto.NoData, proto.RowDescription, proto.DataRow:
+			// Ignore.
+		case proto.CommandComplete:
+			res, _, err := p.cn.parseComplete(r.string())
+			return res, p.cn.handleError(err)
+		case proto.EmptyQueryResponse:
+			return emptyRows, nil
+		case proto.ErrorResponse:
+			p.aborted = true
+			return nil, p.cn.handleError(parseError(&r, q.query), q.query)
+		default:
+			p.cn.err.set(driver.ErrBadConn)
+			return nil, fmt.Errorf("pq: unexpected message in pipeline: %q", t)
+		}
+	}
+}
+
+// Query reads the result of the next query in the pipeline as rows.
+//
+// The rows must be read or closed before the next result can be read; any
+// remaining rows are discarded if Exec or Query is called before that.
+func (p *Pipeline) Query() (driver.Rows, error) {
+	q, err := p.nextResult()
+	if err != nil {
+		return nil, err
+	}
+
+	var r readBuf
+	for {
+		t, err := p.cn.recv1Buf(&r)
+		if err != nil {
+			return nil, p.cn.handleError(err)
+		}
+		switch t {
+		case proto.ParseComplete, proto.BindComplete:
+			// Ignore.
+		case proto.RowDescription, proto.NoData:
+			p.rows = &rows{cn: p.cn, pipeline: p}
+			if t == proto.RowDescription {
+				p.rows.rowsHeader = parsePortalRowDescribe(&r)
+			}
+			return p.rows, nil
+		case proto.ErrorResponse:
+			p.aborted = true
+			return nil, p.cn.handleError(parseError(&r, q.query), q.query)
+		default:
+			p.cn.err.set(driver.ErrBadConn)
+			return nil, fmt.Errorf("pq: unexpected message in pipeline: %q", t)
+		}
+	}
+}
+
+// nextResult prepares for reading the result of the next query: it finishes
+// reading the previous rows, reads the results of syncs, and makes sure the
+// query was sent.
+func (p *Pipeline) nextResult() (pipelineQuery, error) {
+	if p.closed {
+		return pipelineQuery{}, errPipelineClosed
+	}
+	if err := p.cn.err.getForNext(); err != nil {
+		return pipelineQuery{}, err
+	}
+	if p.rows != nil {
+		_ = p.rows.Close() // Error was already returned from Query() or Next().
+		p.rows = nil
+	}
+
+	for len(p.pending) > 0 && p.pending[0].sync {
+		p.pending = p.pending[1:]
+		if err := p.readSync(); err != nil {
+			return pipelineQuery{}, err
+		}
+	}
+	if len(p.pending) == 0 {
+		return pipelineQuery{}, errPipelineNoResult
+	}
+
+	q := p.pending[0]
+	p.pending = p.pending[1:]
+	if p.aborted {
+		return q, ErrPipelineAborted
+	}
+	if !p.flushed {
+		if err := p.Flush(); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// readSync reads the ReadyForQuery sent for a Sync.
+func (p *Pipeline) readSync() error {
+	if debugProto {
+		fmt.Fprintln(os.Stderr, "         START Pipeline.readSync")
+		defer fmt.Fprintln(os.Stderr, "         END Pipeline.readSync")
+	}
+	var (
+		r      readBuf
+		resErr error
+	)
+	for {
+		t, err := p.cn.recv1Buf(&r)
+		if err != nil {
+			return p.cn.handleError(err)
+		}
+		switch t {
+		case proto.ReadyForQuery:
+			p.cn.processReadyForQuery(&r)
+			p.aborted = false
+			return p.cn.handleError(resErr)
+		case proto.ErrorResponse:
+			// Can happen on commit of the implicit transaction, e.g. for
+			// deferred constraints.
+			resErr = parseError(&r, "")
+		default:
+			p.cn.err.set(driver.ErrBadConn)
+			return fmt.Errorf("pq: unexpected message in pipeline: %q; expected ReadyForQuery", t)
+		}
+	}
+}
+
+// Close ends pipeline mode. Any queued queries are sent and all remaining
+// results are discarded.
+//
+// The connection can be used as normal after this.
+func (p *Pipeline) Close() error {
+	if p.closed {
+		return nil
+	}
+	defer func() {
+		p.closed = true
+		p.cn.busy = nil
+		p.finish()
+	}()
+
+	if !p.synced {
+		if err := p.Sync(); err != nil {
+			return err
+		}
+	}
+	for len(p.pending) > 0 {
+		_, err := p.Exec()
+		switch {
+		case err == errPipelineNoResult:
+			return nil
+		case err == ErrPipelineAborted:
+		case p.cn.err.get() != nil:
+			return err
+		}
+	}
+	return nil
+}
+
+// driverArgs converts args to driver values, like database/sql does.
+func (cn *conn) driverArgs(args []any) ([]driver.NamedValue, error) {
+	nv := make([]driver.NamedValue, len(args))
+	for i, a := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: a}
+		err := cn.CheckNamedValue(&nv[i])
+		if err == driver.ErrSkip {
+			nv[i].Value, err = driver.DefaultParameterConverter.ConvertValue(a)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("pq: converting argument $%d type %T: %w", i+1, a, err)
+		}
+	}
+	return nv, nil
+}
@@ -0,0 +1,287 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq/internal/pqtest"
+	"github.com/lib/pq/internal/proto"
+	"github.com/lib/pq/pqerror"
+)
+
+// withPipeline runs f with a pipeline on a connection from the DSN.
+func withPipeline(t *testing.T, dsn string, f func(*Pipeline)) {
+	t.Helper()
+	db := pqtest.MustDB(t, dsn)
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = c.Raw(func(driverConn any) error {
+		p, err := NewPipeline(context.Background(), driverConn.(driver.Conn))
+		if err != nil {
+			return err
+		}
+		f(p)
+		return p.Close()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Connection is usable after the pipeline is closed.
+	var n int
+	if err := c.QueryRowContext(context.Background(), `select 1`).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("n=%d; err=%v", n, err)
+	}
+}
+
+// queryRows reads all rows of the next pipeline result.
+func queryRows(t *testing.T, p *Pipeline) [][]string {
+	t.Helper()
+	rows, err := p.Query()
+	return readRows(t, rows, err)
+}
+
+// readRows reads all rows as strings.
+func readRows(t *testing.T, rows driver.Rows, err error) [][]string {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var (
+		have [][]string
+		dest = make([]driver.Value, len(rows.Columns()))
+	)
+	for {
+		err := rows.Next(dest)
+		if err == io.EOF {
+			return have
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		row := make([]string, len(dest))
+		for i := range dest {
+			row[i] = fmt.Sprintf("%s", dest[i])
+			if n, ok := dest[i].(int64); ok {
+				row[i] = strconv.FormatInt(n, 10)
+			}
+		}
+		have = append(have, row)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	t.Parallel()
+	withPipeline(t, "", func(p *Pipeline) {
+		must := func(err error) {
+			t.Helper()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		must(p.Queue(`create temp table tbl (i int, t text)`))
+		must(p.Queue(`insert into tbl values ($1, $2), ($3, $4)`, 1, "one", 2, []byte("two")))
+		must(p.Queue(`select * from tbl order by i`))
+		must(p.Queue(`select $1::int`, 3))
+		must(p.Sync())
+
+		_, err := p.Exec()
+		must(err)
+		res, err := p.Exec()
+		must(err)
+		if n, _ := res.RowsAffected(); n != 2 {
+			t.Errorf("RowsAffected: %d", n)
+		}
+
+		rows, err := p.Query()
+		must(err)
+		if !reflect.DeepEqual(rows.Columns(), []string{"i", "t"}) {
+			t.Errorf("columns: %v", rows.Columns())
+		}
+		have := readRows(t, rows, err)
+		if want := [][]string{{"1", "one"}, {"2", "two"}}; !reflect.DeepEqual(have, want) {
+			t.Errorf("\nhave: %v\nwant: %v", have, want)
+		}
+
+		// Not reading all rows is fine.
+		_, err = p.Query()
+		must(err)
+
+		_, err = p.Exec()
+		if err != errPipelineNoResult {
+			t.Errorf("wrong error: %v", err)
+		}
+
+		// Results for queries that weren't synced yet.
+		must(p.Queue(`select 1`))
+		if have := queryRows(t, p); len(have) != 1 {
+			t.Errorf("have: %v", have)
+		}
+	})
+}
+
+func TestPipelineAborted(t *testing.T) {
+	t.Parallel()
+	withPipeline(t, "", func(p *Pipeline) {
+		p.Queue(`create temp table tbl (i int primary key)`)
+		p.Sync()
+		p.Queue(`insert into tbl values (1)`)
+		p.Queue(`insert into tbl values (1)`)
+		p.Queue(`insert into tbl values (2)`)
+		p.Sync()
+		p.Queue(`insert into tbl values (3)`)
+		p.Queue(`select i from tbl order by i`)
+		p.Sync()
+
+		for i, want := range []error{nil, nil, &Error{Code: pqerror.UniqueViolation}, ErrPipelineAborted, nil} {
+			_, err := p.Exec()
+			switch want := want.(type) {
+			case nil:
+				if err != nil {
+					t.Errorf("%d: %v", i, err)
+				}
+			case *Error:
+				if pqErr := As(err, want.Code); pqErr == nil {
+					t.Errorf("%d: wrong error: %v", i, err)
+				}
+			default:
+				if err != want {
+					t.Errorf("%d: wrong error: %v", i, err)
+				}
+			}
+		}
+
+		// The failed segment was rolled back.
+		have := queryRows(t, p)
+		if want := [][]string{{"3"}}; !reflect.DeepEqual(have, want) {
+			t.Errorf("\nhave: %v\nwant: %v", have, want)
+		}
+	})
+}
+
+func TestPipelineBusy(t *testing.T) {
+	t.Parallel()
+	db := pqtest.MustDB(t)
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = c.Raw(func(driverConn any) error {
+		p, err := NewPipeline(context.Background(), driverConn.(driver.Conn))
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+
+		_, err = driverConn.(driver.ExecerContext).ExecContext(context.Background(), `select 1`, nil)
+		if !errors.Is(err, errPipelineActive) {
+			t.Errorf("wrong error: %v", err)
+		}
+		_, err = NewPipeline(context.Background(), driverConn.(driver.Conn))
+		if !errors.Is(err, errPipelineActive) {
+			t.Errorf("wrong error: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPipelineFake(t *testing.T) {
+	t.Parallel()
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		f.Startup(cn, nil)
+		var (
+			query string
+			skip  bool
+		)
+		for {
+			code, msg, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			if skip && code != proto.Sync {
+				continue
+			}
+			switch code {
+			case proto.Query:
+				if string(msg) == ";\x00" { // Ping()
+					f.WriteMsg(cn, proto.EmptyQueryResponse, "")
+				} else {
+					f.SimpleQuery(cn, "SELECT 1", "?column?", 1)
+				}
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.Parse:
+				query = strings.TrimRight(string(msg[1:]), "\x00")
+				f.WriteMsg(cn, proto.ParseComplete, "")
+			case proto.Bind:
+				f.WriteMsg(cn, proto.BindComplete, "")
+			case proto.Execute:
+				switch {
+				case strings.HasPrefix(query, "select"):
+					f.SimpleQuery(cn, "SELECT 1", "col", query[7:])
+				case query == "fail":
+					f.WriteMsg(cn, proto.ErrorResponse, "SERROR\x00C42601\x00Moops\x00\x00")
+					skip = true
+				default:
+					f.WriteMsg(cn, proto.NoData, "")
+					f.WriteMsg(cn, proto.CommandComplete, "INSERT 0 1\x00")
+				}
+			case proto.Sync:
+				skip = false
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.Terminate:
+				cn.Close()
+				return
+			}
+		}
+	})
+	defer f.Close()
+
+	withPipeline(t, f.DSN(), func(p *Pipeline) {
+		p.Queue("select a")
+		p.Queue("insert")
+		p.Queue("fail")
+		p.Queue("select b")
+		p.Sync()
+		p.Queue("select c")
+
+		have := queryRows(t, p)
+		if want := [][]string{{"a"}}; !reflect.DeepEqual(have, want) {
+			t.Errorf("\nhave: %v\nwant: %v", have, want)
+		}
+		res, err := p.Exec()
+		if n, _ := res.RowsAffected(); err != nil || n != 1 {
+			t.Errorf("n=%d; err=%v", n, err)
+		}
+		_, err = p.Exec()
+		if !pqtest.ErrorContains(err, "pq: oops") {
+			t.Errorf("wrong error: %v", err)
+		}
+		_, err = p.Query()
+		if err != ErrPipelineAborted {
+			t.Errorf("wrong error: %v", err)
+		}
+		have = queryRows(t, p)
+		if want := [][]string{{"c"}}; !reflect.DeepEqual(have, want) {
+			t.Errorf("\nhave: %v\nwant: %v", have, want)
+		}
+	})
+}
@@ -0,0 +1,228 @@
+package pq
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq/internal/proto"
+)
+
+// protoTrace logs all protocol messages exchanged with the server, similar to
+// PQtrace() in libpq; see [Connector.ProtocolTrace].
+//
+// Every message is logged on a single line with the time, the direction (F for
+// messages sent by the frontend, B for the backend), the length, the message
+// type, and a summary of the contents. Passwords, SASL and GSS messages, and
+// cancellation keys are redacted. Values for parameters and in rows aren't
+// logged.
+type protoTrace struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+const redacted = "[redacted]"
+
+// frontend logs messages sent to the server. msg is the full message(s),
+// including the type and length.
+func (t *protoTrace) frontend(msg []byte) {
+	if t == nil {
+		return
+	}
+	for len(msg) >= 5 {
+		c, l := proto.RequestCode(msg[0]), int(binary.BigEndian.Uint32(msg[1:5]))
+		if l < 4 || l+1 > len(msg) {
+			t.log('F', len(msg)-1, c.String(), "<truncated>")
+			return
+		}
+		t.log('F', l, c.String(), t.summarize(func() string { return frontendSummary(c, msg[5:l+1]) }))
+		msg = msg[l+1:]
+	}
+}
+
+// startup logs a startup packet (StartupMessage, SSLRequest, GSSENCRequest, or
+// CancelRequest), which doesn't have a message type. msg starts with the
+// length.
+func (t *protoTrace) startup(msg []byte) {
+	if t == nil || len(msg) < 8 {
+		return
+	}
+	var (
+		l    = int(binary.BigEndian.Uint32(msg))
+		code = binary.BigEndian.Uint32(msg[4:])
+		r    = readBuf(msg[8:])
+	)
+	switch code {
+	case proto.NegotiateSSLCode:
+		t.log('F', l, "SSLRequest", "")
+	case proto.NegotiateGSSCode:
+		t.log('F', l, "GSSENCRequest", "")
+	case proto.CancelRequestCode:
+		t.log('F', l, "CancelRequest", t.summarize(func() string {
+			return "pid=" + strconv.Itoa(r.int32()) + " key=" + redacted
+		}))
+	default:
+		t.log('F', l, "StartupMessage", t.summarize(func() string {
+			s := fmt.Sprintf("%d.%d", code>>16, code&0xffff)
+			for len(r) > 1 {
+				k, v := r.string(), r.string()
+				s += fmt.Sprintf(" %s=%q", k, v)
+			}
+			return s
+		}))
+	}
+}
+
+// backend logs a message received from the server. msg doesn't include the
+// type and length.
+func (t *protoTrace) backend(c proto.ResponseCode, msg []byte) {
+	if t == nil {
+		return
+	}
+	t.log('B', len(msg)+4, c.String(), t.summarize(func() string { return backendSummary(c, msg) }))
+}
+
+// response logs the single-byte response to an SSLRequest or GSSENCRequest.
+func (t *protoTrace) response(typ string, b byte) {
+	if t == nil {
+		return
+	}
+	t.log('B', 1, typ, strconv.QuoteRune(rune(b)))
+}
+
+// summarize calls fn, and recovers from the panic from readBuf if the message
+// is malformed.
+func (t *protoTrace) summarize(fn func() string) (s string) {
+	defer func() {
+		if recover() != nil {
+			s = "<malformed>"
+		}
+	}()
+	return fn()
+}
+
+func (t *protoTrace) log(dir byte, length int, typ, summary string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	line := fmt.Sprintf("%s %c %5d %-28s %s", t.now().Format("2006-01-02 15:04:05.000000"), dir, length, typ, summary)
+	_, _ = io.WriteString(t.w, strings.TrimRight(line, " ")+"\n")
+}
+
+func frontendSummary(c proto.RequestCode, msg []byte) string {
+	r := readBuf(msg)
+	switch c {
+	case proto.Query:
+		return strconv.Quote(r.string())
+	case proto.Parse:
+		s := fmt.Sprintf("stmt=%q query=%q", r.string(), r.string())
+		if n := r.int16(); n > 0 {
+			oids := make([]string, n)
+			for i := range oids {
+				oids[i] = strconv.Itoa(int(r.oid()))
+			}
+			s += " types=[" + strings.Join(oids, " ") + "]"
+		}
+		return s
+	case proto.Bind:
+		s := fmt.Sprintf("portal=%q stmt=%q", r.string(), r.string())
+		s += " formats=" + formatCodes(&r)
+		n := r.int16()
+		for range n {
+			if l := r.int32(); l > 0 {
+				r.next(l)
+			}
+		}
+		return s + fmt.Sprintf(" params=%d resultFormats=%s", n, formatCodes(&r))
+	case proto.Describe, proto.Close:
+		return fmt.Sprintf("%c %q", r.byte(), r.string())
+	case proto.Execute:
+		return fmt.Sprintf("portal=%q maxRows=%d", r.string(), r.int32())
+	case proto.FunctionCall:
+		return fmt.Sprintf("oid=%d", r.oid())
+	case proto.CopyFail:
+		return strconv.Quote(r.string())
+	case proto.PasswordMessage: // Also SASL and GSS responses.
+		return redacted
+	}
+	return ""
+}
+
+func formatCodes(r *readBuf) string {
+	n := r.int16()
+	f := make([]string, n)
+	for i := range f {
+		f[i] = strconv.Itoa(r.int16())
+	}
+	return "[" + strings.Join(f, " ") + "]"
+}
+
+func backendSummary(c proto.ResponseCode, msg []byte) string {
+	r := readBuf(msg)
+	switch c {
+	case proto.AuthenticationRequest:
+		code := proto.AuthCode(r.int32())
+		switch code {
+		case proto.AuthReqSASL:
+			var mechs []string
+			for len(r) > 1 {
+				mechs = append(mechs, r.string())
+			}
+			return code.String() + " " + strings.Join(mechs, " ")
+		case proto.AuthReqSASLCont, proto.AuthReqSASLFin, proto.AuthReqGSSCont:
+			return code.String() + " " + redacted
+		}
+		return code.String()
+	case proto.ParameterStatus:
+		return fmt.Sprintf("%s=%q", r.string(), r.string())
+	case proto.BackendKeyData:
+		return "pid=" + strconv.Itoa(r.int32()) + " key=" + redacted
+	case proto.ReadyForQuery:
+		return string(r.byte())
+	case proto.RowDescription:
+		n := r.int16()
+		cols := make([]string, n)
+		for i := range cols {
+			cols[i] = strconv.Quote(r.string())
+			r.next(18)
+		}
+		return fmt.Sprintf("columns=%d [%s]", n, strings.Join(cols, " "))
+	case proto.DataRow:
+		return fmt.Sprintf("columns=%d", r.int16())
+	case proto.CommandComplete:
+		return strconv.Quote(r.string())
+	case proto.ErrorResponse, proto.NoticeResponse:
+		var f []string
+		for len(r) > 1 {
+			typ := r.byte()
+			v := r.string()
+			switch typ {
+			case 'S', 'C', 'M':
+				f = append(f, fmt.Sprintf("%c %q", typ, v))
+			}
+		}
+		return strings.Join(f, " ")
+	case proto.NotificationResponse:
+		return fmt.Sprintf("pid=%d channel=%q payload=%q", r.int32(), r.string(), r.string())
+	case proto.ParameterDescription:
+		n := r.int16()
+		oids := make([]string, n)
+		for i := range oids {
+			oids[i] = strconv.Itoa(int(r.oid()))
+		}
+		return "types=[" + strings.Join(oids, " ") + "]"
+	case proto.CopyInResponse, proto.CopyOutResponse, proto.CopyBothResponse:
+		return fmt.Sprintf("format=%d columns=%d", r.byte(), r.int16())
+	case proto.NegotiateProtocolVersion:
+		s := fmt.Sprintf("minor=%d", r.int32())
+		for n := r.int32(); n > 0; n-- {
+			s += " " + strconv.Quote(r.string())
+		}
+		return s
+	}
+	return ""
+}
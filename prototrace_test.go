@@ -0,0 +1,114 @@
+package pq
+
+import (
+	"database/sql"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq/internal/pqtest"
+	"github.com/lib/pq/internal/proto"
+)
+
+func TestProtocolTrace(t *testing.T) {
+	t.Parallel()
+
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		if _, _, ok := f.ReadStartup(cn); !ok {
+			return
+		}
+		f.WriteMsg(cn, proto.AuthenticationRequest, "\x00\x00\x00\x03")
+		if _, _, ok := f.ReadMsg(cn); !ok {
+			return
+		}
+		f.WriteMsg(cn, proto.AuthenticationRequest, "\x00\x00\x00\x00")
+		f.WriteBackendKeyData(cn, 42, []byte("secretsecret"))
+		f.WriteMsg(cn, proto.ParameterStatus, "server_version\x0018.1\x00")
+		f.WriteMsg(cn, proto.ReadyForQuery, "I")
+
+		var parse bool
+		for {
+			code, _, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			switch code {
+			case proto.Terminate:
+				cn.Close()
+				return
+			case proto.Query:
+				f.SimpleQuery(cn, "SELECT 1", "x", 1)
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.Parse:
+				parse = true
+			case proto.Sync:
+				if parse {
+					f.WriteMsg(cn, proto.ParseComplete, "")
+					f.WriteMsg(cn, proto.ParameterDescription, "\x00\x01\x00\x00\x00\x17")
+					f.WriteMsg(cn, proto.NoData, "")
+				} else {
+					f.WriteMsg(cn, proto.BindComplete, "")
+					f.WriteMsg(cn, proto.CommandComplete, "INSERT 0 1\x00")
+				}
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+				parse = false
+			}
+		}
+	})
+	defer f.Close()
+
+	c, err := NewConnector(f.DSN() + " sslmode=disable password=hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	c.ProtocolTrace(&buf)
+	c.protoTrace.now = func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC) }
+
+	db := sql.OpenDB(c)
+	pqtest.QueryRow[int](t, db, `select 1`)
+	pqtest.Exec(t, db, `insert into tbl values ($1)`, 1)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	have := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(have) == 0 || !strings.HasPrefix(have[0], "2026-01-02 03:04:05.000006 F ") ||
+		!strings.Contains(have[0], " StartupMessage ") || !strings.Contains(have[0], " 3.0 ") {
+		t.Fatalf("wrong first line: %q", have)
+	}
+	want := []string{
+		`2026-01-02 03:04:05.000006 B     8 (R) AuthRequest              password (3)`,
+		`2026-01-02 03:04:05.000006 F    12 (p) PasswordMessage          [redacted]`,
+		`2026-01-02 03:04:05.000006 B     8 (R) AuthRequest              ok (0)`,
+		`2026-01-02 03:04:05.000006 B    20 (K) BackendKeyData           pid=42 key=[redacted]`,
+		`2026-01-02 03:04:05.000006 B    24 (S) ParamStatus              server_version="18.1"`,
+		`2026-01-02 03:04:05.000006 B     5 (Z) ReadyForQuery            I`,
+		`2026-01-02 03:04:05.000006 F    13 (Q) Query                    "select 1"`,
+		`2026-01-02 03:04:05.000006 B    26 (T) RowDescription           columns=1 ["x"]`,
+		`2026-01-02 03:04:05.000006 B    11 (D) DataRow                  columns=1`,
+		`2026-01-02 03:04:05.000006 B    13 (C) CommandComplete          "SELECT 1"`,
+		`2026-01-02 03:04:05.000006 B     5 (Z) ReadyForQuery            I`,
+		`2026-01-02 03:04:05.000006 F    35 (P) Parse                    stmt="" query="insert into tbl values ($1)"`,
+		`2026-01-02 03:04:05.000006 F     6 (D) Describe                 S ""`,
+		`2026-01-02 03:04:05.000006 F     4 (S) Sync`,
+		`2026-01-02 03:04:05.000006 B     4 (1) ParseComplete`,
+		`2026-01-02 03:04:05.000006 B    10 (t) ParamDescription         types=[23]`,
+		`2026-01-02 03:04:05.000006 B     4 (n) NoData`,
+		`2026-01-02 03:04:05.000006 B     5 (Z) ReadyForQuery            I`,
+		`2026-01-02 03:04:05.000006 F    17 (B) Bind                     portal="" stmt="" formats=[] params=1 resultFormats=[]`,
+		`2026-01-02 03:04:05.000006 F     9 (E) Execute                  portal="" maxRows=0`,
+		`2026-01-02 03:04:05.000006 F     4 (S) Sync`,
+		`2026-01-02 03:04:05.000006 B     4 (2) BindComplete`,
+		`2026-01-02 03:04:05.000006 B    15 (C) CommandComplete          "INSERT 0 1"`,
+		`2026-01-02 03:04:05.000006 B     5 (Z) ReadyForQuery            I`,
+		`2026-01-02 03:04:05.000006 F     4 (X) Terminate`,
+	}
+	if h, w := strings.Join(have[1:], "\n"), strings.Join(want, "\n"); h != w {
+		t.Errorf("\nhave:\n%s\nwant:\n%s", h, w)
+	}
+	if strings.Contains(buf.String(), "hunter2") || strings.Contains(buf.String(), "secret") {
+		t.Error("password or secret key in output")
+	}
+}
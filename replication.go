@@ -0,0 +1,672 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq/internal/proto"
+	"github.com/lib/pq/oid"
+)
+
+var (
+	errReplicationStreaming    = errors.New("pq: replication connection is streaming; call EndReplication() first")
+	errReplicationNotStreaming = errors.New("pq: replication connection is not streaming; call StartReplication() first")
+)
+
+// ReplicationConn is a connection that uses the [streaming replication
+// protocol], for example to receive changes with logical decoding.
+//
+// A ReplicationConn is not safe for concurrent use, with the exception of
+// [ReplicationConn.SendStandbyStatus], which can be called while another
+// goroutine is blocked in [ReplicationConn.Receive].
+//
+// [streaming replication protocol]: https://www.postgresql.org/docs/current/protocol-replication.html
+type ReplicationConn struct {
+	cn        *conn
+	sendMu    sync.Mutex // Guards writes to cn.
+	streaming bool       // Got CopyBothResponse.
+	copyDone  bool       // Server sent CopyDone.
+	ended     bool       // Server ended the stream without CopyBothResponse.
+
+	nextTimeline      int32 // Sent by the server at the end of a timeline.
+	nextTimelineStart LSN
+}
+
+// NewReplicationConn opens a new replication connection with the connector's
+// configuration.
+//
+// This is a logical replication connection (replication=database) unless the
+// replication parameter is set to something else in the configuration; set
+// replication=true for physical replication and base backups.
+func NewReplicationConn(ctx context.Context, c *Connector) (*ReplicationConn, error) {
+	cc := *c
+	cc.cfg = c.cfg.Clone()
+	if cc.cfg.Replication == "" || cc.cfg.Replication == ReplicationOff {
+		cc.cfg.Replication = ReplicationDatabase
+	}
+	// Replication commands can't be aborted with statement_timeout, and SET
+	// isn't allowed on physical replication connections.
+	cc.cfg.DeadlineStatementTimeout = false
+	cn, err := cc.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplicationConn{cn: cn}, nil
+}
+
+// Close the connection.
+func (rc *ReplicationConn) Close() error {
+	return rc.cn.Close()
+}
+
+// Location returns the time zone of the connection, as set with the TimeZone
+// parameter. This can be used for [PgoutputDecoder.Location].
+func (rc *ReplicationConn) Location() *time.Location {
+	return rc.cn.parameterStatus.currentLocation
+}
+
+// IdentifySystem is the result of [ReplicationConn.IdentifySystem].
+type IdentifySystem struct {
+	SystemID string // Unique system identifier of the cluster.
+	Timeline int32  // Current timeline ID.
+	XLogPos  LSN    // Current WAL flush location.
+	DBName   string // Database connected to; empty for physical replication.
+}
+
+// IdentifySystem requests the server to identify itself.
+func (rc *ReplicationConn) IdentifySystem(ctx context.Context) (IdentifySystem, error) {
+	rows, err := rc.command(ctx, "IDENTIFY_SYSTEM")
+	if err != nil {
+		return IdentifySystem{}, err
+	}
+	if len(rows) != 1 || len(rows[0]) < 4 {
+		return IdentifySystem{}, fmt.Errorf("pq: unexpected result for IDENTIFY_SYSTEM: %q", rows)
+	}
+	tli, err := strconv.ParseInt(rows[0][1], 10, 32)
+	if err != nil {
+		return IdentifySystem{}, fmt.Errorf("pq: parsing timeline for IDENTIFY_SYSTEM: %w", err)
+	}
+	pos, err := ParseLSN(rows[0][2])
+	if err != nil {
+		return IdentifySystem{}, err
+	}
+	return IdentifySystem{SystemID: rows[0][0], Timeline: int32(tli), XLogPos: pos, DBName: rows[0][3]}, nil
+}
+
+// ReplicationSlotOptions are options for [ReplicationConn.CreateReplicationSlot].
+type ReplicationSlotOptions struct {
+	// Create a temporary slot, which is dropped when the connection is closed.
+	Temporary bool
+
+	// What to do with the snapshot created for a logical slot: "export",
+	// "use", or "nothing". The default is the server's default, which is
+	// "export".
+	Snapshot string
+
+	// Reserve WAL for a physical slot immediately, rather than when a
+	// streaming replication client first connects.
+	ReserveWAL bool
+}
+
+// ReplicationSlot is the result of [ReplicationConn.CreateReplicationSlot].
+type ReplicationSlot struct {
+	SlotName        string // Name of the newly created slot.
+	ConsistentPoint LSN    // WAL location at which the slot became consistent.
+	SnapshotName    string // Identifier of the exported snapshot, if any.
+	OutputPlugin    string // Name of the output plugin; empty for physical slots.
+}
+
+// CreateReplicationSlot creates a logical replication slot with the output
+// plugin plugin (e.g. "pgoutput"), or a physical replication slot if plugin is
+// empty. opts may be nil.
+func (rc *ReplicationConn) CreateReplicationSlot(ctx context.Context, slot, plugin string, opts *ReplicationSlotOptions) (ReplicationSlot, error) {
+	if opts == nil {
+		opts = &ReplicationSlotOptions{}
+	}
+	var b strings.Builder
+	b.WriteString("CREATE_REPLICATION_SLOT ")
+	b.WriteString(QuoteIdentifier(slot))
+	if opts.Temporary {
+		b.WriteString(" TEMPORARY")
+	}
+	if plugin == "" {
+		b.WriteString(" PHYSICAL")
+		if opts.ReserveWAL {
+			b.WriteString(" RESERVE_WAL")
+		}
+	} else {
+		b.WriteString(" LOGICAL ")
+		b.WriteString(QuoteIdentifier(plugin))
+		switch opts.Snapshot {
+		case "":
+		case "export":
+			b.WriteString(" EXPORT_SNAPSHOT")
+		case "use":
+			b.WriteString(" USE_SNAPSHOT")
+		case "nothing":
+			b.WriteString(" NOEXPORT_SNAPSHOT")
+		default:
+			return ReplicationSlot{}, fmt.Errorf(`pq: invalid snapshot action %q; must be "export", "use", or "nothing"`, opts.Snapshot)
+		}
+	}
+
+	rows, err := rc.command(ctx, b.String())
+	if err != nil {
+		return ReplicationSlot{}, err
+	}
+	if len(rows) != 1 || len(rows[0]) < 4 {
+		return ReplicationSlot{}, fmt.Errorf("pq: unexpected result for CREATE_REPLICATION_SLOT: %q", rows)
+	}
+	var lsn LSN
+	if rows[0][1] != "" { // NULL for physical slots without RESERVE_WAL.
+		lsn, err = ParseLSN(rows[0][1])
+		if err != nil {
+			return ReplicationSlot{}, err
+		}
+	}
+	return ReplicationSlot{SlotName: rows[0][0], ConsistentPoint: lsn, SnapshotName: rows[0][2], OutputPlugin: rows[0][3]}, nil
+}
+
+// DropReplicationSlot drops a replication slot. If wait is true it waits until
+// the slot becomes inactive if it's active, instead of returning an error.
+func (rc *ReplicationConn) DropReplicationSlot(ctx context.Context, slot string, wait bool) error {
+	q := "DROP_REPLICATION_SLOT " + QuoteIdentifier(slot)
+	if wait {
+		q += " WAIT"
+	}
+	_, err := rc.command(ctx, q)
+	return err
+}
+
+// StartReplication starts streaming logical replication changes from the slot,
+// starting at the WAL location start. options are passed to the output plugin;
+// for example for pgoutput:
+//
+//	err := rc.StartReplication(ctx, "slot", 0, map[string]string{
+//		"proto_version":     "1",
+//		"publication_names": "my_pub",
+//	})
+//
+// Messages are read with [ReplicationConn.Receive] until the stream is stopped
+// with [ReplicationConn.EndReplication].
+func (rc *ReplicationConn) StartReplication(ctx context.Context, slot string, start LSN, options map[string]string) error {
+	var b strings.Builder
+	b.WriteString("START_REPLICATION SLOT ")
+	b.WriteString(QuoteIdentifier(slot))
+	b.WriteString(" LOGICAL ")
+	b.WriteString(start.String())
+	if len(options) > 0 {
+		keys := make([]string, 0, len(options))
+		for k := range options {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		b.WriteString(" (")
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(QuoteIdentifier(k))
+			b.WriteString(" ")
+			b.WriteString(replicationLiteral(options[k]))
+		}
+		b.WriteString(")")
+	}
+	return rc.startStreaming(ctx, b.String())
+}
+
+// StartPhysicalReplication starts streaming WAL from the WAL location start on
+// the given timeline; timeline 0 uses the server's current timeline. slot is
+// optional.
+//
+// If the timeline is not the server's current timeline, the server stops
+// streaming when it reaches the end of the timeline: [ReplicationConn.Receive]
+// returns io.EOF, after which [ReplicationConn.EndReplication] must be called.
+// [ReplicationConn.NextTimeline] then returns the next timeline.
+func (rc *ReplicationConn) StartPhysicalReplication(ctx context.Context, slot string, start LSN, timeline int32) error {
+	var b strings.Builder
+	b.WriteString("START_REPLICATION ")
+	if slot != "" {
+		b.WriteString("SLOT ")
+		b.WriteString(QuoteIdentifier(slot))
+		b.WriteString(" ")
+	}
+	b.WriteString("PHYSICAL ")
+	b.WriteString(start.String())
+	if timeline > 0 {
+		b.WriteString(" TIMELINE ")
+		b.WriteString(strconv.FormatInt(int64(timeline), 10))
+	}
+	return rc.startStreaming(ctx, b.String())
+}
+
+// NextTimeline returns the timeline that follows the timeline that was
+// streamed with [ReplicationConn.StartPhysicalReplication], and the WAL
+// location where it starts. This is only set after
+// [ReplicationConn.EndReplication] if the server ended the stream because it
+// reached the end of a historic timeline; timeline is 0 otherwise.
+func (rc *ReplicationConn) NextTimeline() (timeline int32, start LSN) {
+	return rc.nextTimeline, rc.nextTimelineStart
+}
+
+// TimelineHistory is the result of [ReplicationConn.TimelineHistory].
+type TimelineHistory struct {
+	Filename string // File name of the timeline history file, e.g. "00000002.history".
+	Content  []byte // Contents of the timeline history file.
+}
+
+// TimelineHistory retrieves the timeline history file for the timeline.
+func (rc *ReplicationConn) TimelineHistory(ctx context.Context, timeline int32) (TimelineHistory, error) {
+	rows, err := rc.command(ctx, "TIMELINE_HISTORY "+strconv.FormatInt(int64(timeline), 10))
+	if err != nil {
+		return TimelineHistory{}, err
+	}
+	if len(rows) != 1 || len(rows[0]) < 2 {
+		return TimelineHistory{}, fmt.Errorf("pq: unexpected result for TIMELINE_HISTORY: %q", rows)
+	}
+	return TimelineHistory{Filename: rows[0][0], Content: []byte(rows[0][1])}, nil
+}
+
+// ReplicationMessage is a message received with [ReplicationConn.Receive]; this
+// is either [*XLogData] or [*PrimaryKeepalive].
+type ReplicationMessage interface {
+	replicationMessage()
+}
+
+// XLogData is a chunk of WAL data streamed by the server. For logical
+// replication this is a single message from the output plugin.
+type XLogData struct {
+	WALStart     LSN       // Starting point of the WAL data in this message.
+	ServerWALEnd LSN       // Current end of WAL on the server.
+	ServerTime   time.Time // Server's system clock at the time of transmission.
+	Data         []byte
+}
+
+// PrimaryKeepalive is a keepalive message sent by the server.
+type PrimaryKeepalive struct {
+	ServerWALEnd LSN       // Current end of WAL on the server.
+	ServerTime   time.Time // Server's system clock at the time of transmission.
+
+	// The server wants a reply with [ReplicationConn.SendStandbyStatus] as
+	// soon as possible, to avoid a timeout disconnect.
+	ReplyRequested bool
+}
+
+func (*XLogData) replicationMessage()         {}
+func (*PrimaryKeepalive) replicationMessage() {}
+
+// Receive the next message from the replication stream.
+//
+// io.EOF is returned if the server ended the stream; call
+// [ReplicationConn.EndReplication] after this.
+//
+// If ctx is done before a message arrives the context's error is returned, and
+// Receive can be called again. This makes it possible to use a timeout to
+// periodically send a status update.
+func (rc *ReplicationConn) Receive(ctx context.Context) (ReplicationMessage, error) {
+	if !rc.streaming {
+		return nil, errReplicationNotStreaming
+	}
+	if rc.copyDone {
+		return nil, io.EOF
+	}
+	if err := rc.cn.err.get(); err != nil {
+		return nil, err
+	}
+
+	var r readBuf
+	for {
+		if err := rc.wait(ctx); err != nil {
+			return nil, err
+		}
+		t, err := rc.cn.recvMessage(&r)
+		if err != nil {
+			return nil, rc.cn.handleError(err)
+		}
+		switch t {
+		case proto.CopyDataResponse:
+			return parseReplicationMessage(r)
+		case proto.CopyDoneResponse:
+			rc.copyDone = true
+			return nil, io.EOF
+		case proto.NoticeResponse:
+			if n := rc.cn.noticeHandler; n != nil {
+				n(parseError(&r, ""))
+			}
+		case proto.ParameterStatus:
+			rc.cn.processParameterStatus(&r)
+		case proto.ErrorResponse:
+			rc.cn.err.set(driver.ErrBadConn)
+			return nil, rc.cn.handleError(parseError(&r, ""))
+		default:
+			rc.cn.err.set(driver.ErrBadConn)
+			return nil, fmt.Errorf("pq: unexpected message in replication stream: %q", t)
+		}
+	}
+}
+
+// wait waits until the header of the next message can be read, or until ctx is
+// done. No data is consumed if ctx is done, so the connection stays usable.
+func (rc *ReplicationConn) wait(ctx context.Context) error {
+	if ctx.Done() == nil || rc.cn.buf.Buffered() >= 5 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(done)
+		_ = rc.cn.c.SetReadDeadline(time.Unix(1, 0))
+	})
+	_, err := rc.cn.buf.Peek(5)
+	if !stop() {
+		<-done
+		_ = rc.cn.c.SetReadDeadline(time.Time{})
+		if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
+			return ctx.Err()
+		}
+	}
+	return rc.cn.handleError(err)
+}
+
+func parseReplicationMessage(r readBuf) (ReplicationMessage, error) {
+	if len(r) == 0 {
+		return nil, errors.New("pq: empty replication message")
+	}
+	switch t := r.byte(); t {
+	case 'w':
+		if len(r) < 24 {
+			return nil, fmt.Errorf("pq: replication message %q too short: %d bytes", t, len(r))
+		}
+		return &XLogData{
+			WALStart:     LSN(r.int64()),
+			ServerWALEnd: LSN(r.int64()),
+			ServerTime:   pgTime(r.int64()),
+			Data:         append([]byte(nil), r...), // r may be the scratch buffer.
+		}, nil
+	case 'k':
+		if len(r) < 17 {
+			return nil, fmt.Errorf("pq: replication message %q too short: %d bytes", t, len(r))
+		}
+		return &PrimaryKeepalive{
+			ServerWALEnd:   LSN(r.int64()),
+			ServerTime:     pgTime(r.int64()),
+			ReplyRequested: r.byte() == 1,
+		}, nil
+	default:
+		return nil, fmt.Errorf("pq: unknown replication message type %q", t)
+	}
+}
+
+// StandbyStatus is a status update for [ReplicationConn.SendStandbyStatus].
+type StandbyStatus struct {
+	WALWrite LSN // Last WAL location received and written to disk.
+	WALFlush LSN // Last WAL location flushed to disk.
+	WALApply LSN // Last WAL location applied.
+
+	// Client's system clock at the time of transmission; defaults to the
+	// current time.
+	ClientTime time.Time
+
+	// Ask the server to reply to this message immediately, with a
+	// [PrimaryKeepalive].
+	ReplyRequested bool
+}
+
+// SendStandbyStatus sends a status update to the server. The server uses
+// WALFlush to decide which WAL can be removed, and for logical replication
+// which transactions don't need to be sent again on reconnect.
+//
+// This should be sent periodically (more often than the server's
+// wal_sender_timeout) and when a [PrimaryKeepalive] asks for it.
+func (rc *ReplicationConn) SendStandbyStatus(s StandbyStatus) error {
+	if !rc.streaming {
+		return errReplicationNotStreaming
+	}
+	if s.ClientTime.IsZero() {
+		s.ClientTime = time.Now()
+	}
+
+	// Don't use the scratch buffer, as Receive() may be using it.
+	w := &writeBuf{buf: make([]byte, 5, 40), pos: 1}
+	w.buf[0] = byte(proto.CopyDataRequest)
+	w.byte('r')
+	w.int64(int64(s.WALWrite))
+	w.int64(int64(s.WALFlush))
+	w.int64(int64(s.WALApply))
+	w.int64(toPGTime(s.ClientTime))
+	if s.ReplyRequested {
+		w.byte(1)
+	} else {
+		w.byte(0)
+	}
+
+	rc.sendMu.Lock()
+	defer rc.sendMu.Unlock()
+	return rc.cn.handleError(rc.cn.write(w))
+}
+
+// EndReplication stops streaming; any remaining messages in the stream are
+// discarded. Commands can be sent again after this.
+func (rc *ReplicationConn) EndReplication(ctx context.Context) error {
+	if !rc.streaming {
+		return errReplicationNotStreaming
+	}
+	if err := rc.cn.err.get(); err != nil {
+		return err
+	}
+	if debugProto {
+		fmt.Fprintln(os.Stderr, "         START ReplicationConn.EndReplication")
+		defer fmt.Fprintln(os.Stderr, "         END ReplicationConn.EndReplication")
+	}
+	if rc.ended {
+		rc.streaming, rc.copyDone, rc.ended = false, false, false
+		return nil
+	}
+	defer rc.cn.watchCancel(ctx, false)()
+
+	rc.sendMu.Lock()
+	err := rc.cn.write(&writeBuf{buf: []byte{byte(proto.CopyDoneRequest), 0, 0, 0, 0}, pos: 1})
+	rc.sendMu.Unlock()
+	if err != nil {
+		return rc.cn.handleError(err)
+	}
+
+	var (
+		r      readBuf
+		typs   []fieldDesc
+		resErr error
+	)
+	for {
+		t, err := rc.cn.recv1Buf(&r)
+		if err != nil {
+			return rc.cn.handleError(err)
+		}
+		switch t {
+		case proto.CopyDataResponse, proto.CopyDoneResponse, proto.CommandComplete:
+			// Ignore.
+		case proto.RowDescription:
+			typs = parsePortalRowDescribe(&r).colTyps
+		case proto.DataRow:
+			resErr = rc.setNextTimeline(readDataRow(&r, typs))
+		case proto.ErrorResponse:
+			resErr = parseError(&r, "")
+		case proto.ReadyForQuery:
+			rc.cn.processReadyForQuery(&r)
+			rc.streaming, rc.copyDone = false, false
+			return rc.cn.handleError(resErr)
+		default:
+			rc.cn.err.set(driver.ErrBadConn)
+			return fmt.Errorf("pq: unexpected message while ending replication: %q", t)
+		}
+	}
+}
+
+// command runs a replication command and returns the rows it returned; see
+// readDataRow.
+func (rc *ReplicationConn) command(ctx context.Context, q string) ([][]string, error) {
+	if rc.streaming {
+		return nil, errReplicationStreaming
+	}
+	if err := rc.cn.err.get(); err != nil {
+		return nil, err
+	}
+	defer rc.cn.watchCancel(ctx, false)()
+
+	err := rc.sendQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		r      readBuf
+		typs   []fieldDesc
+		rows   [][]string
+		resErr error
+	)
+	for {
+		t, err := rc.cn.recv1Buf(&r)
+		if err != nil {
+			return nil, rc.cn.handleError(err, q)
+		}
+		switch t {
+		case proto.CommandComplete, proto.EmptyQueryResponse:
+			// Ignore.
+		case proto.RowDescription:
+			typs = parsePortalRowDescribe(&r).colTyps
+		case proto.DataRow:
+			rows = append(rows, readDataRow(&r, typs))
+		case proto.ErrorResponse:
+			resErr = parseError(&r, q)
+		case proto.ReadyForQuery:
+			rc.cn.processReadyForQuery(&r)
+			return rows, rc.cn.handleError(resErr, q)
+		default:
+			rc.cn.err.set(driver.ErrBadConn)
+			return nil, fmt.Errorf("pq: unexpected message for replication command: %q", t)
+		}
+	}
+}
+
+// startStreaming sends a START_REPLICATION command and waits for the server to
+// start streaming.
+func (rc *ReplicationConn) startStreaming(ctx context.Context, q string) error {
+	if rc.streaming {
+		return errReplicationStreaming
+	}
+	if err := rc.cn.err.get(); err != nil {
+		return err
+	}
+	defer rc.cn.watchCancel(ctx, false)()
+
+	err := rc.sendQuery(q)
+	if err != nil {
+		return err
+	}
+
+	var (
+		r      readBuf
+		typs   []fieldDesc
+		ended  bool
+		resErr error
+	)
+	rc.nextTimeline, rc.nextTimelineStart = 0, 0
+	for {
+		t, err := rc.cn.recv1Buf(&r)
+		if err != nil {
+			return rc.cn.handleError(err, q)
+		}
+		switch t {
+		case proto.CopyBothResponse:
+			rc.streaming, rc.copyDone = true, false
+			return nil
+		case proto.CommandComplete:
+			// Ignore.
+		case proto.RowDescription:
+			typs = parsePortalRowDescribe(&r).colTyps
+		case proto.DataRow:
+			// Physical replication from the end of a historic timeline: the
+			// server sends the next timeline without streaming anything.
+			resErr, ended = rc.setNextTimeline(readDataRow(&r, typs)), true
+		case proto.ErrorResponse:
+			resErr = parseError(&r, q)
+		case proto.ReadyForQuery:
+			rc.cn.processReadyForQuery(&r)
+			if resErr == nil && ended {
+				rc.streaming, rc.copyDone, rc.ended = true, true, true
+				return nil
+			}
+			if resErr == nil {
+				resErr = errUnexpectedReady
+			}
+			return rc.cn.handleError(resErr, q)
+		default:
+			rc.cn.err.set(driver.ErrBadConn)
+			return fmt.Errorf("pq: unexpected message for %s: %q", strings.SplitN(q, " ", 2)[0], t)
+		}
+	}
+}
+
+// replicationLiteral quotes s as a string literal for replication commands,
+// which don't support the E'...' strings QuoteLiteral may return.
+func replicationLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// setNextTimeline sets the next timeline from the result set the server sends
+// at the end of a timeline.
+func (rc *ReplicationConn) setNextTimeline(row []string) error {
+	if len(row) < 2 {
+		return fmt.Errorf("pq: unexpected result at end of replication: %q", row)
+	}
+	tli, err := strconv.ParseInt(row[0], 10, 32)
+	if err != nil {
+		return fmt.Errorf("pq: parsing next timeline: %w", err)
+	}
+	start, err := ParseLSN(row[1])
+	if err != nil {
+		return err
+	}
+	rc.nextTimeline, rc.nextTimelineStart = int32(tli), start
+	return nil
+}
+
+// readDataRow reads a DataRow as text. bytea values are decoded, and NULL
+// values are returned as an empty string.
+func readDataRow(r *readBuf, typs []fieldDesc) []string {
+	row := make([]string, r.int16())
+	for i := range row {
+		l := r.int32()
+		if l < 0 {
+			continue
+		}
+		v := r.next(l)
+		if i < len(typs) && typs[i].OID == oid.T_bytea {
+			if b, err := parseBytea(v); err == nil {
+				v = b
+			}
+		}
+		row[i] = string(v)
+	}
+	return row
+}
+
+func (rc *ReplicationConn) sendQuery(q string) error {
+	rc.sendMu.Lock()
+	defer rc.sendMu.Unlock()
+	b := rc.cn.writeBuf(proto.Query)
+	b.string(q)
+	return rc.cn.handleError(rc.cn.send(b), q)
+}
@@ -0,0 +1,397 @@
+package pq
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq/internal/pqtest"
+	"github.com/lib/pq/internal/proto"
+	"github.com/lib/pq/oid"
+)
+
+// replicationConn opens a replication connection, which is closed on test
+// cleanup.
+func replicationConn(t *testing.T, dsn string) *ReplicationConn {
+	t.Helper()
+	c, err := NewConnector(pqtest.DSN(dsn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := NewReplicationConn(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rc.Close() })
+	return rc
+}
+
+func TestReplication(t *testing.T) {
+	pqtest.SkipPgbouncer(t)
+	pqtest.SkipPgpool(t)
+	pqtest.SkipCockroach(t)
+	t.Parallel()
+
+	var (
+		ctx  = context.Background()
+		db   = pqtest.MustDB(t)
+		rc   = replicationConn(t, "")
+		slot = fmt.Sprintf("pqgo_%d", time.Now().UnixNano())
+	)
+	// Temporary tables aren't replicated.
+	pqtest.Exec(t, db, `create table `+slot+` (i int)`)
+	t.Cleanup(func() { pqtest.Exec(t, db, `drop table `+slot) })
+
+	sys, err := rc.IdentifySystem(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sys.DBName != "pqgo" || sys.Timeline < 1 || sys.XLogPos == 0 || sys.SystemID == "" {
+		t.Errorf("%#v", sys)
+	}
+
+	s, err := rc.CreateReplicationSlot(ctx, slot, "test_decoding", &ReplicationSlotOptions{Temporary: true, Snapshot: "nothing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.SlotName != slot || s.OutputPlugin != "test_decoding" || s.ConsistentPoint == 0 || s.SnapshotName != "" {
+		t.Errorf("%#v", s)
+	}
+
+	err = rc.StartReplication(ctx, slot, s.ConsistentPoint, map[string]string{"include-xids": "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.IdentifySystem(ctx); err != errReplicationStreaming {
+		t.Errorf("wrong error: %v", err)
+	}
+	pqtest.Exec(t, db, `insert into `+slot+` values (42)`)
+
+	var have []string
+	for len(have) < 3 {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		msg, err := rc.Receive(ctx)
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch msg := msg.(type) {
+		case *XLogData:
+			have = append(have, string(msg.Data))
+			err = rc.SendStandbyStatus(StandbyStatus{WALWrite: msg.WALStart, WALFlush: msg.WALStart, WALApply: msg.WALStart})
+		case *PrimaryKeepalive:
+			err = rc.SendStandbyStatus(StandbyStatus{})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"BEGIN", "table public." + slot + ": INSERT: i[integer]:42", "COMMIT"}
+	if strings.Join(have, "\n") != strings.Join(want, "\n") {
+		t.Errorf("\nhave: %q\nwant: %q", have, want)
+	}
+
+	// Receive times out without breaking the connection.
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	for {
+		_, err := rc.Receive(tctx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := rc.EndReplication(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.IdentifySystem(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplicationFake(t *testing.T) {
+	t.Parallel()
+
+	var (
+		msgs      = make(chan []byte, 1)
+		sendXLog  = make(chan struct{})
+		startTime = time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+	)
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		_, params, ok := f.ReadStartup(cn)
+		if !ok {
+			return
+		}
+		if params["replication"] != "database" {
+			f.WriteMsg(cn, proto.ErrorResponse, "SFATAL\x00C08P01\x00Mnot a replication connection\x00\x00")
+			return
+		}
+		f.WriteMsg(cn, proto.AuthenticationRequest, "\x00\x00\x00\x00")
+		f.WriteMsg(cn, proto.ReadyForQuery, "I")
+
+		for {
+			code, msg, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			switch code {
+			case proto.Query:
+				switch q := strings.TrimRight(string(msg), "\x00"); q {
+				case "IDENTIFY_SYSTEM":
+					f.SimpleQuery(cn, "IDENTIFY_SYSTEM", "systemid", "7341", "timeline", 1, "xlogpos", "0/16B3748", "dbname", "pqgo")
+					f.WriteMsg(cn, proto.ReadyForQuery, "I")
+				case `START_REPLICATION SLOT "slot" LOGICAL 0/16B3748 ("proto_version" '1', "publication_names" 'it''s')`:
+					f.WriteMsg(cn, proto.CopyBothResponse, "\x00\x00\x00")
+
+					<-sendXLog
+					b := []byte{'w'}
+					b = binary.BigEndian.AppendUint64(b, 0x16B3748)
+					b = binary.BigEndian.AppendUint64(b, 0x16B3800)
+					b = binary.BigEndian.AppendUint64(b, uint64(toPGTime(startTime)))
+					f.WriteMsg(cn, proto.CopyDataResponse, string(append(b, "data"...)))
+
+					b = []byte{'k'}
+					b = binary.BigEndian.AppendUint64(b, 0x16B3900)
+					b = binary.BigEndian.AppendUint64(b, uint64(toPGTime(startTime)))
+					f.WriteMsg(cn, proto.CopyDataResponse, string(append(b, 1)))
+				default:
+					f.WriteMsg(cn, proto.ErrorResponse, "SERROR\x00C42601\x00Msyntax error: "+q+"\x00\x00")
+					f.WriteMsg(cn, proto.ReadyForQuery, "I")
+				}
+			case proto.CopyDataRequest:
+				msgs <- msg
+			case proto.CopyDoneRequest:
+				f.WriteMsg(cn, proto.CopyDoneResponse, "")
+				f.WriteMsg(cn, proto.CommandComplete, "COPY 0\x00")
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.Terminate:
+				cn.Close()
+				return
+			}
+		}
+	})
+	defer f.Close()
+
+	var (
+		ctx = context.Background()
+		rc  = replicationConn(t, f.DSN())
+	)
+	sys, err := rc.IdentifySystem(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (IdentifySystem{SystemID: "7341", Timeline: 1, XLogPos: 0x16B3748, DBName: "pqgo"}); sys != want {
+		t.Errorf("\nhave: %#v\nwant: %#v", sys, want)
+	}
+
+	if _, err := rc.Receive(ctx); err != errReplicationNotStreaming {
+		t.Errorf("wrong error: %v", err)
+	}
+	err = rc.StartReplication(ctx, "slot", sys.XLogPos, map[string]string{"proto_version": "1", "publication_names": "it's"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing sent yet: times out, but can still be used afterwards.
+	tctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := rc.Receive(tctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error: %v", err)
+	}
+	close(sendXLog)
+
+	msg, err := rc.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, ok := msg.(*XLogData)
+	if !ok {
+		t.Fatalf("wrong type: %T", msg)
+	}
+	if x.WALStart != 0x16B3748 || x.ServerWALEnd != 0x16B3800 || !x.ServerTime.Equal(startTime) || string(x.Data) != "data" {
+		t.Errorf("%#v", x)
+	}
+
+	msg, err = rc.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, ok := msg.(*PrimaryKeepalive)
+	if !ok {
+		t.Fatalf("wrong type: %T", msg)
+	}
+	if k.ServerWALEnd != 0x16B3900 || !k.ServerTime.Equal(startTime) || !k.ReplyRequested {
+		t.Errorf("%#v", k)
+	}
+
+	err = rc.SendStandbyStatus(StandbyStatus{WALWrite: 3, WALFlush: 2, WALApply: 1, ClientTime: startTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := <-msgs
+	want := []byte{'r'}
+	want = binary.BigEndian.AppendUint64(want, 3)
+	want = binary.BigEndian.AppendUint64(want, 2)
+	want = binary.BigEndian.AppendUint64(want, 1)
+	want = binary.BigEndian.AppendUint64(want, uint64(toPGTime(startTime)))
+	want = append(want, 0)
+	if string(b) != string(want) {
+		t.Errorf("\nhave: %x\nwant: %x", b, want)
+	}
+
+	if err := rc.EndReplication(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.Receive(ctx); err != errReplicationNotStreaming {
+		t.Errorf("wrong error: %v", err)
+	}
+	if _, err := rc.IdentifySystem(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.DropReplicationSlot(ctx, "slot", false); !pqtest.ErrorContains(err, "syntax error: DROP_REPLICATION_SLOT") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+// writeRows writes a result set with text columns; nil values are sent as
+// NULL.
+func writeRows(f pqtest.Fake, cn net.Conn, cols []string, rows ...[]any) {
+	b := binary.BigEndian.AppendUint16(nil, uint16(len(cols)))
+	for _, c := range cols {
+		b = append(b, c...)
+		b = append(b, 0, 0, 0, 0, 0, 0, 0)
+		b = binary.BigEndian.AppendUint32(b, uint32(oid.T_text))
+		b = append(b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0)
+	}
+	f.WriteMsg(cn, proto.RowDescription, string(b))
+	for _, row := range rows {
+		b = binary.BigEndian.AppendUint16(b[:0], uint16(len(row)))
+		for _, v := range row {
+			if v == nil {
+				b = binary.BigEndian.AppendUint32(b, 0xffffffff)
+				continue
+			}
+			s := fmt.Sprint(v)
+			b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+			b = append(b, s...)
+		}
+		f.WriteMsg(cn, proto.DataRow, string(b))
+	}
+	f.WriteMsg(cn, proto.CommandComplete, "SELECT\x00")
+}
+
+func TestPhysicalReplicationFake(t *testing.T) {
+	t.Parallel()
+
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		_, params, ok := f.ReadStartup(cn)
+		if !ok {
+			return
+		}
+		if params["replication"] != "true" {
+			f.WriteMsg(cn, proto.ErrorResponse, "SFATAL\x00C08P01\x00Mnot a physical replication connection\x00\x00")
+			return
+		}
+		f.WriteMsg(cn, proto.AuthenticationRequest, "\x00\x00\x00\x00")
+		f.WriteMsg(cn, proto.ReadyForQuery, "I")
+
+		for {
+			code, msg, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			switch code {
+			case proto.Query:
+				switch q := strings.TrimRight(string(msg), "\x00"); q {
+				case "TIMELINE_HISTORY 2":
+					f.SimpleQuery(cn, "TIMELINE_HISTORY", "filename", "00000002.history", "content", "1\t0/3000000\tno recovery target specified\n")
+					f.WriteMsg(cn, proto.ReadyForQuery, "I")
+				case `START_REPLICATION SLOT "slot" PHYSICAL 0/2000000 TIMELINE 1`:
+					f.WriteMsg(cn, proto.CopyBothResponse, "\x00\x00\x00")
+					b := []byte{'w'}
+					b = binary.BigEndian.AppendUint64(b, 0x2000000)
+					b = binary.BigEndian.AppendUint64(b, 0x3000000)
+					b = binary.BigEndian.AppendUint64(b, 0)
+					f.WriteMsg(cn, proto.CopyDataResponse, string(append(b, "wal"...)))
+					f.WriteMsg(cn, proto.CopyDoneResponse, "")
+				case `START_REPLICATION PHYSICAL 0/3000000 TIMELINE 1`:
+					// Start of the timeline switch: nothing to stream.
+					writeRows(f, cn, []string{"next_tli", "next_tli_startpos"}, []any{2, "0/3000000"})
+					f.WriteMsg(cn, proto.CommandComplete, "START_STREAMING\x00")
+					f.WriteMsg(cn, proto.ReadyForQuery, "I")
+				default:
+					f.WriteMsg(cn, proto.ErrorResponse, "SERROR\x00C42601\x00Msyntax error: "+q+"\x00\x00")
+					f.WriteMsg(cn, proto.ReadyForQuery, "I")
+				}
+			case proto.CopyDoneRequest:
+				writeRows(f, cn, []string{"next_tli", "next_tli_startpos"}, []any{2, "0/3000000"})
+				f.WriteMsg(cn, proto.CommandComplete, "START_STREAMING\x00")
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.Terminate:
+				cn.Close()
+				return
+			}
+		}
+	})
+	defer f.Close()
+
+	var (
+		ctx = context.Background()
+		rc  = replicationConn(t, f.DSN()+" replication=true")
+	)
+
+	h, err := rc.TimelineHistory(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Filename != "00000002.history" || string(h.Content) != "1\t0/3000000\tno recovery target specified\n" {
+		t.Errorf("%#v", h)
+	}
+
+	err = rc.StartPhysicalReplication(ctx, "slot", 0x2000000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := rc.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, ok := msg.(*XLogData); !ok || string(x.Data) != "wal" || x.WALStart != 0x2000000 {
+		t.Errorf("%#v", msg)
+	}
+	if _, err := rc.Receive(ctx); err != io.EOF {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if err := rc.EndReplication(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if tli, start := rc.NextTimeline(); tli != 2 || start != 0x3000000 {
+		t.Errorf("wrong next timeline: %d %s", tli, start)
+	}
+
+	err = rc.StartPhysicalReplication(ctx, "", 0x3000000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.Receive(ctx); err != io.EOF {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if err := rc.EndReplication(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if tli, start := rc.NextTimeline(); tli != 2 || start != 0x3000000 {
+		t.Errorf("wrong next timeline: %d %s", tli, start)
+	}
+	if _, err := rc.TimelineHistory(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+}
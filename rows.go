@@ -1,6 +1,7 @@
 package pq
 
 import (
+	"cmp"
 	"database/sql/driver"
 	"fmt"
 	"io"
@@ -30,6 +31,8 @@ type (
 	rows struct {
 		cn     *conn
 		finish func()
+		trace  traceEnd
+		err    error // First error from Next, for trace.
 		rowsHeader
 		done   bool
 		rb     readBuf
@@ -37,13 +40,32 @@ type (
 		tag    string
 
 		next *rowsHeader
+
+		// Number of rows fetched with every Execute; 0 if all rows are fetched
+		// at once.
+		fetch int
+
+		// Set for rows in a pipeline, which end with CommandComplete or
+		// ErrorResponse rather than ReadyForQuery.
+		pipeline *Pipeline
 	}
 )
 
-func (rs *rows) Close() error {
+func (rs *rows) Close() (err error) {
 	if rs.finish != nil {
 		defer rs.finish()
 	}
+	if rs.trace != nil {
+		defer func() {
+			rs.trace(rs.result, rs.tag, cmp.Or(rs.err, err))
+			rs.trace = nil
+		}()
+	}
+	// Don't fetch the rest of the rows if only some were fetched; the Sync
+	// closes the portal.
+	if err := rs.cn.sendPendingSync(); err != nil {
+		return rs.cn.handleError(err)
+	}
 	// no need to look at cn.bad as Next() will
 	for {
 		err := rs.Next(nil)
@@ -85,6 +107,13 @@ func (rs *rows) Next(dest []driver.Value) (resErr error) {
 	if err := rs.cn.err.getForNext(); err != nil {
 		return err
 	}
+	if rs.trace != nil {
+		defer func() {
+			if resErr != nil && resErr != io.EOF && rs.err == nil {
+				rs.err = resErr
+			}
+		}()
+	}
 
 	for {
 		t, err := rs.cn.recv1Buf(&rs.rb)
@@ -94,6 +123,14 @@ func (rs *rows) Next(dest []driver.Value) (resErr error) {
 		switch t {
 		case proto.ErrorResponse:
 			resErr = parseError(&rs.rb, "")
+			if err := rs.cn.sendPendingSync(); err != nil {
+				return rs.cn.handleError(err)
+			}
+			if rs.pipeline != nil {
+				rs.pipeline.aborted = true
+				rs.done = true
+				return rs.cn.handleError(resErr)
+			}
 		case proto.CommandComplete, proto.EmptyQueryResponse:
 			if t == proto.CommandComplete {
 				rs.result, rs.tag, err = rs.cn.parseComplete(rs.rb.string())
@@ -101,6 +138,13 @@ func (rs *rows) Next(dest []driver.Value) (resErr error) {
 					return rs.cn.handleError(err)
 				}
 			}
+			if err := rs.cn.sendPendingSync(); err != nil {
+				return rs.cn.handleError(err)
+			}
+			if rs.pipeline != nil {
+				rs.done = true
+				return io.EOF
+			}
 			continue
 		case proto.ReadyForQuery:
 			rs.cn.processReadyForQuery(&rs.rb)
@@ -130,6 +174,15 @@ func (rs *rows) Next(dest []driver.Value) (resErr error) {
 				}
 			}
 			return rs.cn.handleError(resErr)
+		case proto.PortalSuspended:
+			// Fetch the next rows, unless the rows are being closed and Sync
+			// was already sent.
+			if rs.cn.syncPending {
+				if err := rs.cn.sendExecute(rs.fetch); err != nil {
+					return rs.cn.handleError(err)
+				}
+			}
+			continue
 		case proto.RowDescription:
 			next := parsePortalRowDescribe(&rs.rb)
 			rs.next = &next
@@ -2,11 +2,15 @@ package pq
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"hash"
 	"net"
 	"os"
 	"path/filepath"
@@ -14,10 +18,16 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/lib/pq/internal/pkcs"
 	"github.com/lib/pq/internal/pqutil"
 	"github.com/lib/pq/internal/proto"
 )
 
+// SSLPasswordProvider gets the password for an encrypted SSL key or PKCS #12
+// file if the sslpassword connection parameter isn't set. file is the path of
+// the key or PKCS #12 file, or empty if sslinline is set.
+type SSLPasswordProvider func(ctx context.Context, file string) (string, error)
+
 // Registry for custom tls.Configs
 var (
 	tlsConfs   = make(map[string]*tls.Config)
@@ -64,7 +74,9 @@ func getTLSConfigClone(key string) *tls.Config {
 //
 // Don't refer to Config.SSLMode here, as the mode in arguments may be different
 // in case of sslmode=allow or prefer.
-func ssl(cfg Config, mode SSLMode) (func(net.Conn) (net.Conn, error), error) {
+//
+// password is called to get the password for an encrypted client key.
+func ssl(cfg Config, mode SSLMode, password func(file string) (string, error)) (func(net.Conn) (net.Conn, error), error) {
 	var (
 		home = pqutil.Home(true)
 		// Don't set defaults here, because tlsConf may be overwritten if a
@@ -135,7 +147,7 @@ func ssl(cfg Config, mode SSLMode) (func(net.Conn) (net.Conn, error), error) {
 		tlsConf.ServerName = cfg.Host
 	}
 
-	err := sslClientCertificates(tlsConf, cfg, home)
+	err := sslClientCertificates(tlsConf, cfg, home, password)
 	if err != nil {
 		return nil, err
 	}
@@ -145,6 +157,20 @@ func ssl(cfg Config, mode SSLMode) (func(net.Conn) (net.Conn, error), error) {
 	}
 	sslAppendIntermediates(tlsConf, cfg, rootPem)
 
+	// Like libpq, CRLs are only checked if the server certificate is verified.
+	var crl *crlChecker
+	if verifyCaOnly || mode == SSLModeVerifyFull {
+		crl, err = sslCRL(cfg, home)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if crl != nil && !verifyCaOnly {
+		tlsConf.VerifyConnection = func(state tls.ConnectionState) error {
+			return crl.check(state.VerifiedChains)
+		}
+	}
+
 	// Accept renegotiation requests initiated by the backend.
 	//
 	// Renegotiation was deprecated then removed from PostgreSQL 9.5, but the
@@ -168,7 +194,10 @@ func ssl(cfg Config, mode SSLMode) (func(net.Conn) (net.Conn, error), error) {
 			for _, cert := range certs[1:] {
 				opts.Intermediates.AddCert(cert)
 			}
-			_, err = certs[0].Verify(opts)
+			chains, err := certs[0].Verify(opts)
+			if err == nil && crl != nil {
+				err = crl.check(chains)
+			}
 			return client, err
 		}
 		return client, nil
@@ -180,9 +209,12 @@ func ssl(cfg Config, mode SSLMode) (func(net.Conn) (net.Conn, error), error) {
 // "sslkey" settings, or if they aren't set, from the .postgresql directory
 // in the user's home directory. The configured files must exist and have
 // the correct permissions.
-func sslClientCertificates(tlsConf *tls.Config, cfg Config, home string) error {
+//
+// password is called to get the password if the key is encrypted or sslcert is
+// a PKCS #12 file.
+func sslClientCertificates(tlsConf *tls.Config, cfg Config, home string, password func(file string) (string, error)) error {
 	if cfg.SSLInline {
-		cert, err := tls.X509KeyPair([]byte(cfg.SSLCert), []byte(cfg.SSLKey))
+		cert, err := sslKeyPair([]byte(cfg.SSLCert), []byte(cfg.SSLKey), "", password)
 		if err != nil {
 			return err
 		}
@@ -213,6 +245,23 @@ func sslClientCertificates(tlsConf *tls.Config, cfg Config, home string) error {
 		return err
 	}
 
+	// PKCS #12 files contain both the certificate and key; this is a pq
+	// extension.
+	if ext := strings.ToLower(filepath.Ext(cfg.SSLCert)); ext == ".p12" || ext == ".pfx" {
+		err := pqutil.SSLKeyPermissions(cfg.SSLCert)
+		if err != nil {
+			return err
+		}
+		cert, err := sslPKCS12(cfg.SSLCert, password)
+		if err != nil {
+			return err
+		}
+		tlsConf.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return &cert, nil
+		}
+		return nil
+	}
+
 	// In libpq, the ssl key is only loaded if the setting is not blank.
 	if cfg.SSLKey == "" && home != "" {
 		cfg.SSLKey = filepath.Join(home, "postgresql.key")
@@ -224,7 +273,15 @@ func sslClientCertificates(tlsConf *tls.Config, cfg Config, home string) error {
 		}
 	}
 
-	cert, err := tls.LoadX509KeyPair(cfg.SSLCert, cfg.SSLKey)
+	certPEM, err := os.ReadFile(cfg.SSLCert)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := os.ReadFile(cfg.SSLKey)
+	if err != nil {
+		return err
+	}
+	cert, err := sslKeyPair(certPEM, keyPEM, cfg.SSLKey, password)
 	if err != nil {
 		return err
 	}
@@ -236,6 +293,78 @@ func sslClientCertificates(tlsConf *tls.Config, cfg Config, home string) error {
 	return nil
 }
 
+// sslKeyPair parses a PEM encoded certificate and key, decrypting the key if
+// it's encrypted with PKCS #8 or the legacy OpenSSL encryption.
+func sslKeyPair(certPEM, keyPEM []byte, keyFile string, password func(file string) (string, error)) (tls.Certificate, error) {
+	name := keyFile
+	if name == "" {
+		name = "sslkey"
+	}
+	for rest := keyPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			continue
+		}
+		legacy := block.Headers["Proc-Type"] == "4,ENCRYPTED"
+		if block.Type != "ENCRYPTED PRIVATE KEY" && !legacy {
+			break
+		}
+
+		pw, err := password(keyFile)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("pq: getting sslpassword: %w", err)
+		}
+		if pw == "" {
+			return tls.Certificate{}, fmt.Errorf("pq: private key %q is encrypted, but sslpassword is not set", name)
+		}
+		var (
+			der []byte
+			typ = "PRIVATE KEY"
+		)
+		if legacy {
+			der, err = pkcs.DecryptPEMBlock(block, pw)
+			typ = block.Type
+		} else {
+			der, err = pkcs.DecryptPKCS8(block.Bytes, pw)
+		}
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("pq: could not decrypt private key %q: %w", name, err)
+		}
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+		break
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// sslPKCS12 loads the certificate and key from a PKCS #12 file. Intermediate CA
+// certificates in the file are sent with the certificate.
+func sslPKCS12(file string, password func(file string) (string, error)) (tls.Certificate, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	pw, err := password(file)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("pq: getting sslpassword: %w", err)
+	}
+	key, leaf, certs, err := pkcs.DecodePKCS12(data, pw)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("pq: could not load PKCS #12 file %q: %w", file, err)
+	}
+
+	cert := tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: key, Leaf: leaf}
+	for _, c := range certs {
+		if c.IsCA && !bytes.Equal(c.RawIssuer, c.RawSubject) {
+			cert.Certificate = append(cert.Certificate, c.Raw)
+		}
+	}
+	return cert, nil
+}
+
 var testSystemRoots *x509.CertPool
 
 // sslCertificateAuthority adds the RootCA specified in the "sslrootcert" setting.
@@ -317,3 +446,29 @@ func sslAppendIntermediates(tlsConf *tls.Config, cfg Config, rootPem []byte) {
 		return cert, nil
 	}
 }
+
+// tlsServerEndPoint gets the channel binding data for the "tls-server-end-point"
+// channel binding type (RFC5929): a hash of the server certificate, with the
+// hash function of the certificate's signature algorithm, or SHA-256 if that's
+// MD5 or SHA-1.
+func tlsServerEndPoint(state tls.ConnectionState) ([]byte, error) {
+	if len(state.PeerCertificates) == 0 {
+		return nil, errors.New("pq: channel binding: no server certificate")
+	}
+	cert := state.PeerCertificates[0]
+	var h hash.Hash
+	switch cert.SignatureAlgorithm {
+	case x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1,
+		x509.SHA256WithRSA, x509.SHA256WithRSAPSS, x509.DSAWithSHA256, x509.ECDSAWithSHA256:
+		h = sha256.New()
+	case x509.SHA384WithRSA, x509.SHA384WithRSAPSS, x509.ECDSAWithSHA384:
+		h = sha512.New384()
+	case x509.SHA512WithRSA, x509.SHA512WithRSAPSS, x509.ECDSAWithSHA512:
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("pq: channel binding: unsupported signature algorithm %s for the server certificate",
+			cert.SignatureAlgorithm)
+	}
+	h.Write(cert.Raw)
+	return h.Sum(nil), nil
+}
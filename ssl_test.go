@@ -2,13 +2,25 @@ package pq
 
 import (
 	"bytes"
-	_ "crypto/sha256"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"database/sql"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"net"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -426,11 +438,11 @@ func TestUnreadableHome(t *testing.T) {
 	// Ignore HOME being unset or not a directory
 	for _, h := range []string{"", "/dev/null"} {
 		t.Setenv("HOME", h)
-		err := sslClientCertificates(&tls.Config{}, Config{}, h)
+		err := sslClientCertificates(&tls.Config{}, Config{}, h, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
-		_, err = ssl(Config{}, SSLModeRequire)
+		_, err = ssl(Config{}, SSLModeRequire, nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -521,3 +533,393 @@ func mockPostgresSSL(t *testing.T, direct bool) (string, chan string, chan error
 
 	return port, nameCh, errCh
 }
+
+func TestChannelBinding(t *testing.T) {
+	t.Parallel()
+
+	cert, err := tls.LoadX509KeyPair("testdata/ssl/server.crt", "testdata/ssl/server.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endPoint := sha256.Sum256(cert.Certificate[0])
+
+	type result struct{ mech, first, final string }
+	newServer := func(t *testing.T, mechs string) (pqtest.Fake, chan result) {
+		ch := make(chan result, 1)
+		f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+			defer cn.Close()
+			b := make([]byte, 8)
+			if _, err := io.ReadFull(cn, b); err != nil {
+				return
+			}
+			cn.Write([]byte("S"))
+			tc := tls.Server(cn, &tls.Config{Certificates: []tls.Certificate{cert}})
+			if _, _, ok := f.ReadStartup(tc); !ok {
+				return
+			}
+
+			f.WriteMsg(tc, proto.AuthenticationRequest, "\x00\x00\x00\x0a"+mechs+"\x00")
+			code, msg, ok := f.ReadMsg(tc)
+			if !ok || code != proto.SASLInitialResponse {
+				return
+			}
+			var res result
+			res.mech, msg = string(msg[:bytes.IndexByte(msg, 0)]), msg[bytes.IndexByte(msg, 0)+5:]
+			res.first = string(msg)
+			nonce := res.first[strings.Index(res.first, ",r=")+3:]
+
+			f.WriteMsg(tc, proto.AuthenticationRequest, "\x00\x00\x00\x0br="+nonce+"srv,s=QSXCR+Q6sek8bf92,i=4096")
+			code, msg, ok = f.ReadMsg(tc)
+			if !ok || code != proto.SASLResponse {
+				return
+			}
+			res.final = string(msg)
+			ch <- res
+			f.WriteMsg(tc, proto.ErrorResponse, "SFATAL\x00C28P01\x00Mdone\x00\x00")
+		})
+		t.Cleanup(f.Close)
+		return f, ch
+	}
+
+	var (
+		plus = "p=tls-server-end-point,,"
+		cb   = base64.StdEncoding.EncodeToString(append([]byte(plus), endPoint[:]...))
+	)
+	tests := []struct {
+		mechs, connect          string
+		wantMech, wantGS2, want string
+		wantErr                 string
+	}{
+		{"SCRAM-SHA-256-PLUS\x00SCRAM-SHA-256\x00", "", "SCRAM-SHA-256-PLUS", plus, cb, ""},
+		{"SCRAM-SHA-256-PLUS\x00SCRAM-SHA-256\x00", "channel_binding=require", "SCRAM-SHA-256-PLUS", plus, cb, ""},
+		{"SCRAM-SHA-256-PLUS\x00SCRAM-SHA-256\x00", "channel_binding=disable", "SCRAM-SHA-256", "n,,", "biws", ""},
+		{"SCRAM-SHA-256\x00", "", "SCRAM-SHA-256", "y,,", "eSws", ""},
+		{"SCRAM-SHA-256\x00", "channel_binding=require", "", "", "",
+			"channel binding required, but server does not support SCRAM-SHA-256-PLUS"},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			f, ch := newServer(t, tt.mechs)
+			_, err := pqtest.DB(t, f.DSN()+" sslmode=require user=u password=p "+tt.connect)
+			if tt.wantErr != "" {
+				if !pqtest.ErrorContains(err, tt.wantErr) {
+					t.Fatalf("wrong error: %v", err)
+				}
+				return
+			}
+			if !pqtest.ErrorContains(err, "done") {
+				t.Fatalf("wrong error: %v", err)
+			}
+			res := <-ch
+			if res.mech != tt.wantMech || !strings.HasPrefix(res.first, tt.wantGS2+"n=") ||
+				!strings.HasPrefix(res.final, "c="+tt.want+",") {
+				t.Errorf("\nmech:  %s\nfirst: %s\nfinal: %s", res.mech, res.first, res.final)
+			}
+		})
+	}
+}
+
+func TestSSLCRL(t *testing.T) {
+	t.Parallel()
+
+	newCert := func(t *testing.T, tmpl *x509.Certificate, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.NotBefore, tmpl.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+		if parent == nil {
+			parent, parentKey = tmpl, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert, key
+	}
+	newCA := func(t *testing.T, name string) (*x509.Certificate, crypto.Signer) {
+		return newCert(t, &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{Organization: []string{"lib/pq"}, CommonName: name},
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		}, nil, nil)
+	}
+	newCRL := func(t *testing.T, ca *x509.Certificate, key crypto.Signer, next time.Time, serials ...int64) []byte {
+		tmpl := &x509.RevocationList{Number: big.NewInt(1), ThisUpdate: time.Now().Add(-time.Hour), NextUpdate: next}
+		for _, s := range serials {
+			tmpl.RevokedCertificateEntries = append(tmpl.RevokedCertificateEntries,
+				x509.RevocationListEntry{SerialNumber: big.NewInt(s), RevocationTime: time.Now()})
+		}
+		der, err := x509.CreateRevocationList(rand.Reader, tmpl, ca, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+	pemCRL := func(der ...[]byte) []byte {
+		var b []byte
+		for _, d := range der {
+			b = append(b, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: d})...)
+		}
+		return b
+	}
+
+	var (
+		dir             = t.TempDir()
+		ca, caKey       = newCA(t, "pq CRL CA")
+		other, otherKey = newCA(t, "pq other CA")
+		server, srvKey  = newCert(t, &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: "localhost"},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, ca, caKey)
+		hour = time.Now().Add(time.Hour)
+	)
+	write := func(name string, data []byte) string {
+		f := filepath.Join(dir, name)
+		if err := os.WriteFile(f, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	root := write("root.crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}))
+	revoked := write("revoked.crl", pemCRL(newCRL(t, ca, caKey, hour, 5), newCRL(t, ca, caKey, hour, 2)))
+	valid := write("valid.crl", pemCRL(newCRL(t, ca, caKey, hour, 5)))
+	der := write("revoked.der", newCRL(t, ca, caKey, hour, 2))
+	expired := write("expired.crl", pemCRL(newCRL(t, ca, caKey, time.Now().Add(-time.Minute))))
+	wrong := write("wrong.crl", pemCRL(newCRL(t, other, otherKey, hour, 2)))
+	bogus := write("bogus.crl", []byte("not a crl"))
+
+	h, err := x509NameHash(ca.RawSubject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashDir, emptyDir := filepath.Join(dir, "hashed"), filepath.Join(dir, "empty")
+	os.Mkdir(hashDir, 0o755)
+	os.Mkdir(emptyDir, 0o755)
+	write(fmt.Sprintf("hashed/%08x.r0", h), pemCRL(newCRL(t, ca, caKey, hour, 5)))
+	write(fmt.Sprintf("hashed/%08x.r1", h), newCRL(t, ca, caKey, hour, 2))
+	write("empty/revoked.crl", pemCRL(newCRL(t, ca, caKey, hour, 2)))
+
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		defer cn.Close()
+		b := make([]byte, 8)
+		if _, err := io.ReadFull(cn, b); err != nil {
+			return
+		}
+		cn.Write([]byte("S"))
+		tc := tls.Server(cn, &tls.Config{Certificates: []tls.Certificate{{
+			Certificate: [][]byte{server.Raw},
+			PrivateKey:  srvKey,
+		}}})
+		if tc.Handshake() != nil {
+			return
+		}
+		f.Startup(tc, nil)
+		for {
+			code, _, ok := f.ReadMsg(tc)
+			if !ok || code == proto.Terminate {
+				return
+			}
+			f.WriteMsg(tc, proto.EmptyQueryResponse, "")
+			f.WriteMsg(tc, proto.ReadyForQuery, "I")
+		}
+	})
+	t.Cleanup(f.Close)
+
+	tests := []struct {
+		connect string
+		wantErr string
+	}{
+		{"sslmode=verify-ca sslcrl=" + valid, ""},
+		{"sslmode=verify-full sslcrl=" + valid, ""},
+		{"sslmode=require sslcrl=" + revoked, `is revoked`}, // Same as verify-ca with sslrootcert.
+		{"sslmode=verify-ca sslcrl=" + revoked, `SSL certificate "CN=localhost" is revoked`},
+		{"sslmode=verify-full sslcrl=" + revoked, `SSL certificate "CN=localhost" is revoked`},
+		{"sslmode=verify-ca sslcrl=" + der, `is revoked`},
+		{"sslmode=verify-ca sslcrl=" + expired, `revocation list from "CN=pq CRL CA,O=lib/pq" has expired`},
+		{"sslmode=verify-ca sslcrl=" + wrong, `no SSL certificate revocation list found for "CN=localhost"`},
+		{"sslmode=verify-ca sslcrl=" + bogus, `could not parse SSL certificate revocation list`},
+		{"sslmode=verify-ca sslcrl=" + filepath.Join(dir, "nonexistent"), `could not load SSL certificate revocation list`},
+		{"sslmode=verify-ca sslcrldir=" + hashDir, `is revoked`},
+		{"sslmode=verify-ca sslcrldir=" + emptyDir, `no SSL certificate revocation list found`},
+		{"sslmode=verify-ca sslcrldir=" + emptyDir + " sslcrl=" + valid, ""},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			_, err := pqtest.DB(t, f.DSN()+" sslrootcert="+root+" "+tt.connect)
+			if !pqtest.ErrorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error:\nhave: %v\nwant: %s", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Not verified without sslrootcert.
+	t.Run("sslmode=require", func(t *testing.T) {
+		_, err := pqtest.DB(t, f.DSN()+" sslmode=require sslcrl="+revoked)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestX509NameHash(t *testing.T) {
+	t.Parallel()
+
+	// Compare to "openssl x509 -subject_hash".
+	tests := []struct {
+		cert string
+		want uint32
+	}{
+		{"testdata/ssl/root.crt", 0xe21534a0},
+		{"testdata/ssl/server.crt", 0x910e22e1},
+		{"testdata/ssl/intermediate.crt", 0x96f83371},
+		{"testdata/ssl/server_intermediate.crt", 0xa61cdb30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cert, func(t *testing.T) {
+			block, _ := pem.Decode(pqtest.Read(t, tt.cert))
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			have, err := x509NameHash(cert.RawSubject)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if have != tt.want {
+				t.Errorf("\nhave: %08x\nwant: %08x", have, tt.want)
+			}
+		})
+	}
+
+	t.Run("canonical", func(t *testing.T) {
+		// C=NL, O="  Lib  PQt", CN="Ünïcode  ÄB"
+		name, _ := base64.StdEncoding.DecodeString("MDsxCzAJBgNVBAYTAk5MMRMwEQYDVQQKDAogIExpYiAgUFF0MRcwFQYDVQQDDA7DnG7Dr2NvZGUgIMOEQg==")
+		have, err := x509NameHash(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := uint32(0x4dc060d7); have != want {
+			t.Errorf("\nhave: %08x\nwant: %08x", have, want)
+		}
+	})
+}
+
+func TestSSLPassword(t *testing.T) {
+	t.Parallel()
+	for _, f := range []string{"postgresql.key", "postgresql_pkcs8.key", "postgresql_pkcs8_3des.key", "postgresql_legacy.key",
+		"postgresql.p12", "postgresql_legacy.p12"} {
+		pqtest.Chmod(t, 0o600, "testdata/ssl", f)
+	}
+
+	cert, err := tls.LoadX509KeyPair("testdata/ssl/server.crt", "testdata/ssl/server.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pqtest.Read(t, "testdata/ssl/root.crt")) {
+		t.Fatal()
+	}
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		defer cn.Close()
+		b := make([]byte, 8)
+		if _, err := io.ReadFull(cn, b); err != nil {
+			return
+		}
+		cn.Write([]byte("S"))
+		tc := tls.Server(cn, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    roots,
+		})
+		if tc.Handshake() != nil {
+			return
+		}
+		f.Startup(tc, nil)
+		for {
+			code, _, ok := f.ReadMsg(tc)
+			if !ok || code == proto.Terminate {
+				return
+			}
+			f.WriteMsg(tc, proto.EmptyQueryResponse, "")
+			f.WriteMsg(tc, proto.ReadyForQuery, "I")
+		}
+	})
+	t.Cleanup(f.Close)
+
+	tests := []struct {
+		connect string
+		wantErr string
+	}{
+		{"sslkey=testdata/ssl/postgresql_pkcs8.key sslpassword=pqgo", ""},
+		{"sslkey=testdata/ssl/postgresql_pkcs8_3des.key sslpassword=pqgo", ""},
+		{"sslkey=testdata/ssl/postgresql_legacy.key sslpassword=pqgo", ""},
+		{"sslkey=testdata/ssl/postgresql.key sslpassword=ignored", ""},
+		{"sslcert=testdata/ssl/postgresql.p12 sslpassword=pqgo", ""},
+		{"sslcert=testdata/ssl/postgresql_legacy.p12 sslpassword=pqgo", ""},
+		{fmt.Sprintf("sslinline=true sslcert='%s' sslkey='%s' sslpassword=pqgo",
+			pqtest.Read(t, "testdata/ssl/postgresql.crt"), pqtest.Read(t, "testdata/ssl/postgresql_pkcs8.key")), ""},
+
+		{"sslkey=testdata/ssl/postgresql_pkcs8.key",
+			`pq: private key "testdata/ssl/postgresql_pkcs8.key" is encrypted, but sslpassword is not set`},
+		{"sslkey=testdata/ssl/postgresql_legacy.key sslpassword=wrong",
+			`pq: could not decrypt private key "testdata/ssl/postgresql_legacy.key": incorrect password`},
+		{"sslcert=testdata/ssl/postgresql.p12 sslpassword=wrong",
+			`pq: could not load PKCS #12 file "testdata/ssl/postgresql.p12": incorrect password`},
+		{fmt.Sprintf("sslinline=true sslcert='%s' sslkey='%s'",
+			pqtest.Read(t, "testdata/ssl/postgresql.crt"), pqtest.Read(t, "testdata/ssl/postgresql_pkcs8.key")),
+			`pq: private key "sslkey" is encrypted, but sslpassword is not set`},
+	}
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			_, err := pqtest.DB(t, f.DSN()+" sslmode=require sslcert=testdata/ssl/postgresql.crt "+tt.connect)
+			if !pqtest.ErrorContains(err, tt.wantErr) {
+				t.Fatalf("wrong error:\nhave: %v\nwant: %s", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("provider", func(t *testing.T) {
+		for _, k := range []string{"sslkey=testdata/ssl/postgresql_pkcs8.key", "sslcert=testdata/ssl/postgresql.p12"} {
+			c, err := NewConnector(pqtest.DSN(f.DSN() + " sslmode=require sslcert=testdata/ssl/postgresql.crt " + k))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var files []string
+			c.SSLPasswordProvider(func(ctx context.Context, file string) (string, error) {
+				files = append(files, file)
+				return "pqgo", nil
+			})
+			db := sql.OpenDB(c)
+			defer db.Close()
+			if err := db.Ping(); err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 1 || !strings.HasPrefix(k, "sslcert="+files[0]) && !strings.HasPrefix(k, "sslkey="+files[0]) {
+				t.Errorf("wrong files: %q", files)
+			}
+		}
+
+		c, err := NewConnector(pqtest.DSN(f.DSN() + " sslmode=require sslcert=testdata/ssl/postgresql.crt " +
+			"sslkey=testdata/ssl/postgresql_pkcs8.key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SSLPasswordProvider(func(ctx context.Context, file string) (string, error) {
+			return "", errors.New("oops")
+		})
+		db := sql.OpenDB(c)
+		defer db.Close()
+		if err := db.Ping(); !pqtest.ErrorContains(err, "pq: getting sslpassword: oops") {
+			t.Fatalf("wrong error: %v", err)
+		}
+	})
+}
@@ -11,11 +11,13 @@ import (
 )
 
 type stmt struct {
-	cn   *conn
-	name string
+	cn    *conn
+	name  string
+	query string
 	rowsHeader
 	colFmtData []byte
 	paramTyps  []oid.Oid
+	names      []string // Names for @name or :name placeholders, from pqsql.Named.
 	closed     bool
 }
 
@@ -64,40 +66,77 @@ func (st *stmt) Close() error {
 
 // Implement [driver.StmtQueryContext].
 func (st *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	args, err := st.bindNamed(args)
+	if err != nil {
+		return nil, err
+	}
 	finish := st.cn.watchCancel(ctx, true)
 	if err := st.cn.err.get(); err != nil {
 		return nil, err
 	}
 
-	err := st.exec(args)
+	fetch := st.cn.fetchSize(ctx)
+	end := st.cn.trace(ctx, traceQuery, TraceData{SQL: st.query, Args: len(args)})
+	err = st.cn.setStatementTimeout(ctx)
+	if err == nil {
+		err = st.exec(args, fetch)
+	}
 	if err != nil {
 		finish()
-		return nil, st.cn.handleError(err)
+		err = st.cn.handleError(err)
+		end.done(nil, "", err)
+		return nil, err
 	}
 
 	return &rows{
 		cn:         st.cn,
 		rowsHeader: st.rowsHeader,
 		finish:     finish,
+		trace:      end,
+		fetch:      fetch,
 	}, nil
 }
 
 // Implement [driver.StmtExecContext].
 func (st *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	args, err := st.bindNamed(args)
+	if err != nil {
+		return nil, err
+	}
 	defer st.cn.watchCancel(ctx, true)()
 	if err := st.cn.err.get(); err != nil {
 		return nil, err
 	}
 
-	err := st.exec(args)
+	end := st.cn.trace(ctx, traceQuery, TraceData{SQL: st.query, Args: len(args)})
+	err = st.cn.setStatementTimeout(ctx)
+	if err == nil {
+		err = st.exec(args, 0)
+	}
 	if err != nil {
-		return nil, st.cn.handleError(err)
+		err = st.cn.handleError(err)
+		end.done(nil, "", err)
+		return nil, err
 	}
-	res, _, err := st.cn.readExecuteResponse("simple query")
-	return res, st.cn.handleError(err)
+	res, commandTag, err := st.cn.readExecuteResponse("simple query")
+	err = st.cn.handleError(err)
+	end.done(res, commandTag, err)
+	return res, err
 }
 
-func (st *stmt) exec(v []driver.NamedValue) error {
+// bindNamed orders the arguments to match the named placeholders, if the
+// statement was prepared with them.
+func (st *stmt) bindNamed(args []driver.NamedValue) ([]driver.NamedValue, error) {
+	if st.names == nil {
+		return args, nil
+	}
+	return orderNamed(st.names, args)
+}
+
+// exec binds and executes the statement. If maxRows is more than 0, only that
+// many rows are fetched, and the Execute is sent with Flush instead of Sync so
+// the portal stays open for fetching more rows; see rows.Next.
+func (st *stmt) exec(v []driver.NamedValue, maxRows int) error {
 	if debugProto {
 		fmt.Fprintf(os.Stderr, "         START stmt.exec\n")
 		defer fmt.Fprintf(os.Stderr, "         END stmt.exec\n")
@@ -143,13 +182,18 @@ func (st *stmt) exec(v []driver.NamedValue) error {
 
 	w.next(proto.Execute)
 	w.byte(0)
-	w.int32(0)
+	w.int32(maxRows)
 
-	w.next(proto.Sync)
+	if maxRows > 0 {
+		w.next(proto.Flush)
+	} else {
+		w.next(proto.Sync)
+	}
 	err := cn.send(w)
 	if err != nil {
 		return err
 	}
+	cn.syncPending = maxRows > 0
 	err = cn.readBindResponse()
 	if err != nil {
 		return err
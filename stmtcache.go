@@ -0,0 +1,76 @@
+package pq
+
+import (
+	"container/list"
+	"errors"
+)
+
+// stmtCache is an LRU cache of named prepared statements, keyed by the query.
+type stmtCache struct {
+	cap   int
+	l     *list.List // Most recently used first.
+	items map[string]*list.Element
+}
+
+type stmtCacheEntry struct {
+	q  string
+	st *stmt
+}
+
+func newStmtCache(capacity int) *stmtCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &stmtCache{cap: capacity, l: list.New(), items: make(map[string]*list.Element)}
+}
+
+// get a cached statement, or nil if q isn't in the cache.
+func (c *stmtCache) get(q string) *stmt {
+	e, ok := c.items[q]
+	if !ok {
+		return nil
+	}
+	c.l.MoveToFront(e)
+	return e.Value.(*stmtCacheEntry).st
+}
+
+// evict removes the least recently used statement if the cache is full, so
+// that a new statement can be added. The caller must close the statement.
+func (c *stmtCache) evict() *stmt {
+	if c.l.Len() < c.cap {
+		return nil
+	}
+	e := c.l.Back()
+	c.l.Remove(e)
+	ent := e.Value.(*stmtCacheEntry)
+	delete(c.items, ent.q)
+	return ent.st
+}
+
+func (c *stmtCache) put(q string, st *stmt) {
+	c.items[q] = c.l.PushFront(&stmtCacheEntry{q: q, st: st})
+}
+
+func (c *stmtCache) remove(q string) {
+	if e, ok := c.items[q]; ok {
+		c.l.Remove(e)
+		delete(c.items, q)
+	}
+}
+
+// invalidates reports if err means that the cached statement can no longer be
+// used and needs to be prepared again: the result type changed because of a
+// schema change, or the statement was removed with DEALLOCATE or DISCARD.
+func (c *stmtCache) invalidates(err error) bool {
+	var pqErr *Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	switch pqErr.Code {
+	case "0A000": // feature_not_supported
+		return pqErr.Routine == "RevalidateCachedQuery" || pqErr.Message == "cached plan must not change result type"
+	case "26000": // invalid_sql_statement_name
+		return true
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package pq
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lib/pq/internal/pqtest"
+	"github.com/lib/pq/internal/proto"
+)
+
+func TestStmtCache(t *testing.T) {
+	pqtest.SkipPgbouncer(t)
+	pqtest.SkipPgpool(t)
+	pqtest.SkipCockroach(t)
+	t.Parallel()
+
+	db := pqtest.MustDB(t, "statement_cache_capacity=2")
+	db.SetMaxOpenConns(1)
+	pqtest.Exec(t, db, `create temp table stmtcache (a int)`)
+	pqtest.Exec(t, db, `insert into stmtcache values (1)`)
+
+	query := func(t *testing.T) []any {
+		t.Helper()
+		rows, err := db.Query(`select * from stmtcache where a = $1`, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		cols, _ := rows.Columns()
+		have := make([]any, len(cols))
+		for rows.Next() {
+			ptrs := make([]any, len(cols))
+			for i := range ptrs {
+				ptrs[i] = &have[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return have
+	}
+
+	if have := query(t); !reflect.DeepEqual(have, []any{int64(1)}) {
+		t.Errorf("%v", have)
+	}
+	var n int
+	err := db.QueryRow(`select count(*) from pg_prepared_statements where statement = $1`,
+		`select * from stmtcache where a = $1`).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("statement not cached: %d", n)
+	}
+
+	// Changing the result type invalidates the cached statement.
+	pqtest.Exec(t, db, `alter table stmtcache add column b text default 'x'`)
+	if have := query(t); !reflect.DeepEqual(have, []any{int64(1), "x"}) {
+		t.Errorf("%v", have)
+	}
+
+	// Evict the query.
+	for _, q := range []string{`select $1::int`, `select $1::text`} {
+		if _, err := db.Exec(q, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = db.QueryRow(`select count(*) from pg_prepared_statements where statement = $1`,
+		`select * from stmtcache where a = $1`).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("statement not evicted: %d", n)
+	}
+}
+
+func TestStmtCacheFake(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		log     []string
+		changed bool
+	)
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		f.Startup(cn, nil)
+		var (
+			stmts = make(map[string]bool) // Prepared before the change.
+			skip  bool
+		)
+		for {
+			code, msg, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			if skip && code != proto.Sync {
+				continue
+			}
+			mu.Lock()
+			switch code {
+			case proto.Query:
+				f.WriteMsg(cn, proto.EmptyQueryResponse, "")
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.Parse:
+				m := strings.Split(string(msg), "\x00")
+				log = append(log, "parse "+m[0]+" "+m[1])
+				stmts[m[0]] = changed
+				f.WriteMsg(cn, proto.ParseComplete, "")
+			case proto.Describe:
+				f.WriteMsg(cn, proto.ParameterDescription, "\x00\x01\x00\x00\x00\x17")
+				f.WriteMsg(cn, proto.NoData, "")
+			case proto.Bind:
+				name := strings.Split(string(msg), "\x00")[1]
+				if changed && !stmts[name] {
+					log = append(log, "invalid "+name)
+					f.WriteMsg(cn, proto.ErrorResponse, "SERROR\x00C0A000\x00Mcached plan must not change result type\x00RRevalidateCachedQuery\x00\x00")
+					skip = true
+					break
+				}
+				f.WriteMsg(cn, proto.BindComplete, "")
+			case proto.Execute:
+				f.WriteMsg(cn, proto.CommandComplete, "INSERT 0 1\x00")
+			case proto.Close:
+				log = append(log, "close "+strings.TrimRight(string(msg[1:]), "\x00"))
+				f.WriteMsg(cn, proto.CloseComplete, "")
+			case proto.Sync:
+				skip = false
+				f.WriteMsg(cn, proto.ReadyForQuery, "I")
+			case proto.Terminate:
+				cn.Close()
+				mu.Unlock()
+				return
+			}
+			mu.Unlock()
+		}
+	})
+	defer f.Close()
+
+	db := pqtest.MustDB(t, f.DSN()+" statement_cache_capacity=2")
+	db.SetMaxOpenConns(1)
+	exec := func(q string) {
+		t.Helper()
+		if _, err := db.Exec(q, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exec("one $1")
+	exec("one $1")
+	exec("two $1")
+	exec("one $1")
+	exec("three $1") // Evicts "two".
+	mu.Lock()
+	changed = true
+	mu.Unlock()
+	exec("one $1") // Prepared again.
+	exec("one $1")
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{
+		"parse 1 one $1",
+		"parse 2 two $1",
+		"close 2",
+		"parse 3 three $1",
+		"invalid 1",
+		"close 1",
+		"parse 4 one $1",
+	}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("\nhave: %q\nwant: %q", log, want)
+	}
+}
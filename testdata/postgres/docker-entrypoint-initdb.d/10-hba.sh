@@ -13,4 +13,6 @@ hostnossl  all       pqgosslcert  all      reject
 hostssl    all       pqgossl      all      trust
 hostssl    all       pqgosslcert  all      cert
 host       all       all          all      trust
+local      replication all                 trust
+host       replication all        all      trust
 EOF
@@ -0,0 +1,149 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+)
+
+// Tracer traces queries on connections opened with a [Connector], for example
+// to create OpenTelemetry spans or record metrics. It's set with
+// [Connector.Tracer].
+//
+// Queries run with QueryContext and ExecContext on a connection or prepared
+// statement are traced. Queries in a [Pipeline] or [Batch] and function calls
+// for [LargeObjects] aren't traced.
+//
+// A Tracer can also implement [ConnectTracer], [PrepareTracer], [CopyTracer],
+// and [TxTracer] to trace other operations.
+//
+// The callbacks are called synchronously; they should return quickly and must
+// not use the connection.
+type Tracer interface {
+	// TraceQueryStart is called before a query is sent. The returned context
+	// is passed to TraceQueryEnd.
+	TraceQueryStart(ctx context.Context, data TraceData) context.Context
+
+	// TraceQueryEnd is called when a query has finished, which is when the rows
+	// are closed for queries that return rows.
+	TraceQueryEnd(ctx context.Context, data TraceData)
+}
+
+// ConnectTracer traces connecting to the server, for every host that is tried.
+// SQL and Args in TraceData are not set.
+type ConnectTracer interface {
+	TraceConnectStart(ctx context.Context, data TraceData) context.Context
+	TraceConnectEnd(ctx context.Context, data TraceData)
+}
+
+// PrepareTracer traces preparing statements with PrepareContext.
+//
+// Queries with arguments that aren't prepared explicitly are also prepared (as
+// the unnamed statement, or cached with statement_cache_capacity), but that's
+// traced as part of the query.
+type PrepareTracer interface {
+	TracePrepareStart(ctx context.Context, data TraceData) context.Context
+	TracePrepareEnd(ctx context.Context, data TraceData)
+}
+
+// CopyTracer traces COPY commands run with [CopyTo], [CopyFrom], or by preparing
+// a "COPY [..] FROM STDIN" statement. For the latter the end is when the
+// statement is closed.
+type CopyTracer interface {
+	TraceCopyStart(ctx context.Context, data TraceData) context.Context
+	TraceCopyEnd(ctx context.Context, data TraceData)
+}
+
+// TxTracer traces starting, committing, and rolling back transactions. SQL is
+// set to the BEGIN, COMMIT, or ROLLBACK command, and the context for commits and
+// rollbacks is the context passed to BeginTx.
+type TxTracer interface {
+	TraceTxStart(ctx context.Context, data TraceData) context.Context
+	TraceTxEnd(ctx context.Context, data TraceData)
+}
+
+// TraceData has information about a traced operation. CommandTag, RowsAffected,
+// and Err are only set for the end callbacks.
+type TraceData struct {
+	Host string // Host connected to.
+	Port uint16 // Port connected to.
+	SQL  string // Query, statement, or command.
+	Args int    // Number of arguments for the query.
+
+	CommandTag   string // Command tag without the row count, e.g. "INSERT" or "SELECT".
+	RowsAffected int64  // Number of rows affected or returned, if known.
+	Err          error  // Error, if any.
+}
+
+type traceKind uint8
+
+const (
+	traceQuery traceKind = iota
+	traceConnect
+	tracePrepare
+	traceCopy
+	traceTx
+)
+
+// traceEnd calls the end callback of a traced operation, with the command tag
+// and rows affected from res and commandTag. It's nil if the operation isn't
+// traced.
+type traceEnd func(res driver.Result, commandTag string, err error)
+
+func (e traceEnd) done(res driver.Result, commandTag string, err error) {
+	if e != nil {
+		e(res, commandTag, err)
+	}
+}
+
+// trace calls the start callback for the kind of operation, if the tracer
+// implements it.
+func trace(ctx context.Context, t Tracer, kind traceKind, data TraceData) traceEnd {
+	if t == nil {
+		return nil
+	}
+	var (
+		start func(context.Context, TraceData) context.Context
+		end   func(context.Context, TraceData)
+	)
+	switch kind {
+	case traceQuery:
+		start, end = t.TraceQueryStart, t.TraceQueryEnd
+	case traceConnect:
+		if tt, ok := t.(ConnectTracer); ok {
+			start, end = tt.TraceConnectStart, tt.TraceConnectEnd
+		}
+	case tracePrepare:
+		if tt, ok := t.(PrepareTracer); ok {
+			start, end = tt.TracePrepareStart, tt.TracePrepareEnd
+		}
+	case traceCopy:
+		if tt, ok := t.(CopyTracer); ok {
+			start, end = tt.TraceCopyStart, tt.TraceCopyEnd
+		}
+	case traceTx:
+		if tt, ok := t.(TxTracer); ok {
+			start, end = tt.TraceTxStart, tt.TraceTxEnd
+		}
+	}
+	if start == nil {
+		return nil
+	}
+	if ctx == nil { // Commit or Rollback without BeginTx.
+		ctx = context.Background()
+	}
+
+	ctx = start(ctx, data)
+	return func(res driver.Result, commandTag string, err error) {
+		data.CommandTag, data.Err = commandTag, err
+		if res != nil {
+			data.RowsAffected, _ = res.RowsAffected()
+		}
+		end(ctx, data)
+	}
+}
+
+// trace calls the start callback for the kind of operation on the connection.
+func (cn *conn) trace(ctx context.Context, kind traceKind, data TraceData) traceEnd {
+	data.Host, data.Port = cn.cfg.Host, cn.cfg.Port
+	return trace(ctx, cn.tracer, kind, data)
+}
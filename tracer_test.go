@@ -0,0 +1,163 @@
+package pq
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lib/pq/internal/pqtest"
+	"github.com/lib/pq/internal/proto"
+)
+
+type testTracer struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+type testTracerKey struct{}
+
+func (t *testTracer) start(ctx context.Context, kind string, data TraceData) context.Context {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calls = append(t.calls, fmt.Sprintf("%s start %q args=%d", kind, data.SQL, data.Args))
+	return context.WithValue(ctx, testTracerKey{}, kind)
+}
+
+func (t *testTracer) end(ctx context.Context, kind string, data TraceData) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if k, _ := ctx.Value(testTracerKey{}).(string); k != kind {
+		t.calls = append(t.calls, fmt.Sprintf("%s end: wrong context: %q", kind, k))
+	}
+	if data.Host == "" || data.Port == 0 {
+		t.calls = append(t.calls, fmt.Sprintf("%s end: host not set: %q:%d", kind, data.Host, data.Port))
+	}
+	s := fmt.Sprintf("%s end %q tag=%q rows=%d", kind, data.SQL, data.CommandTag, data.RowsAffected)
+	if data.Err != nil {
+		s += " err=" + data.Err.Error()
+	}
+	t.calls = append(t.calls, s)
+}
+
+func (t *testTracer) TraceQueryStart(ctx context.Context, data TraceData) context.Context {
+	return t.start(ctx, "query", data)
+}
+func (t *testTracer) TraceQueryEnd(ctx context.Context, data TraceData) { t.end(ctx, "query", data) }
+func (t *testTracer) TraceConnectStart(ctx context.Context, data TraceData) context.Context {
+	return t.start(ctx, "connect", data)
+}
+func (t *testTracer) TraceConnectEnd(ctx context.Context, data TraceData) {
+	t.end(ctx, "connect", data)
+}
+func (t *testTracer) TracePrepareStart(ctx context.Context, data TraceData) context.Context {
+	return t.start(ctx, "prepare", data)
+}
+func (t *testTracer) TracePrepareEnd(ctx context.Context, data TraceData) {
+	t.end(ctx, "prepare", data)
+}
+func (t *testTracer) TraceTxStart(ctx context.Context, data TraceData) context.Context {
+	return t.start(ctx, "tx", data)
+}
+func (t *testTracer) TraceTxEnd(ctx context.Context, data TraceData) { t.end(ctx, "tx", data) }
+
+func TestTracer(t *testing.T) {
+	t.Parallel()
+
+	f := pqtest.NewFake(t, func(f pqtest.Fake, cn net.Conn) {
+		f.Startup(cn, nil)
+		status := "I"
+		for {
+			code, q, ok := f.ReadMsg(cn)
+			if !ok {
+				return
+			}
+			switch code {
+			case proto.Terminate:
+				cn.Close()
+				return
+			case proto.Query:
+				switch q := string(q[:bytes.IndexByte(q, 0)]); q {
+				case ";":
+					f.WriteMsg(cn, proto.EmptyQueryResponse, "")
+					f.WriteMsg(cn, proto.ReadyForQuery, "I")
+				case "select 1":
+					f.SimpleQuery(cn, "SELECT 1", "x", 1)
+					f.WriteMsg(cn, proto.ReadyForQuery, "I")
+				case "delete from tbl":
+					f.WriteMsg(cn, proto.CommandComplete, "DELETE 3\x00")
+					f.WriteMsg(cn, proto.ReadyForQuery, status)
+				case "select error":
+					f.WriteMsg(cn, proto.ErrorResponse, "SERROR\x00C42703\x00Mcolumn \"error\" does not exist\x00\x00")
+					f.WriteMsg(cn, proto.ReadyForQuery, "I")
+				case "BEGIN READ WRITE":
+					status = "T"
+					f.WriteMsg(cn, proto.CommandComplete, "BEGIN\x00")
+					f.WriteMsg(cn, proto.ReadyForQuery, status)
+				case "COMMIT":
+					status = "I"
+					f.WriteMsg(cn, proto.CommandComplete, "COMMIT\x00")
+					f.WriteMsg(cn, proto.ReadyForQuery, status)
+				default:
+					f.WriteMsg(cn, proto.ErrorResponse, "SERROR\x00C42601\x00Munexpected query: "+q+"\x00\x00")
+					f.WriteMsg(cn, proto.ReadyForQuery, "I")
+				}
+			}
+		}
+	})
+	defer f.Close()
+
+	c, err := NewConnector(f.DSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := new(testTracer)
+	c.Tracer(tr)
+	db := sql.OpenDB(c)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	pqtest.QueryRow[int](t, db, `select 1`)
+	pqtest.Exec(t, db, `delete from tbl`)
+	if _, err := db.Exec(`select error`); err == nil {
+		t.Fatal("error is nil")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`delete from tbl`); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	have := strings.Join(tr.calls, "\n")
+	want := strings.Join([]string{
+		`connect start "" args=0`,
+		`connect end "" tag="" rows=0`,
+		`query start "select 1" args=0`,
+		`query end "select 1" tag="SELECT" rows=1`,
+		`query start "delete from tbl" args=0`,
+		`query end "delete from tbl" tag="DELETE" rows=3`,
+		`query start "select error" args=0`,
+		`query end "select error" tag="" rows=0 err=pq: column "error" does not exist (42703)`,
+		`tx start "BEGIN READ WRITE" args=0`,
+		`tx end "BEGIN READ WRITE" tag="BEGIN" rows=0`,
+		`query start "delete from tbl" args=0`,
+		`query end "delete from tbl" tag="DELETE" rows=3`,
+		`tx start "COMMIT" args=0`,
+		`tx end "COMMIT" tag="COMMIT" rows=0`,
+	}, "\n")
+	if have != want {
+		t.Errorf("\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}